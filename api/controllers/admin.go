@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/ivinayakg/shorte.live/api/helpers"
+)
+
+type SuspendURLRequest struct {
+	Reason string `json:"reason"`
+}
+
+// RescanURLs screens every url again, ?suspend=true also suspends the matches.
+func (h *Handler) RescanURLs(w http.ResponseWriter, r *http.Request) {
+	suspend, _ := strconv.ParseBool(r.URL.Query().Get("suspend"))
+
+	if err := h.models.RescanURLs(suspend); err != nil {
+		helpers.SendJSONError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	// the rescan runs in the background, the flagged urls show up as it goes
+	helpers.SetHeaders("post", w, http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "rescan started"})
+}
+
+func (h *Handler) GetFlaggedURLs(w http.ResponseWriter, r *http.Request) {
+	urls, err := h.models.GetFlaggedURLs()
+	if err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	helpers.SetHeaders("GET", w, http.StatusOK)
+	json.NewEncoder(w).Encode(urls)
+}
+
+func (h *Handler) SuspendURL(w http.ResponseWriter, r *http.Request) {
+	body := new(SuspendURLRequest)
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	body.Reason = strings.TrimSpace(body.Reason)
+	if body.Reason == "" {
+		helpers.SendJSONError(w, http.StatusBadRequest, "suspension reason is required")
+		return
+	}
+
+	if err := h.models.SuspendURL(mux.Vars(r)["id"], body.Reason); err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	helpers.SetHeaders("post", w, http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "successfully suspended"})
+}
+
+func (h *Handler) UnsuspendURL(w http.ResponseWriter, r *http.Request) {
+	if err := h.models.UnsuspendURL(mux.Vars(r)["id"]); err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	helpers.SetHeaders("DELETE", w, http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "successfully unsuspended"})
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/ivinayakg/shorte.live/api/database"
+	"github.com/ivinayakg/shorte.live/api/helpers"
+	"github.com/ivinayakg/shorte.live/api/middleware"
+)
+
+type CreateAPIKeyRequest struct {
+	Name string `json:"name"`
+	// Scopes default to every scope when empty
+	Scopes    []database.APIKeyScope    `json:"scopes"`
+	RateLimit *database.APIKeyRateLimit `json:"rate_limit"`
+}
+
+type CreateAPIKeyResponse struct {
+	// Key is the plain key, it's only returned once
+	Key string `json:"key"`
+	*database.APIKey
+}
+
+func validAPIKeyScope(scope database.APIKeyScope) bool {
+	for _, s := range database.APIKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	userData := r.Context().Value(middleware.UserAuthKey).(*database.User)
+	body := new(CreateAPIKeyRequest)
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		helpers.SendJSONError(w, http.StatusBadRequest, "API key name is required")
+		return
+	}
+
+	if len(body.Scopes) == 0 {
+		body.Scopes = database.APIKeyScopes
+	}
+	for _, scope := range body.Scopes {
+		if !validAPIKeyScope(scope) {
+			helpers.SendJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid scope %v", scope))
+			return
+		}
+	}
+
+	if body.RateLimit != nil {
+		if err := h.models.Config.ValidateAPIKeyRateLimit(body.RateLimit); err != nil {
+			helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	plainKey, key, err := h.models.CreateAPIKey(userData, body.Name, body.Scopes, body.RateLimit)
+	if err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	helpers.SetHeaders("post", w, http.StatusCreated)
+	json.NewEncoder(w).Encode(CreateAPIKeyResponse{Key: plainKey, APIKey: key})
+}
+
+func (h *Handler) GetUserAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userData := r.Context().Value(middleware.UserAuthKey).(*database.User)
+
+	keys, err := h.models.GetUserAPIKeys(userData.ID)
+	if err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	helpers.SetHeaders("GET", w, http.StatusOK)
+	json.NewEncoder(w).Encode(keys)
+}
+
+func (h *Handler) DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	userData := r.Context().Value(middleware.UserAuthKey).(*database.User)
+
+	if err := h.models.DeleteAPIKey(userData.ID, mux.Vars(r)["id"]); err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	helpers.SetHeaders("DELETE", w, http.StatusNoContent)
+	json.NewEncoder(w).Encode(map[string]string{"message": "successfully deleted"})
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/gorilla/mux"
+	"github.com/ivinayakg/shorte.live/api/database"
+	"github.com/ivinayakg/shorte.live/api/helpers"
+	"github.com/ivinayakg/shorte.live/api/middleware"
+)
+
+type RegisterDomainRequest struct {
+	Host string `json:"host"`
+}
+
+type RegisterDomainResponse struct {
+	*database.Domain
+	// Record is the TXT record name the token has to be published under
+	Record string `json:"record"`
+}
+
+// validCustomHost accepts plain dns names which aren't one of our own domains.
+func validCustomHost(host string) bool {
+	if !govalidator.IsDNSName(host) || !strings.Contains(host, ".") {
+		return false
+	}
+	if host == helpers.NormalizeHost(os.Getenv("SHORTED_URL_DOMAIN")) {
+		return false
+	}
+	return helpers.RemoverDomainError(host)
+}
+
+func (h *Handler) RegisterDomain(w http.ResponseWriter, r *http.Request) {
+	userData := r.Context().Value(middleware.UserAuthKey).(*database.User)
+	body := new(RegisterDomainRequest)
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	host := helpers.NormalizeHost(body.Host)
+	if !validCustomHost(host) {
+		helpers.SendJSONError(w, http.StatusBadRequest, "invalid domain")
+		return
+	}
+
+	domain, err := h.models.RegisterDomain(userData, host)
+	if err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	helpers.SetHeaders("post", w, http.StatusCreated)
+	json.NewEncoder(w).Encode(RegisterDomainResponse{Domain: domain, Record: helpers.DomainVerificationPrefix + domain.Host})
+}
+
+func (h *Handler) GetUserDomains(w http.ResponseWriter, r *http.Request) {
+	userData := r.Context().Value(middleware.UserAuthKey).(*database.User)
+
+	domains, err := h.models.GetUserDomains(userData.ID)
+	if err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	helpers.SetHeaders("GET", w, http.StatusOK)
+	json.NewEncoder(w).Encode(domains)
+}
+
+func (h *Handler) VerifyDomain(w http.ResponseWriter, r *http.Request) {
+	userData := r.Context().Value(middleware.UserAuthKey).(*database.User)
+
+	domain, err := h.models.VerifyDomain(userData.ID, mux.Vars(r)["id"])
+	if err == database.ErrDomainTaken {
+		helpers.SendJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	helpers.SetHeaders("post", w, http.StatusOK)
+	json.NewEncoder(w).Encode(domain)
+}
+
+func (h *Handler) DeleteDomain(w http.ResponseWriter, r *http.Request) {
+	userData := r.Context().Value(middleware.UserAuthKey).(*database.User)
+
+	if err := h.models.DeleteDomain(userData.ID, mux.Vars(r)["id"]); err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	helpers.SetHeaders("DELETE", w, http.StatusNoContent)
+	json.NewEncoder(w).Encode(map[string]string{"message": "successfully deleted"})
+}
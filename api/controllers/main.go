@@ -0,0 +1,13 @@
+package controllers
+
+import "github.com/ivinayakg/shorte.live/api/models"
+
+// Handler serves the routes which read or write through the models, main
+// creates it with the models built around the store.
+type Handler struct {
+	models *models.Models
+}
+
+func NewHandler(m *models.Models) *Handler {
+	return &Handler{models: m}
+}
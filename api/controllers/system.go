@@ -3,25 +3,54 @@ package controllers
 import (
 	"encoding/json"
 	"net/http"
+	neturl "net/url"
 	"os"
 
 	"github.com/ivinayakg/shorte.live/api/helpers"
 )
 
-func SystemAvailable(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) SystemAvailable(w http.ResponseWriter, r *http.Request) {
 	result := true
-	if helpers.SystemUnderMaintenance(false) {
+	if h.models.Config.SystemUnderMaintenance(false) {
 		result = false
 	}
 	json.NewEncoder(w).Encode(map[string]interface{}{"message": "success", "available": result})
 }
 
+// SystemHealth reports the health of the optional subsystems, the api itself keeps
+// serving redirects when one of them is degraded.
+func SystemHealth(w http.ResponseWriter, r *http.Request) {
+	analytics := helpers.GetAnalyticsHealth()
+	status := "ok"
+	if !analytics.Healthy {
+		status = "degraded"
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "success", "status": status, "analytics": analytics})
+}
+
 func NotFound(w http.ResponseWriter, r *http.Request) {
 	notFoundUrl := os.Getenv("UI_NOT_FOUND_URL")
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 	http.Redirect(w, r, notFoundUrl, http.StatusTemporaryRedirect)
 }
 
+// UnavailableURL redirects to the not found page with the reason the link is
+// switched off, either "disabled" by its owner or "suspended" by an admin.
+func UnavailableURL(w http.ResponseWriter, r *http.Request, reason string, message string) {
+	notFoundUrl := os.Getenv("UI_NOT_FOUND_URL")
+	if parsed, err := neturl.Parse(notFoundUrl); err == nil {
+		query := parsed.Query()
+		query.Set("reason", reason)
+		if message != "" {
+			query.Set("message", message)
+		}
+		parsed.RawQuery = query.Encode()
+		notFoundUrl = parsed.String()
+	}
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	http.Redirect(w, r, notFoundUrl, http.StatusTemporaryRedirect)
+}
+
 func RedirectHome(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 	http.Redirect(w, r, os.Getenv("FRONTEND_URL"), http.StatusSeeOther)
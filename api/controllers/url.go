@@ -1,10 +1,11 @@
 package controllers
 
 import (
-	"context"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -13,12 +14,13 @@ import (
 	"github.com/asaskevich/govalidator"
 	"github.com/avct/uasurfer"
 	"github.com/gorilla/mux"
-	"github.com/ivinayakg/shorte.live/api/constants"
 	"github.com/ivinayakg/shorte.live/api/database"
 	"github.com/ivinayakg/shorte.live/api/helpers"
 	"github.com/ivinayakg/shorte.live/api/middleware"
 	"github.com/ivinayakg/shorte.live/api/models"
+	"github.com/ivinayakg/shorte.live/api/static"
 	"github.com/ivinayakg/shorte.live/api/timescale"
+	"github.com/ivinayakg/shorte.live/api/utils"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -27,77 +29,451 @@ type ShortenURLRequest struct {
 	Destination string `json:"destination"`
 	CustomShort string `json:"short"`
 	Expiry      int64  `json:"expiry"`
+	Password    string `json:"password"`
+	MaxClicks   int64  `json:"max_clicks"`
+	// Domain is a verified custom domain of the user, empty for the default domain
+	Domain string `json:"domain"`
+	// Targets are the device and os rules tried in order before Destination
+	Targets []database.URLTarget `json:"targets"`
+	// GeoRules are the country rules tried in order after Targets
+	GeoRules []database.URLGeoRule `json:"geo_rules"`
+	// Variants split the remaining visitors across destinations by weight
+	Variants       []database.URLVariant `json:"variants"`
+	StickyVariants bool                  `json:"sticky_variants"`
+	// UTM tags are merged into the destination, ForwardQuery passes the query
+	// string of the short url on to it
+	UTM          *database.URLUTM `json:"utm"`
+	ForwardQuery bool             `json:"forward_query"`
+	// ActivatesAt schedules the url, ComingSoonURL is where it sends visitors until then
+	ActivatesAt   int64  `json:"activates_at"`
+	ComingSoonURL string `json:"coming_soon_url"`
 }
 
 type ShortenURLReponse struct {
+	Destination    string                `json:"destination"`
+	CustomShort    string                `json:"short"`
+	Expiry         int64                 `json:"expiry"`
+	Protected      bool                  `json:"protected"`
+	MaxClicks      int64                 `json:"max_clicks"`
+	Workspace      string                `json:"workspace,omitempty"`
+	Domain         string                `json:"domain,omitempty"`
+	Targets        []database.URLTarget  `json:"targets,omitempty"`
+	GeoRules       []database.URLGeoRule `json:"geo_rules,omitempty"`
+	Variants       []database.URLVariant `json:"variants,omitempty"`
+	StickyVariants bool                  `json:"sticky_variants,omitempty"`
+	UTM            *database.URLUTM      `json:"utm,omitempty"`
+	ForwardQuery   bool                  `json:"forward_query,omitempty"`
+	ActivatesAt    int64                 `json:"activates_at,omitempty"`
+	ComingSoonURL  string                `json:"coming_soon_url,omitempty"`
+}
+
+type BulkShortenURLResult struct {
+	Index       int    `json:"index"`
+	Status      string `json:"status"`
 	Destination string `json:"destination"`
 	CustomShort string `json:"short"`
 	Expiry      int64  `json:"expiry"`
+	Error       string `json:"error,omitempty"`
 }
 
 type UpdateURLRequest struct {
 	CustomShort string `json:"short"`
 	Expiry      int64  `json:"expiry"`
 	Destination string `json:"destination"`
+	// Password is left as is when nil and removed when empty
+	Password *string `json:"password"`
+	// MaxClicks is left as is when nil and removes the limit when 0
+	MaxClicks *int64 `json:"max_clicks"`
+	// Active is left as is when nil, a suspended url can't be re-enabled
+	Active *bool `json:"active"`
+	// Targets, GeoRules and Variants are left as is when nil and removed when empty
+	Targets        *[]database.URLTarget  `json:"targets"`
+	GeoRules       *[]database.URLGeoRule `json:"geo_rules"`
+	Variants       *[]database.URLVariant `json:"variants"`
+	StickyVariants *bool                  `json:"sticky_variants"`
+	// UTM is left as is when nil and removed when all its tags are empty
+	UTM          *database.URLUTM `json:"utm"`
+	ForwardQuery *bool            `json:"forward_query"`
+	// ActivatesAt and ComingSoonURL are left as is when nil and removed when 0 or empty
+	ActivatesAt   *int64  `json:"activates_at"`
+	ComingSoonURL *string `json:"coming_soon_url"`
+}
+
+const bulkShortenMaxItems = 500
+
+var preoccupiedShorts = []string{"url", "user", "system", "workspace", "domain", "webhook", "admin", "shorte.live"}
+
+// validateShortenURLRequest applies the create rules to body, normalising the
+// destination and expiry in place.
+func validateShortenURLRequest(body *ShortenURLRequest) error {
+	// check if the input is an actual URL
+	if !govalidator.IsURL(body.Destination) {
+		return fmt.Errorf("invalid url")
+	}
+
+	// check for domain error
+	if !helpers.RemoverDomainError(body.Destination) {
+		return fmt.Errorf("invalid url")
+	}
+
+	if body.CustomShort != "" && (helpers.ContainsString(&preoccupiedShorts, &body.CustomShort) || helpers.NotValidShortString(&body.CustomShort)) {
+		return fmt.Errorf("can't use this short")
+	}
+
+	// enforce https, SSL
+	body.Destination = helpers.EnforceHTTP(body.Destination)
+
+	if body.ActivatesAt < 0 {
+		return fmt.Errorf("invalid activation time")
+	}
+
+	// the default lifetime of a scheduled url starts once it activates
+	if body.Expiry < helpers.LowestUnixTime() {
+		body.Expiry = time.Now().Add(time.Hour * 48).Unix()
+		if body.ActivatesAt > time.Now().Unix() {
+			body.Expiry = time.Unix(body.ActivatesAt, 0).Add(time.Hour * 48).Unix()
+		}
+	}
+
+	comingSoonURL, err := validateActivationWindow(body.ActivatesAt, body.Expiry, body.ComingSoonURL)
+	if err != nil {
+		return err
+	}
+	body.ComingSoonURL = comingSoonURL
+
+	if body.MaxClicks < 0 {
+		return fmt.Errorf("invalid max clicks")
+	}
+
+	if err := helpers.ValidateURLTargets(body.Targets); err != nil {
+		return err
+	}
+
+	if err := helpers.ValidateURLGeoRules(body.GeoRules); err != nil {
+		return err
+	}
+
+	if err := helpers.ValidateURLVariants(body.Variants); err != nil {
+		return err
+	}
+
+	utm, err := helpers.NormalizeURLUTM(body.UTM)
+	if err != nil {
+		return err
+	}
+	body.UTM = utm
+
+	return nil
+}
+
+// validateActivationWindow checks that a scheduled url activates before it expires,
+// and returns the normalised coming soon url.
+func validateActivationWindow(activatesAt int64, expiry int64, comingSoonURL string) (string, error) {
+	if activatesAt > 0 && activatesAt >= expiry {
+		return "", fmt.Errorf("activation time must be before the expiry")
+	}
+
+	if comingSoonURL == "" {
+		return "", nil
+	}
+	if !govalidator.IsURL(comingSoonURL) || !helpers.RemoverDomainError(comingSoonURL) {
+		return "", fmt.Errorf("invalid coming soon url")
+	}
+	return helpers.EnforceHTTP(comingSoonURL), nil
+}
+
+// screenDestination checks the destination against the blocklists, matches are
+// rejected or returned to be recorded on the url depending on SCREENING_ACTION.
+func screenDestination(destination string) (*database.URLScreening, error) {
+	screening := helpers.Screener.Screen(destination)
+	if screening != nil && helpers.Screener.Blocks() {
+		fmt.Printf("Blocked destination %v, matched %v in %v\n", destination, screening.Match, screening.List)
+		return nil, helpers.ErrUnsafeDestination
+	}
+	return screening, nil
+}
+
+// screenURLDestinations screens every destination of url, recording the first match.
+func screenURLDestinations(url *database.URL) error {
+	url.Screening = nil
+	for _, destination := range url.Destinations() {
+		screening, err := screenDestination(destination)
+		if err != nil {
+			return err
+		}
+		if url.Screening == nil {
+			url.Screening = screening
+		}
+	}
+	return nil
+}
+
+// newURLFromRequest builds the url to create from a validated request, the
+// domain has to be verified by the user.
+func (h *Handler) newURLFromRequest(user *database.User, body *ShortenURLRequest) (*database.URL, error) {
+	url := &database.URL{Short: body.CustomShort, Destination: body.Destination, Expiry: database.UnixTime(body.Expiry), MaxClicks: body.MaxClicks, Targets: body.Targets, GeoRules: body.GeoRules, Variants: body.Variants, StickyVariants: body.StickyVariants, UTM: body.UTM, ForwardQuery: body.ForwardQuery, ActivatesAt: database.UnixTime(body.ActivatesAt), ComingSoonURL: body.ComingSoonURL}
+
+	if err := screenURLDestinations(url); err != nil {
+		return nil, err
+	}
+
+	if body.Domain != "" {
+		domain, err := h.models.GetUserVerifiedDomain(user.ID, body.Domain)
+		if err != nil {
+			return nil, err
+		}
+		url.Domain = domain.Host
+	}
+
+	if body.Password != "" {
+		hash, err := utils.HashPassword(body.Password)
+		if err != nil {
+			return nil, err
+		}
+		url.Password = hash
+	}
+
+	return url, nil
+}
+
+// parseBulkShortenCSV reads rows of destination,short,expiry,domain. A leading header
+// row is skipped when its first column is "destination".
+func parseBulkShortenCSV(r *http.Request) ([]*ShortenURLRequest, error) {
+	reader := csv.NewReader(r.Body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	body := []*ShortenURLRequest{}
+	for i, record := range records {
+		if i == 0 && len(record) > 0 && strings.EqualFold(record[0], "destination") {
+			continue
+		}
+
+		entry := &ShortenURLRequest{}
+		if len(record) > 0 {
+			entry.Destination = record[0]
+		}
+		if len(record) > 1 {
+			entry.CustomShort = record[1]
+		}
+		if len(record) > 2 && record[2] != "" {
+			entry.Expiry, err = strconv.ParseInt(record[2], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid expiry on row %v", i+1)
+			}
+		}
+		if len(record) > 3 {
+			entry.Domain = record[3]
+		}
+		body = append(body, entry)
+	}
+
+	return body, nil
 }
 
-func ShortenURL(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) ShortenURL(w http.ResponseWriter, r *http.Request) {
 	userData := r.Context().Value(middleware.UserAuthKey).(*database.User)
 	body := new(ShortenURLRequest)
-	preoccupiedShorts := []string{"url", "user", "system", "shorte.live"}
 
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	info, err := helpers.RateLimit(r, userData.ID.Hex(), nil)
+	info, err := h.models.Config.RateLimit(r, userData.ID.Hex(), nil)
 	if err != nil {
 		helpers.SendJSONError(w, http.StatusTooManyRequests, fmt.Errorf("you have exhausted your quota for %v, %v to retry again", "Shorten URL", helpers.TimeRemaining(info)).Error())
 		return
 	}
 
-	// check if the input is an actual URL
-	if !govalidator.IsURL(body.Destination) {
-		helpers.SendJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid url").Error())
+	if err := validateShortenURLRequest(body); err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// check for domain error
-	if !helpers.RemoverDomainError(body.Destination) {
-		helpers.SendJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid url").Error())
+	workspaceId, ok := h.workspaceFromRequest(w, r, userData, database.WorkspaceEditor)
+	if !ok {
 		return
 	}
 
-	if body.CustomShort != "" && (helpers.ContainsString(&preoccupiedShorts, &body.CustomShort) || helpers.NotValidShortString(&body.CustomShort)) {
-		helpers.SendJSONError(w, http.StatusBadRequest, fmt.Errorf("can't use this short").Error())
+	url, err := h.newURLFromRequest(userData, body)
+	if err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	url.Workspace = workspaceId
 
-	// enforce https, SSL
-	body.Destination = helpers.EnforceHTTP(body.Destination)
-
-	if body.Expiry < helpers.LowestUnixTime() {
-		body.Expiry = time.Now().Add(time.Hour * 48).Unix()
-	}
-
-	shortedURL, err := models.CreateURL(userData, body.CustomShort, body.Destination, body.Expiry)
+	shortedURL, err := h.models.CreateURL(userData, url)
 	if err != nil {
 		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	resp := ShortenURLReponse{
-		Destination: shortedURL.Destination,
-		CustomShort: shortedURL.Short,
-		Expiry:      int64(shortedURL.Expiry),
+		Destination:    shortedURL.Destination,
+		CustomShort:    shortedURL.Short,
+		Expiry:         int64(shortedURL.Expiry),
+		Protected:      shortedURL.Password != "",
+		MaxClicks:      shortedURL.MaxClicks,
+		Domain:         shortedURL.Domain,
+		Targets:        shortedURL.Targets,
+		GeoRules:       shortedURL.GeoRules,
+		Variants:       shortedURL.Variants,
+		StickyVariants: shortedURL.StickyVariants,
+		UTM:            shortedURL.UTM,
+		ForwardQuery:   shortedURL.ForwardQuery,
+		ActivatesAt:    int64(shortedURL.ActivatesAt),
+		ComingSoonURL:  shortedURL.ComingSoonURL,
+	}
+	if shortedURL.Workspace != primitive.NilObjectID {
+		resp.Workspace = shortedURL.Workspace.Hex()
 	}
 
+	helpers.Background(func() { h.models.DispatchURLEvent(database.WebhookURLCreated, shortedURL) })
+
 	helpers.SetHeaders("post", w, http.StatusCreated)
 	json.NewEncoder(w).Encode(resp)
 }
 
-func ResolveURL(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) ShortenURLBulk(w http.ResponseWriter, r *http.Request) {
+	userData := r.Context().Value(middleware.UserAuthKey).(*database.User)
+	var body []*ShortenURLRequest
+	var err error
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		body, err = parseBulkShortenCSV(r)
+	} else {
+		err = json.NewDecoder(r.Body).Decode(&body)
+	}
+	if err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(body) == 0 {
+		helpers.SendJSONError(w, http.StatusBadRequest, "no urls provided")
+		return
+	}
+	if len(body) > bulkShortenMaxItems {
+		helpers.SendJSONError(w, http.StatusBadRequest, fmt.Sprintf("can't shorten more than %v urls at once", bulkShortenMaxItems))
+		return
+	}
+
+	// every url counts against the quota of creating them one by one
+	info, err := h.models.Config.RateLimitItems(r, userData.ID.Hex(), "/url", len(body))
+	if err != nil {
+		helpers.SendJSONError(w, http.StatusTooManyRequests, fmt.Errorf("your quota left for %v is less than %v urls, %v to retry again", "Shorten URL", len(body), helpers.TimeRemaining(info)).Error())
+		return
+	}
+
+	workspaceId, ok := h.workspaceFromRequest(w, r, userData, database.WorkspaceEditor)
+	if !ok {
+		return
+	}
+
+	results := make([]*BulkShortenURLResult, len(body))
+	urls := []*database.URL{}
+	urlIndex := []int{}
+
+	for i, entry := range body {
+		if entry == nil {
+			entry = &ShortenURLRequest{}
+		}
+		results[i] = &BulkShortenURLResult{Index: i, Destination: entry.Destination, CustomShort: entry.CustomShort, Expiry: entry.Expiry}
+
+		if err := validateShortenURLRequest(entry); err != nil {
+			results[i].Status = "failed"
+			results[i].Error = err.Error()
+			continue
+		}
+
+		url, err := h.newURLFromRequest(userData, entry)
+		if err != nil {
+			results[i].Status = "failed"
+			results[i].Error = err.Error()
+			continue
+		}
+
+		url.Workspace = workspaceId
+		urls = append(urls, url)
+		urlIndex = append(urlIndex, i)
+	}
+
+	failed := len(body) - len(urls)
+	if len(urls) > 0 {
+		errs := h.models.CreateURLBulk(userData, urls)
+		for j, url := range urls {
+			result := results[urlIndex[j]]
+			if errs[j] != nil {
+				result.Status = "failed"
+				result.Error = errs[j].Error()
+				failed++
+				continue
+			}
+			result.Status = "created"
+			result.Destination = url.Destination
+			result.CustomShort = url.Short
+			result.Expiry = int64(url.Expiry)
+		}
+
+		helpers.Background(func() {
+			for j, url := range urls {
+				if errs[j] == nil {
+					h.models.DispatchURLEvent(database.WebhookURLCreated, url)
+				}
+			}
+		})
+	}
+
+	status := http.StatusCreated
+	if failed > 0 {
+		status = http.StatusMultiStatus
+	}
+
+	helpers.SetHeaders("post", w, status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"created": len(body) - failed, "failed": failed, "results": results})
+}
+
+// urlExpired reports whether url stopped resolving, either by passing its
+// expiry or by using up its click limit.
+func urlExpired(url *database.URL, currentTime time.Time) bool {
+	if currentTime.After(time.Unix(int64(url.Expiry), 0)) {
+		return true
+	}
+	return url.MaxClicks > 0 && url.TotalClicks >= url.MaxClicks
+}
+
+// comingSoon redirects visitors of a url which isn't active yet to its coming
+// soon url, or to UI_COMING_SOON_URL with the activation time.
+func comingSoon(w http.ResponseWriter, r *http.Request, url *database.URL) {
+	comingSoonUrl := url.ComingSoonURL
+	if comingSoonUrl == "" {
+		comingSoonUrl = os.Getenv("UI_COMING_SOON_URL")
+		if parsed, err := neturl.Parse(comingSoonUrl); err == nil && comingSoonUrl != "" {
+			query := parsed.Query()
+			query.Set("activates_at", strconv.FormatInt(int64(url.ActivatesAt), 10))
+			parsed.RawQuery = query.Encode()
+			comingSoonUrl = parsed.String()
+		}
+	}
+	if comingSoonUrl == "" {
+		UnavailableURL(w, r, "scheduled", "")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	http.Redirect(w, r, comingSoonUrl, http.StatusTemporaryRedirect)
+}
+
+// resolveURLFromRequest runs the maintenance and rate limit checks shared by
+// the resolve handlers and looks up the requested short. It writes the response
+// itself and returns nil whenever the request can't go on.
+func (h *Handler) resolveURLFromRequest(w http.ResponseWriter, r *http.Request, rateLimitName string, defaultLimit *helpers.URLLimit) *database.URL {
 	url := &database.URL{}
 	urlExpiredOrNotFound := true
 	var err error
@@ -108,46 +484,48 @@ func ResolveURL(w http.ResponseWriter, r *http.Request) {
 		revalidateCache = false
 	}
 
-	systemNotAvailable := helpers.SystemUnderMaintenance(revalidateCache)
+	systemNotAvailable := h.models.Config.SystemUnderMaintenance(revalidateCache)
 	if systemNotAvailable {
 		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 		http.Redirect(w, r, os.Getenv("FRONTEND_URL_MAINTENANCE"), http.StatusMovedPermanently)
-		return
+		return nil
 	}
 
-	defaultLimit, found := helpers.GetRateConfig(false).Limit["dynamic"]
+	limit, found := h.models.Config.GetRateConfig(false).Limit[rateLimitName]
 	if !found {
-		defaultLimit = &helpers.URLLimit{Value: 100, Expiry: 30}
+		limit = defaultLimit
 	}
-	info, err := helpers.RateLimit(r, "", defaultLimit)
+	info, err := h.models.Config.RateLimit(r, "", limit)
 	if err != nil {
 		helpers.SendJSONError(w, http.StatusTooManyRequests, fmt.Errorf("you have exhausted your quota for %v, %v to retry again", "Resolve URL", helpers.TimeRemaining(info)).Error())
-		return
+		return nil
 	}
 
 	vars := mux.Vars(r)
 	urlShort := vars["short"]
+	domain := h.models.RequestDomain(r.Host)
+	cacheKey := models.URLCacheKey(domain, urlShort)
 	currentTime := time.Now()
 
-	err = helpers.Redis.GetJSON(urlShort, url)
+	err = helpers.Cache.GetJSON(cacheKey, url)
 	if err != nil {
 		fmt.Println(err)
 	}
 
 	if url.ID != primitive.NilObjectID && !revalidateCache {
-		if !currentTime.After(time.Unix(int64(url.Expiry), 0)) {
+		if !urlExpired(url, currentTime) {
 			urlExpiredOrNotFound = false
 		}
 	} else {
-		url, err = models.GetURL(urlShort, "")
+		url, err = h.models.GetDomainURL(domain, urlShort)
 		if err != nil && err != mongo.ErrNoDocuments {
 			helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
-			return
+			return nil
 		}
 
-		if err != mongo.ErrNoDocuments && !currentTime.After(time.Unix(int64(url.Expiry), 0)) {
+		if err != mongo.ErrNoDocuments && !urlExpired(url, currentTime) {
 			urlExpiredOrNotFound = false
-			go helpers.Redis.SetJSON(urlShort, url, time.Until(time.Unix(int64(url.Expiry), 0)))
+			helpers.Background(func() { helpers.Cache.SetJSON(cacheKey, url, models.URLCacheTTL(url, currentTime)) })
 		}
 	}
 
@@ -155,39 +533,168 @@ func ResolveURL(w http.ResponseWriter, r *http.Request) {
 		notFoundUrl := os.Getenv("UI_NOT_FOUND_URL")
 		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 		http.Redirect(w, r, notFoundUrl, http.StatusTemporaryRedirect)
-		return
+		return nil
+	}
+
+	if url.Suspended {
+		UnavailableURL(w, r, "suspended", url.SuspendedReason)
+		return nil
+	}
+	if url.Disabled {
+		UnavailableURL(w, r, "disabled", "")
+		return nil
+	}
+	if url.ActivatesAt > 0 && currentTime.Before(time.Unix(int64(url.ActivatesAt), 0)) {
+		comingSoon(w, r, url)
+		return nil
 	}
 
-	go func(r *http.Request, url database.URL) {
-		userAgent := r.Header.Get("User-Agent")
-		ua := uasurfer.Parse(userAgent)
+	return url
+}
+
+// unlockRedirect is the short url the unlock form posts to and redirects back
+// to, with the query string of the request kept for urls forwarding it.
+func unlockRedirect(r *http.Request, url *database.URL) string {
+	if r.URL.RawQuery == "" {
+		return "/" + url.Short
+	}
+	return "/" + url.Short + "?" + r.URL.RawQuery
+}
+
+func renderUnlockForm(w http.ResponseWriter, r *http.Request, url *database.URL, errorMessage string, status int) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.WriteHeader(status)
+	static.UnlockTemplate.Execute(w, map[string]interface{}{"Action": unlockRedirect(r, url), "Error": errorMessage})
+}
+
+// trackRedirect queues the click event of a redirect when analytics are enabled,
+// rule is the id of the rule which chose the destination and variant the A/B
+// variant the visitor got, if any.
+func trackRedirect(r *http.Request, url database.URL, rule string, variant string) {
+	userAgent := r.Header.Get("User-Agent")
+	ua := uasurfer.Parse(userAgent)
+
+	device := ua.DeviceType.String()
+	ip := helpers.GetUserIP(r)
+	os := ua.OS.Name.String()
+	referrer := r.Header.Get("Referer")
+	urlId := url.ID.Hex()
+
+	if referrer == "" {
+		referrer = "direct"
+	}
+
+	timestamp := time.Now().Unix()
+
+	if helpers.Tracker != nil {
+		helpers.Tracker.CaptureRedirectEvent(device, ip, os, referrer, urlId, rule, variant, timestamp)
+	}
+}
+
+func (h *Handler) ResolveURL(w http.ResponseWriter, r *http.Request) {
+	url := h.resolveURLFromRequest(w, r, "dynamic", &helpers.URLLimit{Value: 100, Expiry: 30})
+	if url == nil {
+		return
+	}
 
-		device := ua.DeviceType.String()
-		ip := strings.Split(r.Header.Get("X-Forwarded-For"), ",")[0]
-		os := ua.OS.Name.String()
-		referrer := r.Header.Get("Referer")
-		urlId := url.ID.Hex()
+	if url.Password != "" && !utils.VerifyUnlockCookie(r, url) {
+		renderUnlockForm(w, r, url, "", http.StatusOK)
+		return
+	}
 
-		if referrer == "" {
-			referrer = "direct"
+	if url.MaxClicks > 0 {
+		claimed, err := h.models.ClaimURLClick(url.ID)
+		if err != nil {
+			helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !claimed {
+			helpers.Background(func() { helpers.Cache.Del(models.URLCacheKey(url.Domain, url.Short)) })
+			NotFound(w, r)
+			return
 		}
+	}
 
-		timestamp := time.Now().Unix()
+	h.models.Visits.Record(url.ID, url.MaxClicks == 0, time.Now())
 
-		if helpers.ENV != string(constants.Prod) {
-			helpers.Tracker.CaptureRedirectEvent(device, ip, os, referrer, urlId, timestamp)
+	country := ""
+	if len(url.GeoRules) > 0 {
+		country = helpers.VisitorCountry(helpers.GetUserIP(r))
+	}
+	destination, rule := helpers.ResolveDestination(url, uasurfer.Parse(r.Header.Get("User-Agent")), country)
+
+	variantId := ""
+	if rule == database.DefaultClickRule && len(url.Variants) > 0 {
+		sticky := ""
+		if url.StickyVariants {
+			sticky = utils.GetVariantCookie(r, url)
+		}
+		if variant := helpers.PickVariant(url.Variants, sticky); variant != nil {
+			destination = variant.Destination
+			variantId = variant.ID
+			if url.StickyVariants {
+				http.SetCookie(w, utils.CreateVariantCookie(url, variantId))
+			}
 		}
+	}
+
+	var forwarded neturl.Values
+	if url.ForwardQuery {
+		forwarded = r.URL.Query()
+	}
+	destination = helpers.BuildDestination(destination, url.UTM, forwarded)
 
-	}(r, *url)
+	clicked := *url
+	helpers.Background(func() { trackRedirect(r, clicked, rule, variantId) })
 
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-	http.Redirect(w, r, url.Destination, http.StatusMovedPermanently)
+	http.Redirect(w, r, destination, http.StatusMovedPermanently)
 }
 
-func GetUserURL(w http.ResponseWriter, r *http.Request) {
+// UnlockURL checks the password submitted from the unlock form of a protected
+// url, and sets a short lived cookie that lets the visitor through ResolveURL.
+func (h *Handler) UnlockURL(w http.ResponseWriter, r *http.Request) {
+	url := h.resolveURLFromRequest(w, r, "unlock", &helpers.URLLimit{Value: 10, Expiry: 30})
+	if url == nil {
+		return
+	}
+
+	if url.Password == "" {
+		http.Redirect(w, r, unlockRedirect(r, url), http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		renderUnlockForm(w, r, url, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if !utils.ComparePassword(url.Password, r.FormValue("password")) {
+		renderUnlockForm(w, r, url, "incorrect password", http.StatusUnauthorized)
+		return
+	}
+
+	http.SetCookie(w, utils.CreateUnlockCookie(url))
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	http.Redirect(w, r, unlockRedirect(r, url), http.StatusSeeOther)
+}
+
+func (h *Handler) GetUserURL(w http.ResponseWriter, r *http.Request) {
 	userData := r.Context().Value(middleware.UserAuthKey).(*database.User)
 
-	urls, err := models.GetUserURL(userData.ID)
+	workspaceId, ok := h.workspaceFromRequest(w, r, userData, database.WorkspaceViewer)
+	if !ok {
+		return
+	}
+
+	var urls []*database.URL
+	var err error
+	if workspaceId == primitive.NilObjectID {
+		urls, err = h.models.GetUserURL(userData.ID)
+	} else {
+		urls, err = h.models.GetWorkspaceURL(workspaceId)
+	}
 	if err != nil && err != mongo.ErrNoDocuments {
 		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
 		return
@@ -202,7 +709,7 @@ func GetUserURL(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(urls)
 }
 
-func UpdateUrl(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) UpdateUrl(w http.ResponseWriter, r *http.Request) {
 	userData := r.Context().Value(middleware.UserAuthKey).(*database.User)
 	vars := mux.Vars(r)
 	urlId := vars["id"]
@@ -213,17 +720,70 @@ func UpdateUrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	url, err := models.GetURL("", urlId)
+	url, err := h.models.GetURL("", urlId)
 	if err != nil {
 		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
+	if !h.authorizeURL(w, userData, url, database.WorkspaceEditor) {
+		return
+	}
+
 	if reqData.CustomShort == "" {
 		reqData.CustomShort = url.Short
 	}
+	rescreen := false
 	if reqData.Destination == "" {
 		reqData.Destination = url.Destination
+	} else if reqData.Destination != url.Destination {
+		if !govalidator.IsURL(reqData.Destination) || !helpers.RemoverDomainError(reqData.Destination) {
+			helpers.SendJSONError(w, http.StatusBadRequest, "invalid url")
+			return
+		}
+		reqData.Destination = helpers.EnforceHTTP(reqData.Destination)
+		rescreen = true
+	}
+
+	if reqData.Targets != nil {
+		if err := helpers.ValidateURLTargets(*reqData.Targets); err != nil {
+			helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		url.Targets = *reqData.Targets
+		rescreen = true
+	}
+
+	if reqData.GeoRules != nil {
+		if err := helpers.ValidateURLGeoRules(*reqData.GeoRules); err != nil {
+			helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		url.GeoRules = *reqData.GeoRules
+		rescreen = true
+	}
+
+	if reqData.Variants != nil {
+		if err := helpers.ValidateURLVariants(*reqData.Variants); err != nil {
+			helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		url.Variants = *reqData.Variants
+		rescreen = true
+	}
+	if reqData.StickyVariants != nil {
+		url.StickyVariants = *reqData.StickyVariants
+	}
+
+	if reqData.UTM != nil {
+		url.UTM, err = helpers.NormalizeURLUTM(reqData.UTM)
+		if err != nil {
+			helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if reqData.ForwardQuery != nil {
+		url.ForwardQuery = *reqData.ForwardQuery
 	}
 
 	var expiry = database.UnixTime(reqData.Expiry)
@@ -231,40 +791,140 @@ func UpdateUrl(w http.ResponseWriter, r *http.Request) {
 		expiry = url.Expiry
 	}
 
-	if err := models.UpdateUserURL(userData.ID, urlId, reqData.CustomShort, reqData.Destination, expiry); err != nil {
+	cachedKey := models.URLCacheKey(url.Domain, url.Short)
+	url.Short = reqData.CustomShort
+	url.Destination = reqData.Destination
+	url.Expiry = expiry
+
+	if reqData.ActivatesAt != nil {
+		if *reqData.ActivatesAt < 0 {
+			helpers.SendJSONError(w, http.StatusBadRequest, "invalid activation time")
+			return
+		}
+		url.ActivatesAt = database.UnixTime(*reqData.ActivatesAt)
+	}
+	comingSoonURL := url.ComingSoonURL
+	if reqData.ComingSoonURL != nil {
+		url.ComingSoonURL = *reqData.ComingSoonURL
+	}
+	url.ComingSoonURL, err = validateActivationWindow(int64(url.ActivatesAt), int64(url.Expiry), url.ComingSoonURL)
+	if err != nil {
 		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	if url.ComingSoonURL != comingSoonURL {
+		rescreen = true
+	}
 
-	go helpers.Redis.Client.Del(context.Background(), url.Short)
+	if rescreen {
+		if err := screenURLDestinations(url); err != nil {
+			helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	if reqData.MaxClicks != nil {
+		if *reqData.MaxClicks < 0 {
+			helpers.SendJSONError(w, http.StatusBadRequest, "invalid max clicks")
+			return
+		}
+		url.MaxClicks = *reqData.MaxClicks
+	}
+
+	if reqData.Active != nil {
+		if *reqData.Active && url.Suspended {
+			helpers.SendJSONError(w, http.StatusForbidden, "url is suspended by an admin and can't be enabled")
+			return
+		}
+		url.Disabled = !*reqData.Active
+	}
+
+	if reqData.Password != nil {
+		url.Password = ""
+		if *reqData.Password != "" {
+			hash, err := utils.HashPassword(*reqData.Password)
+			if err != nil {
+				helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			url.Password = hash
+		}
+	}
+
+	if err := h.models.UpdateURL(urlId, url); err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	helpers.Background(func() { helpers.Cache.Del(cachedKey) })
+	helpers.Background(func() { h.models.DispatchURLEvent(database.WebhookURLUpdated, url) })
 
 	helpers.SetHeaders("PATCH", w, http.StatusNoContent)
 	json.NewEncoder(w).Encode(map[string]string{"message": "successfully updated"})
 }
 
-func DeleteUrl(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) DeleteUrl(w http.ResponseWriter, r *http.Request) {
 	userData := r.Context().Value(middleware.UserAuthKey).(*database.User)
 	vars := mux.Vars(r)
 	urlId := vars["id"]
 
-	url, err := models.GetURL("", urlId)
+	url, err := h.models.GetURL("", urlId)
 	if err != nil {
 		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	if err := models.DeleteURL(userData.ID, urlId); err != nil {
+	if !h.authorizeURL(w, userData, url, database.WorkspaceEditor) {
+		return
+	}
+
+	if err := h.models.DeleteURL(urlId); err != nil {
 		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	go helpers.Redis.Client.Del(context.Background(), url.Short)
+	helpers.Background(func() { helpers.Cache.Del(models.URLCacheKey(url.Domain, url.Short)) })
+	helpers.Background(func() { h.models.DispatchURLEvent(database.WebhookURLDeleted, url) })
 
 	helpers.SetHeaders("DELETE", w, http.StatusNoContent)
 	json.NewEncoder(w).Encode(map[string]string{"message": "successfully deleted"})
 }
 
-func GetURLStats(w http.ResponseWriter, r *http.Request) {
+// GetURLQRCode renders the short url as a PNG or SVG QR code, see helpers.ParseQROptions
+// for the query parameters.
+func (h *Handler) GetURLQRCode(w http.ResponseWriter, r *http.Request) {
+	userData := r.Context().Value(middleware.UserAuthKey).(*database.User)
+	urlId := mux.Vars(r)["id"]
+
+	opts, err := helpers.ParseQROptions(r.URL.Query())
+	if err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	url, err := h.models.GetURL("", urlId)
+	if err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !h.authorizeURL(w, userData, url, database.WorkspaceViewer) {
+		return
+	}
+
+	image, contentType, err := helpers.QRCode(helpers.BuildDomainUrl(url.Domain, "/"+url.Short), opts)
+	if err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.WriteHeader(http.StatusOK)
+	w.Write(image)
+}
+
+func (h *Handler) GetURLStats(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	urlId := vars["id"]
 	userData := r.Context().Value(middleware.UserAuthKey).(*database.User)
@@ -294,23 +954,51 @@ func GetURLStats(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	url, err := models.GetURL("", urlId)
+	interval := r.URL.Query().Get("interval")
+	if _, found := timescale.ClickSeriesIntervals[interval]; interval != "" && !found {
+		helpers.SendJSONError(w, http.StatusBadRequest, "invalid interval, use hour, day or week")
+		return
+	}
+
+	url, err := h.models.GetURL("", urlId)
 	if err != nil || url == nil {
 		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	if url.User.Hex() != userData.ID.Hex() {
-		helpers.SendJSONError(w, http.StatusUnauthorized, "unauthorized")
+	if !h.authorizeURL(w, userData, url, database.WorkspaceViewer) {
+		return
+	}
+
+	if helpers.Tracker == nil {
+		helpers.SendJSONError(w, http.StatusServiceUnavailable, "analytics is disabled")
 		return
 	}
 
 	stats, err := timescale.QueryClickEvents(urlId, startTime, endTime)
+	if err == timescale.ErrNotConnected {
+		helpers.SendJSONError(w, http.StatusServiceUnavailable, "analytics is unavailable")
+		return
+	}
 	if err != nil {
 		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
+	data := map[string]interface{}{}
+	for name, counts := range *stats {
+		data[name] = counts
+	}
+
+	if interval != "" {
+		series, err := timescale.QueryClickSeries(urlId, startTime, endTime, interval)
+		if err != nil {
+			helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		data["click_series"] = series
+	}
+
 	helpers.SetHeaders("GET", w, http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{"message": "successfully updated", "data": stats})
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "successfully updated", "data": data})
 }
@@ -9,7 +9,6 @@ import (
 
 	"github.com/ivinayakg/shorte.live/api/helpers"
 	"github.com/ivinayakg/shorte.live/api/middleware"
-	"github.com/ivinayakg/shorte.live/api/models"
 	"github.com/ivinayakg/shorte.live/api/utils"
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -26,7 +25,7 @@ func SignInWithGoogle(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, url, http.StatusFound)
 }
 
-func CallbackSignInWithGoogle(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) CallbackSignInWithGoogle(w http.ResponseWriter, r *http.Request) {
 	defer func() {
 		if r := recover(); r != nil {
 			fmt.Println("Recovered from panic:", r)
@@ -91,7 +90,7 @@ func CallbackSignInWithGoogle(w http.ResponseWriter, r *http.Request) {
 	fmt.Println(googleProfile)
 
 	// Assuming User, UserSerializer, and other settings are defined elsewhere
-	user, err := models.GetUser(googleProfile["email"].(string))
+	user, err := h.models.GetUser(googleProfile["email"].(string))
 	if err != nil && err != mongo.ErrNoDocuments {
 		helpers.SendJSONError(w, http.StatusInternalServerError, "Internal Server Error")
 		return
@@ -102,7 +101,7 @@ func CallbackSignInWithGoogle(w http.ResponseWriter, r *http.Request) {
 	if user != nil {
 		token, _ = utils.CreateJWT(user)
 	} else {
-		user, err = models.CreateUser(googleProfile["email"].(string), googleProfile["name"].(string), googleProfile["picture"].(string))
+		user, err = h.models.CreateUser(googleProfile["email"].(string), googleProfile["name"].(string), googleProfile["picture"].(string))
 		if err != nil {
 			helpers.SendJSONError(w, http.StatusInternalServerError, "Internal Server Error")
 			return
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/gorilla/mux"
+	"github.com/ivinayakg/shorte.live/api/database"
+	"github.com/ivinayakg/shorte.live/api/helpers"
+	"github.com/ivinayakg/shorte.live/api/middleware"
+)
+
+type CreateWebhookRequest struct {
+	URL string `json:"url"`
+	// Events default to every event when empty
+	Events []database.WebhookEvent `json:"events"`
+}
+
+type CreateWebhookResponse struct {
+	// Secret signs the payloads, it's only returned once
+	Secret string `json:"secret"`
+	*database.Webhook
+}
+
+func validWebhookEvent(event database.WebhookEvent) bool {
+	for _, e := range database.WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func validWebhookURL(url string) bool {
+	if !govalidator.IsURL(url) {
+		return false
+	}
+	parsed, err := neturl.Parse(url)
+	if err != nil {
+		return false
+	}
+	if parsed.Scheme != "https" && parsed.Scheme != "http" {
+		return false
+	}
+	// hostnames resolving to private addresses are refused by the dispatcher's dialer
+	return helpers.AllowPrivateNetworks || !helpers.IsPrivateHost(parsed.Host)
+}
+
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	userData := r.Context().Value(middleware.UserAuthKey).(*database.User)
+	body := new(CreateWebhookRequest)
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !validWebhookURL(body.URL) {
+		helpers.SendJSONError(w, http.StatusBadRequest, "invalid webhook url")
+		return
+	}
+
+	if len(body.Events) == 0 {
+		body.Events = database.WebhookEvents
+	}
+	for _, event := range body.Events {
+		if !validWebhookEvent(event) {
+			helpers.SendJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid event %v", event))
+			return
+		}
+	}
+
+	wh, err := h.models.CreateWebhook(userData, body.URL, body.Events)
+	if err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	helpers.SetHeaders("post", w, http.StatusCreated)
+	json.NewEncoder(w).Encode(CreateWebhookResponse{Secret: wh.Secret, Webhook: wh})
+}
+
+func (h *Handler) GetUserWebhooks(w http.ResponseWriter, r *http.Request) {
+	userData := r.Context().Value(middleware.UserAuthKey).(*database.User)
+
+	webhooks, err := h.models.GetUserWebhooks(userData.ID)
+	if err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	helpers.SetHeaders("GET", w, http.StatusOK)
+	json.NewEncoder(w).Encode(webhooks)
+}
+
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	userData := r.Context().Value(middleware.UserAuthKey).(*database.User)
+
+	if err := h.models.DeleteWebhook(userData.ID, mux.Vars(r)["id"]); err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	helpers.SetHeaders("DELETE", w, http.StatusNoContent)
+	json.NewEncoder(w).Encode(map[string]string{"message": "successfully deleted"})
+}
+
+// GetWebhookDeliveries lists the latest deliveries of the webhook with their status.
+func (h *Handler) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	userData := r.Context().Value(middleware.UserAuthKey).(*database.User)
+
+	deliveries, err := h.models.GetWebhookDeliveries(userData.ID, mux.Vars(r)["id"])
+	if err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	helpers.SetHeaders("GET", w, http.StatusOK)
+	json.NewEncoder(w).Encode(deliveries)
+}
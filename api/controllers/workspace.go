@@ -0,0 +1,281 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/ivinayakg/shorte.live/api/database"
+	"github.com/ivinayakg/shorte.live/api/helpers"
+	"github.com/ivinayakg/shorte.live/api/middleware"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type CreateWorkspaceRequest struct {
+	Name string `json:"name"`
+}
+
+type WorkspaceInviteRequest struct {
+	Email string                 `json:"email"`
+	Role  database.WorkspaceRole `json:"role"`
+}
+
+type WorkspaceMemberRequest struct {
+	Role database.WorkspaceRole `json:"role"`
+}
+
+// authorizeWorkspace loads the workspace with id and checks the user has at least
+// the required role in it. It writes the response itself and returns nil on failure.
+func (h *Handler) authorizeWorkspace(w http.ResponseWriter, userData *database.User, id string, required database.WorkspaceRole) *database.Workspace {
+	ws, err := h.models.GetWorkspace(id)
+	if err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return nil
+	}
+
+	role := ws.MemberRole(userData.ID)
+	if role == "" {
+		helpers.SendJSONError(w, http.StatusBadRequest, mongo.ErrNoDocuments.Error())
+		return nil
+	}
+	if !role.Allows(required) {
+		helpers.SendJSONError(w, http.StatusForbidden, "insufficient workspace role")
+		return nil
+	}
+	return ws
+}
+
+// workspaceFromRequest reads the optional workspace query parameter of the url
+// routes, the zero id stands for the user's personal links.
+func (h *Handler) workspaceFromRequest(w http.ResponseWriter, r *http.Request, userData *database.User, required database.WorkspaceRole) (primitive.ObjectID, bool) {
+	id := r.URL.Query().Get("workspace")
+	if id == "" {
+		return primitive.NilObjectID, true
+	}
+
+	ws := h.authorizeWorkspace(w, userData, id, required)
+	if ws == nil {
+		return primitive.NilObjectID, false
+	}
+	return ws.ID, true
+}
+
+// authorizeURL checks the user has at least the required role on the url, through
+// its workspace or by owning a personal url. It writes the response itself and
+// returns false on failure.
+func (h *Handler) authorizeURL(w http.ResponseWriter, userData *database.User, url *database.URL, required database.WorkspaceRole) bool {
+	role, err := h.models.URLRole(userData, url)
+	if err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	if role == "" {
+		helpers.SendJSONError(w, http.StatusBadRequest, "URL document not found")
+		return false
+	}
+	if !role.Allows(required) {
+		helpers.SendJSONError(w, http.StatusForbidden, "insufficient workspace role")
+		return false
+	}
+	return true
+}
+
+func (h *Handler) CreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	userData := r.Context().Value(middleware.UserAuthKey).(*database.User)
+	body := new(CreateWorkspaceRequest)
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		helpers.SendJSONError(w, http.StatusBadRequest, "workspace name is required")
+		return
+	}
+
+	ws, err := h.models.CreateWorkspace(userData, body.Name)
+	if err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	helpers.SetHeaders("post", w, http.StatusCreated)
+	json.NewEncoder(w).Encode(ws)
+}
+
+func (h *Handler) GetUserWorkspaces(w http.ResponseWriter, r *http.Request) {
+	userData := r.Context().Value(middleware.UserAuthKey).(*database.User)
+
+	workspaces, err := h.models.GetUserWorkspaces(userData.ID)
+	if err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	helpers.SetHeaders("GET", w, http.StatusOK)
+	json.NewEncoder(w).Encode(workspaces)
+}
+
+// GetWorkspaceInvites lists the workspaces the user has a pending invite to.
+func (h *Handler) GetWorkspaceInvites(w http.ResponseWriter, r *http.Request) {
+	userData := r.Context().Value(middleware.UserAuthKey).(*database.User)
+
+	workspaces, err := h.models.GetInvitedWorkspaces(userData.Email)
+	if err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	invites := []map[string]interface{}{}
+	for _, ws := range workspaces {
+		invite := ws.Invite(userData.Email)
+		invites = append(invites, map[string]interface{}{"workspace": ws.ID, "name": ws.Name, "role": invite.Role, "invited_by": invite.InvitedBy, "created_at": invite.CreatedAt})
+	}
+
+	helpers.SetHeaders("GET", w, http.StatusOK)
+	json.NewEncoder(w).Encode(invites)
+}
+
+func (h *Handler) InviteToWorkspace(w http.ResponseWriter, r *http.Request) {
+	userData := r.Context().Value(middleware.UserAuthKey).(*database.User)
+	body := new(WorkspaceInviteRequest)
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if body.Role == "" {
+		body.Role = database.WorkspaceViewer
+	}
+	if !body.Role.Valid() {
+		helpers.SendJSONError(w, http.StatusBadRequest, "invalid role, use owner, editor or viewer")
+		return
+	}
+
+	ws := h.authorizeWorkspace(w, userData, mux.Vars(r)["id"], database.WorkspaceOwner)
+	if ws == nil {
+		return
+	}
+
+	if err := h.models.InviteToWorkspace(ws, userData, strings.TrimSpace(body.Email), body.Role); err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	helpers.SetHeaders("post", w, http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"message": "successfully invited"})
+}
+
+func (h *Handler) AcceptWorkspaceInvite(w http.ResponseWriter, r *http.Request) {
+	userData := r.Context().Value(middleware.UserAuthKey).(*database.User)
+
+	ws, err := h.models.GetWorkspace(mux.Vars(r)["id"])
+	if err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.models.AcceptWorkspaceInvite(ws, userData); err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	helpers.SetHeaders("post", w, http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "successfully joined"})
+}
+
+// RemoveWorkspaceInvite lets owners revoke an invite and invitees decline their own.
+func (h *Handler) RemoveWorkspaceInvite(w http.ResponseWriter, r *http.Request) {
+	userData := r.Context().Value(middleware.UserAuthKey).(*database.User)
+	vars := mux.Vars(r)
+
+	ws, err := h.models.GetWorkspace(vars["id"])
+	if err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	email := vars["email"]
+	if email != userData.Email && !ws.MemberRole(userData.ID).Allows(database.WorkspaceOwner) {
+		helpers.SendJSONError(w, http.StatusForbidden, "insufficient workspace role")
+		return
+	}
+
+	if err := h.models.RemoveWorkspaceInvite(ws, email); err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	helpers.SetHeaders("DELETE", w, http.StatusNoContent)
+	json.NewEncoder(w).Encode(map[string]string{"message": "successfully deleted"})
+}
+
+func (h *Handler) UpdateWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	userData := r.Context().Value(middleware.UserAuthKey).(*database.User)
+	vars := mux.Vars(r)
+	body := new(WorkspaceMemberRequest)
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !body.Role.Valid() {
+		helpers.SendJSONError(w, http.StatusBadRequest, "invalid role, use owner, editor or viewer")
+		return
+	}
+
+	memberId, err := primitive.ObjectIDFromHex(vars["user"])
+	if err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ws := h.authorizeWorkspace(w, userData, vars["id"], database.WorkspaceOwner)
+	if ws == nil {
+		return
+	}
+
+	if err := h.models.SetWorkspaceMemberRole(ws, memberId, body.Role); err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	helpers.SetHeaders("PATCH", w, http.StatusNoContent)
+	json.NewEncoder(w).Encode(map[string]string{"message": "successfully updated"})
+}
+
+// RemoveWorkspaceMember lets owners remove members and members leave the workspace.
+func (h *Handler) RemoveWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	userData := r.Context().Value(middleware.UserAuthKey).(*database.User)
+	vars := mux.Vars(r)
+
+	memberId, err := primitive.ObjectIDFromHex(vars["user"])
+	if err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	required := database.WorkspaceOwner
+	if memberId == userData.ID {
+		required = database.WorkspaceViewer
+	}
+
+	ws := h.authorizeWorkspace(w, userData, vars["id"], required)
+	if ws == nil {
+		return
+	}
+
+	if err := h.models.RemoveWorkspaceMember(ws, memberId); err != nil {
+		helpers.SendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	helpers.SetHeaders("DELETE", w, http.StatusNoContent)
+	json.NewEncoder(w).Encode(map[string]string{"message": "successfully deleted"})
+}
@@ -15,12 +15,24 @@ type DB struct {
 	User *mongo.Collection
 	Url  *mongo.Collection
 	// RedirectEvent *mongo.Collection
-	Config *mongo.Collection
+	Config    *mongo.Collection
+	Workspace *mongo.Collection
+	APIKey    *mongo.Collection
+	Domain    *mongo.Collection
+	Webhook   *mongo.Collection
+	// WebhookDelivery is the delivery log, pending deliveries double as the retry queue
+	WebhookDelivery *mongo.Collection
+	Client          *mongo.Client
 }
 
 type DBIndexName string
 
+// UrlShortIndexName is the old global short index, shorts are unique per domain now
 const UrlShortIndexName DBIndexName = "url_short_index_1"
+const UrlDomainShortIndexName DBIndexName = "url_domain_short_index_1"
+const DomainVerifiedHostIndexName DBIndexName = "domain_verified_host_index_1"
+const WebhookDeliveryDueIndexName DBIndexName = "webhook_delivery_due_index_1"
+const APIKeyHashIndexName DBIndexName = "api_key_hash_index_1"
 
 func DoesIndexExist(ctx context.Context, collection *mongo.Collection, indexName string) (bool, error) {
 	cursor, err := collection.Indexes().List(ctx)
@@ -45,28 +57,30 @@ func DoesIndexExist(ctx context.Context, collection *mongo.Collection, indexName
 	return false, nil
 }
 
-var CurrentDb *DB
-var DBClient *mongo.Client
-
-func CreateDBInstance() {
+func CreateDBInstance() *DB {
 	connectionString := os.Getenv("DB_URL")
 	dbName := os.Getenv("DB_NAME")
 	userCollName := os.Getenv("DB_USER_COLLECTION_NAME")
 	urlCollName := os.Getenv("DB_URL_COLLECTION_NAME")
 	// redirectEventCollName := os.Getenv("DB_REDIRECT_EVENT_COLLECTION_NAME")
 	configCollName := os.Getenv("DB_CONFIG_COLLECTION_NAME")
+	workspaceCollName := os.Getenv("DB_WORKSPACE_COLLECTION_NAME")
+	apiKeyCollName := os.Getenv("DB_API_KEY_COLLECTION_NAME")
+	domainCollName := os.Getenv("DB_DOMAIN_COLLECTION_NAME")
+	webhookCollName := os.Getenv("DB_WEBHOOK_COLLECTION_NAME")
+	webhookDeliveryCollName := os.Getenv("DB_WEBHOOK_DELIVERY_COLLECTION_NAME")
 	clientOptions := options.Client().ApplyURI(connectionString)
 
 	client, err := mongo.Connect(context.TODO(), clientOptions)
 	if err != nil {
 		log.Fatalf("Error connecting to MongoDB: %v", err)
-		return
+		return nil
 	}
 
 	err = client.Ping(context.TODO(), nil)
 	if err != nil {
 		log.Fatalf("Error pinging MongoDB: %v", err)
-		return
+		return nil
 	}
 
 	fmt.Println("Connected to MongoDB")
@@ -75,17 +89,22 @@ func CreateDBInstance() {
 	urlCollection := client.Database(dbName).Collection(urlCollName)
 	// redirectEventCollection := client.Database(dbName).Collection(redirectEventCollName)
 	configCollection := client.Database(dbName).Collection(configCollName)
+	workspaceCollection := client.Database(dbName).Collection(workspaceCollName)
+	apiKeyCollection := client.Database(dbName).Collection(apiKeyCollName)
+	domainCollection := client.Database(dbName).Collection(domainCollName)
+	webhookCollection := client.Database(dbName).Collection(webhookCollName)
+	webhookDeliveryCollection := client.Database(dbName).Collection(webhookDeliveryCollName)
 
-	urlShortIndex, err := DoesIndexExist(context.Background(), urlCollection, string(UrlShortIndexName))
+	urlDomainShortIndex, err := DoesIndexExist(context.Background(), urlCollection, string(UrlDomainShortIndexName))
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	if !urlShortIndex {
+	if !urlDomainShortIndex {
 		// Create the index
 		indexModel := mongo.IndexModel{
-			Keys:    bson.M{"short": 1},
-			Options: options.Index().SetUnique(true).SetName(string(UrlShortIndexName)),
+			Keys:    bson.D{{Key: "domain", Value: 1}, {Key: "short", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName(string(UrlDomainShortIndexName)),
 		}
 
 		_, err := urlCollection.Indexes().CreateOne(context.Background(), indexModel)
@@ -93,11 +112,83 @@ func CreateDBInstance() {
 			log.Fatal(err)
 		}
 
-		fmt.Println("URL Short Index created successfully.")
+		fmt.Println("URL Domain Short Index created successfully.")
 	} else {
-		fmt.Println("URL Short Index already exists.")
+		fmt.Println("URL Domain Short Index already exists.")
+	}
+
+	urlShortIndex, err := DoesIndexExist(context.Background(), urlCollection, string(UrlShortIndexName))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if urlShortIndex {
+		// the global index would stop the same short from being used on another domain,
+		// it's only dropped once the domain index exists so shorts stay unique meanwhile
+		if _, err := urlCollection.Indexes().DropOne(context.Background(), string(UrlShortIndexName)); err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Println("URL Short Index dropped successfully.")
+	}
+
+	apiKeyHashIndex, err := DoesIndexExist(context.Background(), apiKeyCollection, string(APIKeyHashIndexName))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if !apiKeyHashIndex {
+		indexModel := mongo.IndexModel{
+			Keys:    bson.M{"hash": 1},
+			Options: options.Index().SetUnique(true).SetName(string(APIKeyHashIndexName)),
+		}
+
+		_, err := apiKeyCollection.Indexes().CreateOne(context.Background(), indexModel)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Println("API Key Hash Index created successfully.")
+	}
+
+	domainHostIndex, err := DoesIndexExist(context.Background(), domainCollection, string(DomainVerifiedHostIndexName))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if !domainHostIndex {
+		// any user may register a host but only one of them can verify it
+		indexModel := mongo.IndexModel{
+			Keys:    bson.M{"host": 1},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"verified": true}).SetName(string(DomainVerifiedHostIndexName)),
+		}
+
+		_, err := domainCollection.Indexes().CreateOne(context.Background(), indexModel)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Println("Domain Verified Host Index created successfully.")
+	}
+
+	webhookDeliveryDueIndex, err := DoesIndexExist(context.Background(), webhookDeliveryCollection, string(WebhookDeliveryDueIndexName))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if !webhookDeliveryDueIndex {
+		indexModel := mongo.IndexModel{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "next_attempt", Value: 1}},
+			Options: options.Index().SetName(string(WebhookDeliveryDueIndexName)),
+		}
+
+		_, err := webhookDeliveryCollection.Indexes().CreateOne(context.Background(), indexModel)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Println("Webhook Delivery Due Index created successfully.")
 	}
 
-	CurrentDb = &DB{User: userCollection, Url: urlCollection, Config: configCollection}
-	DBClient = client
+	return &DB{User: userCollection, Url: urlCollection, Config: configCollection, Workspace: workspaceCollection, APIKey: apiKeyCollection, Domain: domainCollection, Webhook: webhookCollection, WebhookDelivery: webhookDeliveryCollection, Client: client}
 }
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type memoryAPIKeyStore struct {
+	mutex sync.RWMutex
+	keys  []*APIKey
+}
+
+func cloneAPIKey(key *APIKey) *APIKey {
+	clone := new(APIKey)
+	if err := cloneDoc(key, clone); err != nil {
+		panic(err)
+	}
+	return clone
+}
+
+func (s *memoryAPIKeyStore) Insert(key *APIKey) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if key.ID == primitive.NilObjectID {
+		key.ID = primitive.NewObjectID()
+	}
+	s.keys = append(s.keys, cloneAPIKey(key))
+	return nil
+}
+
+func (s *memoryAPIKeyStore) FindByHash(hash string) (*APIKey, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, key := range s.keys {
+		if key.Hash == hash {
+			return cloneAPIKey(key), nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (s *memoryAPIKeyStore) FindByUser(user primitive.ObjectID) ([]*APIKey, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	results := []*APIKey{}
+	for _, key := range s.keys {
+		if key.User == user {
+			results = append(results, cloneAPIKey(key))
+		}
+	}
+	return results, nil
+}
+
+func (s *memoryAPIKeyStore) Delete(id primitive.ObjectID, user primitive.ObjectID) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, key := range s.keys {
+		if key.ID == id && key.User == user {
+			s.keys = append(s.keys[:i:i], s.keys[i+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (s *memoryAPIKeyStore) SetLastUsed(id primitive.ObjectID, lastUsed UnixTime) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, key := range s.keys {
+		if key.ID == id && lastUsed > key.LastUsed {
+			key.LastUsed = lastUsed
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type memoryDomainStore struct {
+	mutex   sync.RWMutex
+	domains []*Domain
+}
+
+func cloneDomain(domain *Domain) *Domain {
+	clone := new(Domain)
+	if err := cloneDoc(domain, clone); err != nil {
+		panic(err)
+	}
+	return clone
+}
+
+func (filter DomainFilter) matches(domain *Domain) bool {
+	if filter.ID != primitive.NilObjectID && filter.ID != domain.ID {
+		return false
+	}
+	if filter.User != primitive.NilObjectID && filter.User != domain.User {
+		return false
+	}
+	if filter.Host != "" && filter.Host != domain.Host {
+		return false
+	}
+	if filter.Verified && !domain.Verified {
+		return false
+	}
+	return true
+}
+
+func (s *memoryDomainStore) Insert(domain *Domain) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if domain.ID == primitive.NilObjectID {
+		domain.ID = primitive.NewObjectID()
+	}
+	s.domains = append(s.domains, cloneDomain(domain))
+	return nil
+}
+
+func (s *memoryDomainStore) FindOne(filter DomainFilter) (*Domain, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, domain := range s.domains {
+		if filter.matches(domain) {
+			return cloneDomain(domain), nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (s *memoryDomainStore) Find(filter DomainFilter) ([]*Domain, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	results := []*Domain{}
+	for _, domain := range s.domains {
+		if filter.matches(domain) {
+			results = append(results, cloneDomain(domain))
+		}
+	}
+	return results, nil
+}
+
+func (s *memoryDomainStore) SetVerified(id primitive.ObjectID, verifiedAt UnixTime) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var target *Domain
+	for _, domain := range s.domains {
+		if domain.ID == id {
+			target = domain
+		}
+	}
+	if target == nil {
+		return false, nil
+	}
+
+	for _, domain := range s.domains {
+		if domain.ID != id && domain.Verified && domain.Host == target.Host {
+			return false, ErrDomainTaken
+		}
+	}
+
+	target.Verified = true
+	target.VerifiedAt = verifiedAt
+	return true, nil
+}
+
+func (s *memoryDomainStore) Delete(id primitive.ObjectID, user primitive.ObjectID) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, domain := range s.domains {
+		if domain.ID == id && domain.User == user {
+			s.domains = append(s.domains[:i:i], s.domains[i+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,358 @@
+package database
+
+import (
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// memoryURLStore keeps urls in insertion order, documents are copied in and
+// out through bson so callers never share state with the store.
+type memoryURLStore struct {
+	mutex sync.RWMutex
+	urls  []*URL
+}
+
+type memoryUserStore struct {
+	mutex sync.RWMutex
+	users []*User
+}
+
+type memoryConfigStore struct {
+	mutex   sync.RWMutex
+	configs map[string]bson.Raw
+}
+
+func NewMemoryStore() *Store {
+	return &Store{
+		URL:       &memoryURLStore{},
+		User:      &memoryUserStore{},
+		Config:    &memoryConfigStore{configs: map[string]bson.Raw{}},
+		Workspace: &memoryWorkspaceStore{},
+		APIKey:    &memoryAPIKeyStore{},
+		Domain:    &memoryDomainStore{},
+		Webhook:   &memoryWebhookStore{},
+	}
+}
+
+func cloneDoc(src interface{}, dest interface{}) error {
+	p, err := bson.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(p, dest)
+}
+
+func cloneURL(url *URL) *URL {
+	clone := new(URL)
+	if err := cloneDoc(url, clone); err != nil {
+		panic(err)
+	}
+	return clone
+}
+
+func (filter URLFilter) matches(url *URL) bool {
+	if filter.ID != primitive.NilObjectID && filter.ID != url.ID {
+		return false
+	}
+	if filter.User != primitive.NilObjectID && filter.User != url.User {
+		return false
+	}
+	if filter.Short != "" && filter.Short != url.Short {
+		return false
+	}
+	if (filter.Domain != "" || filter.Short != "" || filter.Shorts != nil) && filter.Domain != url.Domain {
+		return false
+	}
+	if filter.Workspace != primitive.NilObjectID && filter.Workspace != url.Workspace {
+		return false
+	}
+	if filter.Personal && url.Workspace != primitive.NilObjectID {
+		return false
+	}
+	if filter.Flagged && url.Screening == nil {
+		return false
+	}
+	if filter.ExpiredAfter != 0 && url.Expiry <= filter.ExpiredAfter {
+		return false
+	}
+	if filter.ExpiredBefore != 0 && url.Expiry > filter.ExpiredBefore {
+		return false
+	}
+	if filter.ExpiryUnnotified && url.ExpiryNotified {
+		return false
+	}
+	if filter.Shorts != nil {
+		found := false
+		for _, short := range filter.Shorts {
+			if short == url.Short {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *memoryURLStore) shortTaken(domain string, short string, except primitive.ObjectID) bool {
+	for _, url := range s.urls {
+		if url.Domain == domain && url.Short == short && url.ID != except {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memoryURLStore) insert(url *URL) error {
+	if s.shortTaken(url.Domain, url.Short, primitive.NilObjectID) {
+		return ErrDuplicateShort
+	}
+	if url.ID == primitive.NilObjectID {
+		url.ID = primitive.NewObjectID()
+	}
+	s.urls = append(s.urls, cloneURL(url))
+	return nil
+}
+
+func (s *memoryURLStore) Insert(url *URL) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.insert(url)
+}
+
+func (s *memoryURLStore) InsertMany(urls []*URL) []error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	errs := make([]error, len(urls))
+	for i, url := range urls {
+		errs[i] = s.insert(url)
+	}
+	return errs
+}
+
+func (s *memoryURLStore) FindOne(filter URLFilter) (*URL, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, url := range s.urls {
+		if filter.matches(url) {
+			return cloneURL(url), nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (s *memoryURLStore) Find(filter URLFilter) ([]*URL, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var results []*URL
+	for _, url := range s.urls {
+		if filter.matches(url) {
+			results = append(results, cloneURL(url))
+		}
+	}
+	return results, nil
+}
+
+func (s *memoryURLStore) FindBatches(filter URLFilter, size int, fn func(urls []*URL) error) error {
+	// fn runs without the lock, it may update the urls it gets
+	urls, _ := s.Find(filter)
+	for start := 0; start < len(urls); start += size {
+		end := start + size
+		if end > len(urls) {
+			end = len(urls)
+		}
+		if err := fn(urls[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memoryURLStore) Update(filter URLFilter, set map[string]interface{}) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, url := range s.urls {
+		if !filter.matches(url) {
+			continue
+		}
+
+		doc := bson.M{}
+		if err := cloneDoc(url, &doc); err != nil {
+			return 0, err
+		}
+		for key, value := range set {
+			doc[key] = value
+		}
+
+		updated := new(URL)
+		if err := cloneDoc(doc, updated); err != nil {
+			return 0, err
+		}
+		if s.shortTaken(updated.Domain, updated.Short, updated.ID) {
+			return 0, ErrDuplicateShort
+		}
+
+		s.urls[i] = updated
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (s *memoryURLStore) Delete(filter URLFilter) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, url := range s.urls {
+		if filter.matches(url) {
+			s.urls = append(s.urls[:i], s.urls[i+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (s *memoryURLStore) DeleteMany(filter URLFilter) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	kept := s.urls[:0]
+	for _, url := range s.urls {
+		if !filter.matches(url) {
+			kept = append(kept, url)
+		}
+	}
+	deleted := int64(len(s.urls) - len(kept))
+	s.urls = kept
+	return deleted, nil
+}
+
+func (s *memoryURLStore) ClaimClick(id primitive.ObjectID) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, url := range s.urls {
+		if url.ID == id {
+			if url.TotalClicks >= url.MaxClicks {
+				return false, nil
+			}
+			url.TotalClicks += 1
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *memoryURLStore) ClaimExpiryNotification(id primitive.ObjectID) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, url := range s.urls {
+		if url.ID == id {
+			if url.ExpiryNotified {
+				return false, nil
+			}
+			url.ExpiryNotified = true
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *memoryURLStore) RecordVisits(visits map[primitive.ObjectID]*URLVisits) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, url := range s.urls {
+		visit, found := visits[url.ID]
+		if !found {
+			continue
+		}
+		url.TotalClicks += visit.Clicks
+		if visit.LastVisited > url.LastVisited {
+			url.LastVisited = visit.LastVisited
+		}
+	}
+	return nil
+}
+
+func (s *memoryUserStore) Insert(user *User) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if user.ID == primitive.NilObjectID {
+		user.ID = primitive.NewObjectID()
+	}
+	clone := *user
+	s.users = append(s.users, &clone)
+	return nil
+}
+
+func (s *memoryUserStore) FindByEmail(email string) (*User, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, user := range s.users {
+		if user.Email == email {
+			clone := *user
+			return &clone, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (s *memoryUserStore) FindByID(id primitive.ObjectID) (*User, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, user := range s.users {
+		if user.ID == id {
+			clone := *user
+			return &clone, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (s *memoryConfigStore) FindByName(name string, dest interface{}) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	config, found := s.configs[name]
+	if !found {
+		return mongo.ErrNoDocuments
+	}
+	return bson.Unmarshal(config, dest)
+}
+
+func (s *memoryConfigStore) Insert(config interface{}) (primitive.ObjectID, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	doc := bson.M{}
+	if err := cloneDoc(config, &doc); err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	id, ok := doc["_id"].(primitive.ObjectID)
+	if !ok {
+		id = primitive.NewObjectID()
+		doc["_id"] = id
+	}
+
+	name, _ := doc["name"].(string)
+	p, err := bson.Marshal(doc)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	s.configs[name] = p
+	return id, nil
+}
@@ -0,0 +1,147 @@
+package database
+
+import (
+	"sort"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryWebhookStore struct {
+	mutex      sync.RWMutex
+	webhooks   []*Webhook
+	deliveries []*WebhookDelivery
+}
+
+func cloneWebhook(wh *Webhook) *Webhook {
+	clone := new(Webhook)
+	if err := cloneDoc(wh, clone); err != nil {
+		panic(err)
+	}
+	return clone
+}
+
+func cloneWebhookDelivery(delivery *WebhookDelivery) *WebhookDelivery {
+	clone := new(WebhookDelivery)
+	if err := cloneDoc(delivery, clone); err != nil {
+		panic(err)
+	}
+	return clone
+}
+
+func (filter WebhookFilter) matches(wh *Webhook) bool {
+	if filter.ID != primitive.NilObjectID && filter.ID != wh.ID {
+		return false
+	}
+	if filter.User != primitive.NilObjectID && filter.User != wh.User {
+		return false
+	}
+	if filter.Event != "" && !wh.Subscribed(filter.Event) {
+		return false
+	}
+	return true
+}
+
+func (s *memoryWebhookStore) Insert(wh *Webhook) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if wh.ID == primitive.NilObjectID {
+		wh.ID = primitive.NewObjectID()
+	}
+	s.webhooks = append(s.webhooks, cloneWebhook(wh))
+	return nil
+}
+
+func (s *memoryWebhookStore) Find(filter WebhookFilter) ([]*Webhook, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	results := []*Webhook{}
+	for _, wh := range s.webhooks {
+		if filter.matches(wh) {
+			results = append(results, cloneWebhook(wh))
+		}
+	}
+	return results, nil
+}
+
+func (s *memoryWebhookStore) Delete(id primitive.ObjectID, user primitive.ObjectID) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, wh := range s.webhooks {
+		if wh.ID == id && wh.User == user {
+			s.webhooks = append(s.webhooks[:i:i], s.webhooks[i+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (s *memoryWebhookStore) InsertDelivery(delivery *WebhookDelivery) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if delivery.ID == primitive.NilObjectID {
+		delivery.ID = primitive.NewObjectID()
+	}
+	s.deliveries = append(s.deliveries, cloneWebhookDelivery(delivery))
+	return nil
+}
+
+func (s *memoryWebhookStore) UpdateDelivery(delivery *WebhookDelivery) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, d := range s.deliveries {
+		if d.ID == delivery.ID {
+			s.deliveries[i] = cloneWebhookDelivery(delivery)
+		}
+	}
+	return nil
+}
+
+func (s *memoryWebhookStore) FindDeliveries(webhook primitive.ObjectID, limit int64) ([]*WebhookDelivery, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	results := []*WebhookDelivery{}
+	for i := len(s.deliveries) - 1; i >= 0 && int64(len(results)) < limit; i-- {
+		if s.deliveries[i].Webhook == webhook {
+			results = append(results, cloneWebhookDelivery(s.deliveries[i]))
+		}
+	}
+	return results, nil
+}
+
+func (s *memoryWebhookStore) DueDeliveries(now UnixTime, limit int64) ([]*WebhookDelivery, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	results := []*WebhookDelivery{}
+	for _, d := range s.deliveries {
+		if d.Status == WebhookDeliveryPending && d.NextAttempt <= now {
+			results = append(results, cloneWebhookDelivery(d))
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].NextAttempt < results[j].NextAttempt })
+	if int64(len(results)) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func (s *memoryWebhookStore) ClaimDelivery(delivery *WebhookDelivery, leaseUntil UnixTime) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, d := range s.deliveries {
+		if d.ID == delivery.ID && d.Status == WebhookDeliveryPending && d.NextAttempt == delivery.NextAttempt {
+			d.NextAttempt = leaseUntil
+			delivery.NextAttempt = leaseUntil
+			return true, nil
+		}
+	}
+	return false, nil
+}
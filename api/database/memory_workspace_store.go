@@ -0,0 +1,143 @@
+package database
+
+import (
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type memoryWorkspaceStore struct {
+	mutex      sync.RWMutex
+	workspaces []*Workspace
+}
+
+func cloneWorkspace(ws *Workspace) *Workspace {
+	clone := new(Workspace)
+	if err := cloneDoc(ws, clone); err != nil {
+		panic(err)
+	}
+	return clone
+}
+
+func (filter WorkspaceFilter) matches(ws *Workspace) bool {
+	if filter.ID != primitive.NilObjectID && filter.ID != ws.ID {
+		return false
+	}
+	if filter.Member != primitive.NilObjectID && ws.MemberRole(filter.Member) == "" {
+		return false
+	}
+	if filter.InviteEmail != "" && ws.Invite(filter.InviteEmail) == nil {
+		return false
+	}
+	return true
+}
+
+func (s *memoryWorkspaceStore) Insert(ws *Workspace) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if ws.ID == primitive.NilObjectID {
+		ws.ID = primitive.NewObjectID()
+	}
+	s.workspaces = append(s.workspaces, cloneWorkspace(ws))
+	return nil
+}
+
+func (s *memoryWorkspaceStore) FindOne(filter WorkspaceFilter) (*Workspace, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, ws := range s.workspaces {
+		if filter.matches(ws) {
+			return cloneWorkspace(ws), nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (s *memoryWorkspaceStore) Find(filter WorkspaceFilter) ([]*Workspace, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	results := []*Workspace{}
+	for _, ws := range s.workspaces {
+		if filter.matches(ws) {
+			results = append(results, cloneWorkspace(ws))
+		}
+	}
+	return results, nil
+}
+
+// update applies fn to the workspace with id, fn reports whether it changed anything
+func (s *memoryWorkspaceStore) update(id primitive.ObjectID, fn func(ws *Workspace) bool) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, ws := range s.workspaces {
+		if ws.ID == id {
+			return fn(ws), nil
+		}
+	}
+	return false, nil
+}
+
+func (s *memoryWorkspaceStore) AddInvite(id primitive.ObjectID, invite WorkspaceInvite) (bool, error) {
+	return s.update(id, func(ws *Workspace) bool {
+		if ws.Invite(invite.Email) != nil {
+			return false
+		}
+		ws.Invites = append(ws.Invites, invite)
+		return true
+	})
+}
+
+func removeInvite(ws *Workspace, email string) bool {
+	for i, invite := range ws.Invites {
+		if invite.Email == email {
+			ws.Invites = append(ws.Invites[:i:i], ws.Invites[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memoryWorkspaceStore) RemoveInvite(id primitive.ObjectID, email string) (bool, error) {
+	return s.update(id, func(ws *Workspace) bool {
+		return removeInvite(ws, email)
+	})
+}
+
+func (s *memoryWorkspaceStore) AcceptInvite(id primitive.ObjectID, email string, member WorkspaceMember) (bool, error) {
+	return s.update(id, func(ws *Workspace) bool {
+		if ws.MemberRole(member.User) != "" || !removeInvite(ws, email) {
+			return false
+		}
+		ws.Members = append(ws.Members, member)
+		return true
+	})
+}
+
+func (s *memoryWorkspaceStore) SetMemberRole(id primitive.ObjectID, user primitive.ObjectID, role WorkspaceRole) (bool, error) {
+	return s.update(id, func(ws *Workspace) bool {
+		for i := range ws.Members {
+			if ws.Members[i].User == user {
+				ws.Members[i].Role = role
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (s *memoryWorkspaceStore) RemoveMember(id primitive.ObjectID, user primitive.ObjectID) (bool, error) {
+	return s.update(id, func(ws *Workspace) bool {
+		for i, member := range ws.Members {
+			if member.User == user {
+				ws.Members = append(ws.Members[:i:i], ws.Members[i+1:]...)
+				return true
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type mongoAPIKeyStore struct {
+	coll *mongo.Collection
+}
+
+func (s *mongoAPIKeyStore) Insert(key *APIKey) error {
+	res, err := s.coll.InsertOne(context.TODO(), key)
+	if err != nil {
+		return err
+	}
+	key.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *mongoAPIKeyStore) FindByHash(hash string) (*APIKey, error) {
+	key := new(APIKey)
+	if err := s.coll.FindOne(context.TODO(), bson.M{"hash": hash}).Decode(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (s *mongoAPIKeyStore) FindByUser(user primitive.ObjectID) ([]*APIKey, error) {
+	cursor, err := s.coll.Find(context.TODO(), bson.M{"user": user})
+	if err != nil {
+		return nil, err
+	}
+
+	results := []*APIKey{}
+	if err := cursor.All(context.TODO(), &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (s *mongoAPIKeyStore) Delete(id primitive.ObjectID, user primitive.ObjectID) (int64, error) {
+	res, err := s.coll.DeleteOne(context.TODO(), bson.M{"_id": id, "user": user})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+func (s *mongoAPIKeyStore) SetLastUsed(id primitive.ObjectID, lastUsed UnixTime) error {
+	_, err := s.coll.UpdateOne(context.TODO(), bson.M{"_id": id}, bson.M{"$max": bson.M{"last_used": lastUsed}})
+	return err
+}
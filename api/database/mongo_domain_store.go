@@ -0,0 +1,79 @@
+package database
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type mongoDomainStore struct {
+	coll *mongo.Collection
+}
+
+func domainFilterToBson(filter DomainFilter) bson.M {
+	query := bson.M{}
+	if filter.ID != primitive.NilObjectID {
+		query["_id"] = filter.ID
+	}
+	if filter.User != primitive.NilObjectID {
+		query["user"] = filter.User
+	}
+	if filter.Host != "" {
+		query["host"] = filter.Host
+	}
+	if filter.Verified {
+		query["verified"] = true
+	}
+	return query
+}
+
+func (s *mongoDomainStore) Insert(domain *Domain) error {
+	res, err := s.coll.InsertOne(context.TODO(), domain)
+	if err != nil {
+		return err
+	}
+	domain.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *mongoDomainStore) FindOne(filter DomainFilter) (*Domain, error) {
+	domain := new(Domain)
+	if err := s.coll.FindOne(context.TODO(), domainFilterToBson(filter)).Decode(domain); err != nil {
+		return nil, err
+	}
+	return domain, nil
+}
+
+func (s *mongoDomainStore) Find(filter DomainFilter) ([]*Domain, error) {
+	cursor, err := s.coll.Find(context.TODO(), domainFilterToBson(filter))
+	if err != nil {
+		return nil, err
+	}
+
+	results := []*Domain{}
+	if err := cursor.All(context.TODO(), &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (s *mongoDomainStore) SetVerified(id primitive.ObjectID, verifiedAt UnixTime) (bool, error) {
+	res, err := s.coll.UpdateOne(context.TODO(), bson.M{"_id": id}, bson.M{"$set": bson.M{"verified": true, "verified_at": verifiedAt}})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, ErrDomainTaken
+		}
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+func (s *mongoDomainStore) Delete(id primitive.ObjectID, user primitive.ObjectID) (int64, error) {
+	res, err := s.coll.DeleteOne(context.TODO(), bson.M{"_id": id, "user": user})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
@@ -0,0 +1,292 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoURLStore struct {
+	coll *mongo.Collection
+}
+
+type mongoUserStore struct {
+	coll *mongo.Collection
+}
+
+type mongoConfigStore struct {
+	coll *mongo.Collection
+}
+
+func NewMongoStore(db *DB) *Store {
+	return &Store{
+		URL:       &mongoURLStore{coll: db.Url},
+		User:      &mongoUserStore{coll: db.User},
+		Config:    &mongoConfigStore{coll: db.Config},
+		Workspace: &mongoWorkspaceStore{coll: db.Workspace},
+		APIKey:    &mongoAPIKeyStore{coll: db.APIKey},
+		Domain:    &mongoDomainStore{coll: db.Domain},
+		Webhook:   &mongoWebhookStore{coll: db.Webhook, deliveries: db.WebhookDelivery},
+		disconnect: func(ctx context.Context) error {
+			return db.Client.Disconnect(ctx)
+		},
+	}
+}
+
+func urlFilterToBson(filter URLFilter) bson.M {
+	query := bson.M{}
+	if filter.ID != primitive.NilObjectID {
+		query["_id"] = filter.ID
+	}
+	if filter.User != primitive.NilObjectID {
+		query["user"] = filter.User
+	}
+	if filter.Short != "" {
+		query["short"] = filter.Short
+	}
+	if filter.Shorts != nil {
+		query["short"] = bson.M{"$in": filter.Shorts}
+	}
+	if filter.Domain != "" {
+		query["domain"] = filter.Domain
+	} else if filter.Short != "" || filter.Shorts != nil {
+		// null matches the urls on the default domain, they have no domain field
+		query["domain"] = nil
+	}
+	if filter.Workspace != primitive.NilObjectID {
+		query["workspace"] = filter.Workspace
+	}
+	if filter.Personal {
+		query["workspace"] = bson.M{"$exists": false}
+	}
+	if filter.Flagged {
+		query["screening"] = bson.M{"$exists": true, "$ne": nil}
+	}
+	if filter.ExpiredAfter != 0 || filter.ExpiredBefore != 0 {
+		expiry := bson.M{}
+		if filter.ExpiredAfter != 0 {
+			expiry["$gt"] = filter.ExpiredAfter
+		}
+		if filter.ExpiredBefore != 0 {
+			expiry["$lte"] = filter.ExpiredBefore
+		}
+		query["expiry"] = expiry
+	}
+	if filter.ExpiryUnnotified {
+		query["expiry_notified"] = bson.M{"$ne": true}
+	}
+	return query
+}
+
+func (s *mongoURLStore) Insert(url *URL) error {
+	res, err := s.coll.InsertOne(context.TODO(), url)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrDuplicateShort
+		}
+		return err
+	}
+	url.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *mongoURLStore) InsertMany(urls []*URL) []error {
+	errs := make([]error, len(urls))
+	docs := make([]interface{}, len(urls))
+	for i, url := range urls {
+		if url.ID == primitive.NilObjectID {
+			url.ID = primitive.NewObjectID()
+		}
+		docs[i] = url
+	}
+
+	_, err := s.coll.InsertMany(context.TODO(), docs, options.InsertMany().SetOrdered(false))
+	if err == nil {
+		return errs
+	}
+
+	bulkErr, ok := err.(mongo.BulkWriteException)
+	if !ok {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	for _, writeErr := range bulkErr.WriteErrors {
+		if writeErr.Code == 11000 {
+			errs[writeErr.Index] = ErrDuplicateShort
+		} else {
+			errs[writeErr.Index] = errors.New(writeErr.Message)
+		}
+	}
+	return errs
+}
+
+func (s *mongoURLStore) FindOne(filter URLFilter) (*URL, error) {
+	url := new(URL)
+	if err := s.coll.FindOne(context.TODO(), urlFilterToBson(filter)).Decode(url); err != nil {
+		return nil, err
+	}
+	return url, nil
+}
+
+func (s *mongoURLStore) Find(filter URLFilter) ([]*URL, error) {
+	ctx := context.TODO()
+	curr, err := s.coll.Find(ctx, urlFilterToBson(filter))
+	if err != nil {
+		return nil, err
+	}
+	defer curr.Close(ctx)
+
+	var results []*URL
+	for curr.Next(ctx) {
+		var result URL
+		if err := curr.Decode(&result); err != nil {
+			return nil, err
+		}
+		results = append(results, &result)
+	}
+
+	if err := curr.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func (s *mongoURLStore) FindBatches(filter URLFilter, size int, fn func(urls []*URL) error) error {
+	ctx := context.TODO()
+	curr, err := s.coll.Find(ctx, urlFilterToBson(filter), options.Find().SetBatchSize(int32(size)))
+	if err != nil {
+		return err
+	}
+	defer curr.Close(ctx)
+
+	batch := make([]*URL, 0, size)
+	for curr.Next(ctx) {
+		var result URL
+		if err := curr.Decode(&result); err != nil {
+			return err
+		}
+		batch = append(batch, &result)
+		if len(batch) == size {
+			if err := fn(batch); err != nil {
+				return err
+			}
+			batch = make([]*URL, 0, size)
+		}
+	}
+
+	if err := curr.Err(); err != nil {
+		return err
+	}
+	if len(batch) > 0 {
+		return fn(batch)
+	}
+	return nil
+}
+
+func (s *mongoURLStore) Update(filter URLFilter, set map[string]interface{}) (int64, error) {
+	res, err := s.coll.UpdateOne(context.TODO(), urlFilterToBson(filter), bson.M{"$set": set})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return 0, ErrDuplicateShort
+		}
+		return 0, err
+	}
+	return res.MatchedCount, nil
+}
+
+func (s *mongoURLStore) Delete(filter URLFilter) (int64, error) {
+	res, err := s.coll.DeleteOne(context.TODO(), urlFilterToBson(filter))
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+func (s *mongoURLStore) DeleteMany(filter URLFilter) (int64, error) {
+	res, err := s.coll.DeleteMany(context.TODO(), urlFilterToBson(filter))
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+func (s *mongoURLStore) ClaimClick(id primitive.ObjectID) (bool, error) {
+	filter := bson.M{"_id": id, "$expr": bson.M{"$lt": bson.A{"$total_clicks", "$max_clicks"}}}
+	res, err := s.coll.UpdateOne(context.TODO(), filter, bson.M{"$inc": bson.M{"total_clicks": 1}})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+func (s *mongoURLStore) ClaimExpiryNotification(id primitive.ObjectID) (bool, error) {
+	filter := bson.M{"_id": id, "expiry_notified": bson.M{"$ne": true}}
+	res, err := s.coll.UpdateOne(context.TODO(), filter, bson.M{"$set": bson.M{"expiry_notified": true}})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+func (s *mongoURLStore) RecordVisits(visits map[primitive.ObjectID]*URLVisits) error {
+	if len(visits) == 0 {
+		return nil
+	}
+
+	models := make([]mongo.WriteModel, 0, len(visits))
+	for id, visit := range visits {
+		update := bson.M{"$max": bson.M{"lastvisited": visit.LastVisited}}
+		if visit.Clicks > 0 {
+			update["$inc"] = bson.M{"total_clicks": visit.Clicks}
+		}
+		models = append(models, mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": id}).SetUpdate(update))
+	}
+
+	_, err := s.coll.BulkWrite(context.TODO(), models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func (s *mongoUserStore) Insert(user *User) error {
+	res, err := s.coll.InsertOne(context.TODO(), user)
+	if err != nil {
+		return err
+	}
+	user.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *mongoUserStore) FindByEmail(email string) (*User, error) {
+	user := new(User)
+	if err := s.coll.FindOne(context.TODO(), bson.M{"email": email}).Decode(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *mongoUserStore) FindByID(id primitive.ObjectID) (*User, error) {
+	user := new(User)
+	if err := s.coll.FindOne(context.TODO(), bson.M{"_id": id}).Decode(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *mongoConfigStore) FindByName(name string, dest interface{}) error {
+	return s.coll.FindOne(context.TODO(), bson.M{"name": name}).Decode(dest)
+}
+
+func (s *mongoConfigStore) Insert(config interface{}) (primitive.ObjectID, error) {
+	res, err := s.coll.InsertOne(context.TODO(), config)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return res.InsertedID.(primitive.ObjectID), nil
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoWebhookStore struct {
+	coll       *mongo.Collection
+	deliveries *mongo.Collection
+}
+
+func webhookFilterToBson(filter WebhookFilter) bson.M {
+	query := bson.M{}
+	if filter.ID != primitive.NilObjectID {
+		query["_id"] = filter.ID
+	}
+	if filter.User != primitive.NilObjectID {
+		query["user"] = filter.User
+	}
+	if filter.Event != "" {
+		query["events"] = filter.Event
+	}
+	return query
+}
+
+func (s *mongoWebhookStore) Insert(wh *Webhook) error {
+	res, err := s.coll.InsertOne(context.TODO(), wh)
+	if err != nil {
+		return err
+	}
+	wh.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *mongoWebhookStore) Find(filter WebhookFilter) ([]*Webhook, error) {
+	cursor, err := s.coll.Find(context.TODO(), webhookFilterToBson(filter))
+	if err != nil {
+		return nil, err
+	}
+
+	results := []*Webhook{}
+	if err := cursor.All(context.TODO(), &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (s *mongoWebhookStore) Delete(id primitive.ObjectID, user primitive.ObjectID) (int64, error) {
+	res, err := s.coll.DeleteOne(context.TODO(), bson.M{"_id": id, "user": user})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+func (s *mongoWebhookStore) InsertDelivery(delivery *WebhookDelivery) error {
+	res, err := s.deliveries.InsertOne(context.TODO(), delivery)
+	if err != nil {
+		return err
+	}
+	delivery.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *mongoWebhookStore) UpdateDelivery(delivery *WebhookDelivery) error {
+	_, err := s.deliveries.ReplaceOne(context.TODO(), bson.M{"_id": delivery.ID}, delivery)
+	return err
+}
+
+func (s *mongoWebhookStore) findDeliveries(query bson.M, opts *options.FindOptions) ([]*WebhookDelivery, error) {
+	cursor, err := s.deliveries.Find(context.TODO(), query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []*WebhookDelivery{}
+	if err := cursor.All(context.TODO(), &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (s *mongoWebhookStore) FindDeliveries(webhook primitive.ObjectID, limit int64) ([]*WebhookDelivery, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(limit)
+	return s.findDeliveries(bson.M{"webhook": webhook}, opts)
+}
+
+func (s *mongoWebhookStore) DueDeliveries(now UnixTime, limit int64) ([]*WebhookDelivery, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "next_attempt", Value: 1}}).SetLimit(limit)
+	return s.findDeliveries(bson.M{"status": WebhookDeliveryPending, "next_attempt": bson.M{"$lte": now}}, opts)
+}
+
+func (s *mongoWebhookStore) ClaimDelivery(delivery *WebhookDelivery, leaseUntil UnixTime) (bool, error) {
+	filter := bson.M{"_id": delivery.ID, "status": WebhookDeliveryPending, "next_attempt": delivery.NextAttempt}
+	res, err := s.deliveries.UpdateOne(context.TODO(), filter, bson.M{"$set": bson.M{"next_attempt": leaseUntil}})
+	if err != nil {
+		return false, err
+	}
+	if res.ModifiedCount == 0 {
+		return false, nil
+	}
+	delivery.NextAttempt = leaseUntil
+	return true, nil
+}
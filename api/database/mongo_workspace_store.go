@@ -0,0 +1,94 @@
+package database
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type mongoWorkspaceStore struct {
+	coll *mongo.Collection
+}
+
+func workspaceFilterToBson(filter WorkspaceFilter) bson.M {
+	query := bson.M{}
+	if filter.ID != primitive.NilObjectID {
+		query["_id"] = filter.ID
+	}
+	if filter.Member != primitive.NilObjectID {
+		query["members.user"] = filter.Member
+	}
+	if filter.InviteEmail != "" {
+		query["invites.email"] = filter.InviteEmail
+	}
+	return query
+}
+
+func (s *mongoWorkspaceStore) Insert(ws *Workspace) error {
+	res, err := s.coll.InsertOne(context.TODO(), ws)
+	if err != nil {
+		return err
+	}
+	ws.ID = res.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *mongoWorkspaceStore) FindOne(filter WorkspaceFilter) (*Workspace, error) {
+	ws := new(Workspace)
+	if err := s.coll.FindOne(context.TODO(), workspaceFilterToBson(filter)).Decode(ws); err != nil {
+		return nil, err
+	}
+	return ws, nil
+}
+
+func (s *mongoWorkspaceStore) Find(filter WorkspaceFilter) ([]*Workspace, error) {
+	cursor, err := s.coll.Find(context.TODO(), workspaceFilterToBson(filter))
+	if err != nil {
+		return nil, err
+	}
+
+	results := []*Workspace{}
+	if err := cursor.All(context.TODO(), &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (s *mongoWorkspaceStore) update(filter bson.M, update bson.M) (bool, error) {
+	res, err := s.coll.UpdateOne(context.TODO(), filter, update)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+func (s *mongoWorkspaceStore) AddInvite(id primitive.ObjectID, invite WorkspaceInvite) (bool, error) {
+	filter := bson.M{"_id": id, "invites.email": bson.M{"$ne": invite.Email}}
+	return s.update(filter, bson.M{"$push": bson.M{"invites": invite}})
+}
+
+func (s *mongoWorkspaceStore) RemoveInvite(id primitive.ObjectID, email string) (bool, error) {
+	filter := bson.M{"_id": id, "invites.email": email}
+	return s.update(filter, bson.M{"$pull": bson.M{"invites": bson.M{"email": email}}})
+}
+
+func (s *mongoWorkspaceStore) AcceptInvite(id primitive.ObjectID, email string, member WorkspaceMember) (bool, error) {
+	filter := bson.M{"_id": id, "invites.email": email, "members.user": bson.M{"$ne": member.User}}
+	update := bson.M{
+		"$pull": bson.M{"invites": bson.M{"email": email}},
+		"$push": bson.M{"members": member},
+	}
+	return s.update(filter, update)
+}
+
+func (s *mongoWorkspaceStore) SetMemberRole(id primitive.ObjectID, user primitive.ObjectID, role WorkspaceRole) (bool, error) {
+	filter := bson.M{"_id": id, "members.user": user}
+	return s.update(filter, bson.M{"$set": bson.M{"members.$.role": role}})
+}
+
+func (s *mongoWorkspaceStore) RemoveMember(id primitive.ObjectID, user primitive.ObjectID) (bool, error) {
+	filter := bson.M{"_id": id, "members.user": user}
+	return s.update(filter, bson.M{"$pull": bson.M{"members": bson.M{"user": user}}})
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"database/sql/driver"
 	"fmt"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -44,13 +45,294 @@ type URL struct {
 	UpdateAt    UnixTime           `json:"update_at" bson:"update_at"`
 	CreatedAt   UnixTime           `json:"created_at" bson:"created_at"`
 	TotalClicks int64              `json:"total_clicks" bson:"total_clicks"`
+	MaxClicks   int64              `json:"max_clicks" bson:"max_clicks,omitempty"`
+	LastVisited UnixTime           `json:"last_visited" bson:"lastvisited,omitempty"`
+	Password    string             `json:"password,omitempty" bson:"password,omitempty"`
+	Protected   bool               `json:"protected" bson:"-"`
+	Workspace   primitive.ObjectID `json:"workspace,omitempty" bson:"workspace,omitempty"`
+	// Domain is the custom host the short lives on, empty for SHORTED_URL_DOMAIN
+	Domain string `json:"domain,omitempty" bson:"domain,omitempty"`
+	// Screening is the blocklist match of the destination, nil when it's clean
+	Screening *URLScreening `json:"screening,omitempty" bson:"screening,omitempty"`
+	// Targets send matching visitors elsewhere, the first match wins over Destination
+	Targets []URLTarget `json:"targets,omitempty" bson:"targets,omitempty"`
+	// GeoRules send visitors by country, tried in order after Targets
+	GeoRules []URLGeoRule `json:"geo_rules,omitempty" bson:"geo_rules,omitempty"`
+	// Variants split the visitors no rule matched by weight, StickyVariants keeps
+	// a returning visitor on the variant they got first
+	Variants       []URLVariant `json:"variants,omitempty" bson:"variants,omitempty"`
+	StickyVariants bool         `json:"sticky_variants,omitempty" bson:"sticky_variants,omitempty"`
+	// UTM tags are merged into the chosen destination on every redirect
+	UTM *URLUTM `json:"utm,omitempty" bson:"utm,omitempty"`
+	// ForwardQuery passes the query string of the short url on to the destination
+	ForwardQuery bool `json:"forward_query,omitempty" bson:"forward_query,omitempty"`
+	// ActivatesAt is when the url starts resolving, until then visitors are sent
+	// to ComingSoonURL, or UI_COMING_SOON_URL when it's empty
+	ActivatesAt   UnixTime `json:"activates_at,omitempty" bson:"activates_at,omitempty"`
+	ComingSoonURL string   `json:"coming_soon_url,omitempty" bson:"coming_soon_url,omitempty"`
+	// Disabled urls were switched off by their owner, they keep their short and
+	// stats but don't resolve. Active is set on listed urls when they resolve.
+	Disabled bool `json:"disabled,omitempty" bson:"disabled,omitempty"`
+	Active   bool `json:"active" bson:"-"`
+	// Suspended urls were taken down by an admin and don't resolve
+	Suspended       bool   `json:"suspended" bson:"suspended,omitempty"`
+	SuspendedReason string `json:"suspended_reason,omitempty" bson:"suspended_reason,omitempty"`
+	// ExpiryNotified is set once url.expired was sent for the current Expiry
+	ExpiryNotified bool `json:"-" bson:"expiry_notified,omitempty"`
+}
+
+// Destinations lists every destination the url can redirect to, the default one first.
+func (url *URL) Destinations() []string {
+	destinations := []string{url.Destination}
+	for _, target := range url.Targets {
+		destinations = append(destinations, target.Destination)
+	}
+	for _, rule := range url.GeoRules {
+		destinations = append(destinations, rule.Destination)
+	}
+	for _, variant := range url.Variants {
+		destinations = append(destinations, variant.Destination)
+	}
+	if url.ComingSoonURL != "" {
+		destinations = append(destinations, url.ComingSoonURL)
+	}
+	return destinations
+}
+
+// URLTarget matches visitors by device type and os, an empty field matches any.
+type URLTarget struct {
+	Device      string `json:"device,omitempty" bson:"device,omitempty"`
+	OS          string `json:"os,omitempty" bson:"os,omitempty"`
+	Destination string `json:"destination" bson:"destination"`
+}
+
+// ID names the target in click events, e.g. "device:phone+os:ios".
+func (target URLTarget) ID() string {
+	parts := []string{}
+	if target.Device != "" {
+		parts = append(parts, "device:"+target.Device)
+	}
+	if target.OS != "" {
+		parts = append(parts, "os:"+target.OS)
+	}
+	return strings.Join(parts, "+")
+}
+
+// URLGeoRule matches visitors by the ISO 3166 alpha-2 code of their country.
+type URLGeoRule struct {
+	Country     string `json:"country" bson:"country"`
+	Destination string `json:"destination" bson:"destination"`
+}
+
+// ID names the rule in click events, e.g. "geo:IN".
+func (rule URLGeoRule) ID() string {
+	return "geo:" + rule.Country
+}
+
+// URLVariant is one destination of an A/B split, visitors are sent to it with a
+// probability of its weight over the total weight of the variants.
+type URLVariant struct {
+	ID          string `json:"id" bson:"id"`
+	Destination string `json:"destination" bson:"destination"`
+	Weight      int    `json:"weight" bson:"weight"`
+}
+
+// URLUTM are the campaign tags added to the destination as utm_* parameters,
+// empty fields are left out.
+type URLUTM struct {
+	Source   string `json:"source,omitempty" bson:"source,omitempty"`
+	Medium   string `json:"medium,omitempty" bson:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty" bson:"campaign,omitempty"`
+	Term     string `json:"term,omitempty" bson:"term,omitempty"`
+	Content  string `json:"content,omitempty" bson:"content,omitempty"`
+}
+
+type URLScreening struct {
+	List      string   `json:"list" bson:"list"`
+	Match     string   `json:"match" bson:"match"`
+	ScannedAt UnixTime `json:"scanned_at" bson:"scanned_at"`
+}
+
+// Domain is a custom host registered by a user, links can only be created on it
+// once the verification token has been found in its DNS TXT records.
+type Domain struct {
+	ID         primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	User       primitive.ObjectID `json:"user" bson:"user"`
+	Host       string             `json:"host" bson:"host"`
+	Token      string             `json:"token" bson:"token"`
+	Verified   bool               `json:"verified" bson:"verified"`
+	VerifiedAt UnixTime           `json:"verified_at" bson:"verified_at,omitempty"`
+	CreatedAt  UnixTime           `json:"created_at" bson:"created_at"`
+}
+
+type WorkspaceRole string
+
+const (
+	WorkspaceOwner  WorkspaceRole = "owner"
+	WorkspaceEditor WorkspaceRole = "editor"
+	WorkspaceViewer WorkspaceRole = "viewer"
+)
+
+var workspaceRoleRanks = map[WorkspaceRole]int{WorkspaceViewer: 1, WorkspaceEditor: 2, WorkspaceOwner: 3}
+
+func (role WorkspaceRole) Valid() bool {
+	_, found := workspaceRoleRanks[role]
+	return found
+}
+
+// Allows reports whether the role grants at least the required role, an empty role grants nothing.
+func (role WorkspaceRole) Allows(required WorkspaceRole) bool {
+	return role.Valid() && workspaceRoleRanks[role] >= workspaceRoleRanks[required]
+}
+
+type WorkspaceMember struct {
+	User primitive.ObjectID `json:"user" bson:"user"`
+	Role WorkspaceRole      `json:"role" bson:"role"`
+}
+
+type WorkspaceInvite struct {
+	Email     string             `json:"email" bson:"email"`
+	Role      WorkspaceRole      `json:"role" bson:"role"`
+	InvitedBy primitive.ObjectID `json:"invited_by" bson:"invited_by"`
+	CreatedAt UnixTime           `json:"created_at" bson:"created_at"`
+}
+
+type Workspace struct {
+	ID        primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Name      string             `json:"name" bson:"name"`
+	Members   []WorkspaceMember  `json:"members" bson:"members"`
+	Invites   []WorkspaceInvite  `json:"invites" bson:"invites"`
+	CreatedAt UnixTime           `json:"created_at" bson:"created_at"`
+}
+
+// MemberRole is the role of the user in the workspace, empty when they aren't a member.
+func (ws *Workspace) MemberRole(user primitive.ObjectID) WorkspaceRole {
+	for _, member := range ws.Members {
+		if member.User == user {
+			return member.Role
+		}
+	}
+	return ""
+}
+
+// Invite is the pending invite of the email, nil when there is none.
+func (ws *Workspace) Invite(email string) *WorkspaceInvite {
+	for i := range ws.Invites {
+		if ws.Invites[i].Email == email {
+			return &ws.Invites[i]
+		}
+	}
+	return nil
+}
+
+type APIKeyScope string
+
+const (
+	ScopeURLRead  APIKeyScope = "url:read"
+	ScopeURLWrite APIKeyScope = "url:write"
+)
+
+var APIKeyScopes = []APIKeyScope{ScopeURLRead, ScopeURLWrite}
+
+// APIKeyRateLimit allows Value requests per route every Expiry minutes.
+type APIKeyRateLimit struct {
+	Value  int `json:"value" bson:"value"`
+	Expiry int `json:"expiry" bson:"expiry"`
+}
+
+type APIKey struct {
+	ID        primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	User      primitive.ObjectID `json:"user" bson:"user"`
+	Name      string             `json:"name" bson:"name"`
+	Prefix    string             `json:"prefix" bson:"prefix"`
+	Hash      string             `json:"-" bson:"hash"`
+	Scopes    []APIKeyScope      `json:"scopes" bson:"scopes"`
+	RateLimit *APIKeyRateLimit   `json:"rate_limit,omitempty" bson:"rate_limit,omitempty"`
+	CreatedAt UnixTime           `json:"created_at" bson:"created_at"`
+	LastUsed  UnixTime           `json:"last_used" bson:"last_used,omitempty"`
+}
+
+func (key *APIKey) HasScope(scope APIKeyScope) bool {
+	for _, s := range key.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type WebhookEvent string
+
+const (
+	WebhookURLCreated WebhookEvent = "url.created"
+	WebhookURLUpdated WebhookEvent = "url.updated"
+	WebhookURLDeleted WebhookEvent = "url.deleted"
+	WebhookURLExpired WebhookEvent = "url.expired"
+	WebhookURLClicked WebhookEvent = "url.clicked"
+)
+
+var WebhookEvents = []WebhookEvent{WebhookURLCreated, WebhookURLUpdated, WebhookURLDeleted, WebhookURLExpired, WebhookURLClicked}
+
+type Webhook struct {
+	ID     primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	User   primitive.ObjectID `json:"user" bson:"user"`
+	URL    string             `json:"url" bson:"url"`
+	Events []WebhookEvent     `json:"events" bson:"events"`
+	// Secret signs the payloads, it's only returned when the webhook is created
+	Secret    string   `json:"-" bson:"secret"`
+	CreatedAt UnixTime `json:"created_at" bson:"created_at"`
+}
+
+func (wh *Webhook) Subscribed(event WebhookEvent) bool {
+	for _, e := range wh.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryDelivered WebhookDeliveryStatus = "delivered"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is one event sent to a webhook, pending deliveries are retried
+// at NextAttempt and the finished ones make up the delivery log.
+type WebhookDelivery struct {
+	ID             primitive.ObjectID    `json:"_id,omitempty" bson:"_id,omitempty"`
+	Webhook        primitive.ObjectID    `json:"webhook" bson:"webhook"`
+	Event          WebhookEvent          `json:"event" bson:"event"`
+	Payload        string                `json:"payload" bson:"payload"`
+	Status         WebhookDeliveryStatus `json:"status" bson:"status"`
+	Attempts       int                   `json:"attempts" bson:"attempts"`
+	NextAttempt    UnixTime              `json:"next_attempt" bson:"next_attempt"`
+	ResponseStatus int                   `json:"response_status,omitempty" bson:"response_status,omitempty"`
+	Error          string                `json:"error,omitempty" bson:"error,omitempty"`
+	CreatedAt      UnixTime              `json:"created_at" bson:"created_at"`
+	DeliveredAt    UnixTime              `json:"delivered_at,omitempty" bson:"delivered_at,omitempty"`
+}
+
+type ClickBucket struct {
+	Bucket UnixTime `json:"bucket"`
+	Clicks int      `json:"clicks"`
 }
 
 type ClickEvent struct {
-	URLId     string      `json:"url_id,omitempty"`
-	Geo       CountryName `json:"geo"`
-	Device    string      `json:"device"`
-	OS        string      `json:"os"`
-	Referrer  string      `json:"referrer"`
-	Timestamp UnixTime    `json:"timestamp"`
+	URLId    string      `json:"url_id,omitempty"`
+	Geo      CountryName `json:"geo"`
+	Device   string      `json:"device"`
+	OS       string      `json:"os"`
+	Referrer string      `json:"referrer"`
+	// Rule is the id of the target or geo rule which chose the destination,
+	// DefaultClickRule when the url's own destination was used
+	Rule string `json:"rule"`
+	// Variant is the id of the A/B variant the visitor was sent to, if any
+	Variant   string   `json:"variant,omitempty"`
+	Timestamp UnixTime `json:"timestamp"`
 }
+
+const DefaultClickRule = "default"
@@ -0,0 +1,184 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type StoreBackend string
+
+const MongoBackend StoreBackend = "mongo"
+const MemoryBackend StoreBackend = "memory"
+
+var ErrDuplicateShort = errors.New("URL custom short is already in user")
+var ErrDomainTaken = errors.New("domain is already verified by another user")
+
+// URLFilter selects url documents, zero valued fields are ignored. Shorts are
+// unique per domain, so Short and Shorts only match within Domain where an empty
+// Domain is the default one.
+type URLFilter struct {
+	ID        primitive.ObjectID
+	User      primitive.ObjectID
+	Short     string
+	Shorts    []string
+	Domain    string
+	Workspace primitive.ObjectID
+	// ExpiredAfter and ExpiredBefore select the urls expiring in (ExpiredAfter, ExpiredBefore]
+	ExpiredAfter  UnixTime
+	ExpiredBefore UnixTime
+	// ExpiryUnnotified only selects urls which url.expired wasn't sent for yet
+	ExpiryUnnotified bool
+	// Personal only selects urls which don't belong to a workspace
+	Personal bool
+	// Flagged only selects urls whose destination matched a blocklist
+	Flagged bool
+}
+
+// DomainFilter selects domain documents, zero valued fields are ignored.
+type DomainFilter struct {
+	ID       primitive.ObjectID
+	User     primitive.ObjectID
+	Host     string
+	Verified bool
+}
+
+// WorkspaceFilter selects workspace documents, zero valued fields are ignored.
+type WorkspaceFilter struct {
+	ID          primitive.ObjectID
+	Member      primitive.ObjectID
+	InviteEmail string
+}
+
+// WebhookFilter selects webhook documents, zero valued fields are ignored.
+type WebhookFilter struct {
+	ID    primitive.ObjectID
+	User  primitive.ObjectID
+	Event WebhookEvent
+}
+
+// URLVisits are the coalesced redirects of a url since the last flush.
+type URLVisits struct {
+	Clicks      int64
+	LastVisited UnixTime
+}
+
+type URLStore interface {
+	Insert(url *URL) error
+	// InsertMany returns one error slot per url, a failed url doesn't stop the rest.
+	InsertMany(urls []*URL) []error
+	FindOne(filter URLFilter) (*URL, error)
+	Find(filter URLFilter) ([]*URL, error)
+	// FindBatches passes the matching urls to fn size at a time instead of loading
+	// them all, it stops at the first error of fn.
+	FindBatches(filter URLFilter, size int, fn func(urls []*URL) error) error
+	// Update sets the given bson fields on the first matching url and returns the matched count.
+	Update(filter URLFilter, set map[string]interface{}) (int64, error)
+	Delete(filter URLFilter) (int64, error)
+	// DeleteMany deletes every matching url and returns the deleted count.
+	DeleteMany(filter URLFilter) (int64, error)
+	// ClaimClick atomically increments total_clicks of a url while it is still
+	// below max_clicks, returning false once the limit has been used up.
+	ClaimClick(id primitive.ObjectID) (bool, error)
+	// ClaimExpiryNotification atomically marks a url expiry notified, only the
+	// first caller gets true so url.expired is sent once across instances.
+	ClaimExpiryNotification(id primitive.ObjectID) (bool, error)
+	// RecordVisits adds the clicks to total_clicks and moves lastvisited forward.
+	RecordVisits(visits map[primitive.ObjectID]*URLVisits) error
+}
+
+type UserStore interface {
+	Insert(user *User) error
+	FindByEmail(email string) (*User, error)
+	FindByID(id primitive.ObjectID) (*User, error)
+}
+
+type APIKeyStore interface {
+	Insert(key *APIKey) error
+	FindByHash(hash string) (*APIKey, error)
+	FindByUser(user primitive.ObjectID) ([]*APIKey, error)
+	Delete(id primitive.ObjectID, user primitive.ObjectID) (int64, error)
+	SetLastUsed(id primitive.ObjectID, lastUsed UnixTime) error
+}
+
+type DomainStore interface {
+	Insert(domain *Domain) error
+	FindOne(filter DomainFilter) (*Domain, error)
+	Find(filter DomainFilter) ([]*Domain, error)
+	// SetVerified marks the domain verified, it fails with ErrDomainTaken when
+	// another domain document already verified the same host.
+	SetVerified(id primitive.ObjectID, verifiedAt UnixTime) (bool, error)
+	Delete(id primitive.ObjectID, user primitive.ObjectID) (int64, error)
+}
+
+// WebhookStore keeps the webhook subscriptions and their delivery log.
+type WebhookStore interface {
+	Insert(wh *Webhook) error
+	Find(filter WebhookFilter) ([]*Webhook, error)
+	Delete(id primitive.ObjectID, user primitive.ObjectID) (int64, error)
+	InsertDelivery(delivery *WebhookDelivery) error
+	// UpdateDelivery replaces the stored delivery with the same id
+	UpdateDelivery(delivery *WebhookDelivery) error
+	// FindDeliveries lists the deliveries of the webhook newest first
+	FindDeliveries(webhook primitive.ObjectID, limit int64) ([]*WebhookDelivery, error)
+	// DueDeliveries lists the pending deliveries whose next attempt is at or before now
+	DueDeliveries(now UnixTime, limit int64) ([]*WebhookDelivery, error)
+	// ClaimDelivery moves the next attempt of a due delivery to leaseUntil, it returns
+	// false when another worker claimed the delivery first.
+	ClaimDelivery(delivery *WebhookDelivery, leaseUntil UnixTime) (bool, error)
+}
+
+type ConfigStore interface {
+	FindByName(name string, dest interface{}) error
+	Insert(config interface{}) (primitive.ObjectID, error)
+}
+
+// WorkspaceStore keeps the workspaces with their members and pending invites, the
+// membership updates report false when the workspace or member didn't match.
+type WorkspaceStore interface {
+	Insert(ws *Workspace) error
+	FindOne(filter WorkspaceFilter) (*Workspace, error)
+	Find(filter WorkspaceFilter) ([]*Workspace, error)
+	// AddInvite adds the invite unless the email already has one
+	AddInvite(id primitive.ObjectID, invite WorkspaceInvite) (bool, error)
+	RemoveInvite(id primitive.ObjectID, email string) (bool, error)
+	// AcceptInvite atomically replaces the invite of the email with the member
+	AcceptInvite(id primitive.ObjectID, email string, member WorkspaceMember) (bool, error)
+	SetMemberRole(id primitive.ObjectID, user primitive.ObjectID, role WorkspaceRole) (bool, error)
+	RemoveMember(id primitive.ObjectID, user primitive.ObjectID) (bool, error)
+}
+
+type Store struct {
+	URL       URLStore
+	User      UserStore
+	Config    ConfigStore
+	Workspace WorkspaceStore
+	APIKey    APIKeyStore
+	Domain    DomainStore
+	Webhook   WebhookStore
+	// disconnect releases the backend connection, nil when there is none
+	disconnect func(ctx context.Context) error
+}
+
+// Close disconnects the store from its backend.
+func (s *Store) Close(ctx context.Context) error {
+	if s.disconnect == nil {
+		return nil
+	}
+	return s.disconnect(ctx)
+}
+
+// CreateStore connects the storage backend selected by name, mongo is the default.
+func CreateStore(backend string) (*Store, error) {
+	switch StoreBackend(backend) {
+	case MemoryBackend:
+		fmt.Println("Using in-memory store")
+		return NewMemoryStore(), nil
+	case MongoBackend, "":
+		return NewMongoStore(CreateDBInstance()), nil
+	default:
+		return nil, fmt.Errorf("unknown store backend %v", backend)
+	}
+}
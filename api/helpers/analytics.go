@@ -0,0 +1,43 @@
+package helpers
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/ivinayakg/shorte.live/api/database"
+	"github.com/ivinayakg/shorte.live/api/timescale"
+)
+
+// AnalyticsEnabled reads ANALYTICS_ENABLED, when it isn't set analytics are on
+// whenever a TimescaleDB connection is configured.
+func AnalyticsEnabled() bool {
+	enabled, err := strconv.ParseBool(os.Getenv("ANALYTICS_ENABLED"))
+	if err != nil {
+		return os.Getenv("TIMESCALE_CONN") != ""
+	}
+	return enabled
+}
+
+type AnalyticsHealth struct {
+	Enabled        bool              `json:"enabled"`
+	Healthy        bool              `json:"healthy"`
+	Error          string            `json:"error,omitempty"`
+	LastFlush      database.UnixTime `json:"last_flush,omitempty"`
+	FailedAttempts int               `json:"failed_attempts"`
+}
+
+// GetAnalyticsHealth reports whether click events are being stored, a disabled
+// analytics subsystem counts as healthy.
+func GetAnalyticsHealth() *AnalyticsHealth {
+	health := &AnalyticsHealth{Enabled: Tracker != nil, Healthy: true}
+	if Tracker == nil {
+		return health
+	}
+
+	health.LastFlush, health.FailedAttempts, health.Error = Tracker.status()
+	if err := timescale.Ping(); err != nil {
+		health.Error = err.Error()
+	}
+	health.Healthy = health.Error == ""
+	return health
+}
@@ -0,0 +1,33 @@
+package helpers
+
+import (
+	"context"
+	"sync"
+)
+
+var background sync.WaitGroup
+
+// Background runs fn on its own goroutine, WaitBackground waits for it on shutdown.
+func Background(fn func()) {
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		fn()
+	}()
+}
+
+// WaitBackground waits for the goroutines started with Background or until ctx is done.
+func WaitBackground(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,59 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+type CacheBackend string
+
+const RedisBackend CacheBackend = "redis"
+const MemoryBackend CacheBackend = "memory"
+
+var ErrCacheMiss = errors.New("cache: key not found")
+
+// CacheDB is the key-value and list store used for url caching, rate limiting,
+// config caching and the click event queue.
+type CacheDB interface {
+	SetJSON(key string, value interface{}, expiry time.Duration) error
+	GetJSON(key string, dest interface{}) error
+	// TTL follows redis, -2 when the key doesn't exist and -1 when it has no expiry.
+	TTL(key string) (time.Duration, error)
+	Del(keys ...string) error
+	LPush(key string, values ...string) error
+	LRange(key string, start int64, stop int64) ([]string, error)
+	LTrim(key string, start int64, stop int64) error
+	// RPopLPush atomically moves the last element of source to the head of
+	// destination, it returns ErrCacheMiss when source is empty.
+	RPopLPush(source string, destination string) (string, error)
+	// LRem removes the first count occurrences of value, all of them when count is 0.
+	LRem(key string, count int64, value string) error
+	FlushAll() error
+	Close() error
+}
+
+var Cache CacheDB
+
+// CacheSetup selects the cache backend from CACHE_BACKEND, falling back to
+// redis when REDIS_URL is set and to the in-process cache otherwise.
+func CacheSetup() {
+	backend := CacheBackend(os.Getenv("CACHE_BACKEND"))
+	if backend == "" {
+		backend = MemoryBackend
+		if os.Getenv("REDIS_URL") != "" {
+			backend = RedisBackend
+		}
+	}
+
+	switch backend {
+	case RedisBackend:
+		Cache = RedisSetup(os.Getenv("REDIS_URL"))
+	case MemoryBackend:
+		fmt.Println("Using in-memory cache")
+		Cache = NewMemoryDB()
+	default:
+		panic(fmt.Errorf("unknown cache backend %v", backend))
+	}
+}
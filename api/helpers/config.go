@@ -0,0 +1,13 @@
+package helpers
+
+import "github.com/ivinayakg/shorte.live/api/database"
+
+// Config reads the system and rate limit configs, they are persisted in the
+// config store and cached.
+type Config struct {
+	store database.ConfigStore
+}
+
+func NewConfig(store database.ConfigStore) *Config {
+	return &Config{store: store}
+}
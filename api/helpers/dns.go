@@ -0,0 +1,27 @@
+package helpers
+
+import (
+	"context"
+	"net"
+	"strings"
+)
+
+// DomainVerificationPrefix is prepended to a custom domain to find the TXT record holding its token
+const DomainVerificationPrefix = "_shorte-verification."
+
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// Resolver looks up the TXT records of custom domains, tests swap it for a stub.
+var Resolver TXTResolver = net.DefaultResolver
+
+// NormalizeHost lowercases the host and drops its port, so r.Host can be compared
+// with the registered domains.
+func NormalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(host, ".")
+}
@@ -0,0 +1,330 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ivinayakg/shorte.live/api/database"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+const geoCacheSize = 10000
+const UnknownCountry database.CountryName = "null"
+
+type Country struct {
+	ISOCode string               `json:"iso_code"`
+	Name    database.CountryName `json:"name"`
+}
+
+type geoDB interface {
+	lookup(ip net.IP) (*Country, error)
+	close() error
+}
+
+// GeoResolver maps client ips to countries from a local MaxMind style MMDB or
+// a CSV of ip ranges, and reloads the file when it is replaced on disk.
+type GeoResolver struct {
+	path    string
+	modTime time.Time
+	db      geoDB
+	cache   map[string]*Country
+	mutex   sync.RWMutex
+}
+
+var Geo *GeoResolver
+
+// SetupGeo loads the database at GEO_DB_PATH, clicks are tracked without a
+// country when it isn't set.
+func SetupGeo(reloadFrequency time.Duration) error {
+	path := os.Getenv("GEO_DB_PATH")
+	if path == "" {
+		return nil
+	}
+
+	resolver, err := NewGeoResolver(path)
+	if err != nil {
+		return err
+	}
+
+	Geo = resolver
+	go Geo.WatchReload(reloadFrequency)
+	return nil
+}
+
+func NewGeoResolver(path string) (*GeoResolver, error) {
+	g := &GeoResolver{path: path, cache: map[string]*Country{}}
+	if err := g.Reload(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func openGeoDB(path string) (geoDB, error) {
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return openGeoCSV(path)
+	}
+	return openGeoMMDB(path)
+}
+
+// Reload reopens the database file, a failed reload keeps the current one.
+func (g *GeoResolver) Reload() error {
+	info, err := os.Stat(g.path)
+	if err != nil {
+		return err
+	}
+
+	db, err := openGeoDB(g.path)
+	if err != nil {
+		return err
+	}
+
+	// the old reader is closed under the write lock, closing unmaps the mmdb so
+	// no lookup may still be reading from it
+	g.mutex.Lock()
+	old := g.db
+	g.db = db
+	g.modTime = info.ModTime()
+	g.cache = map[string]*Country{}
+	if old != nil {
+		old.close()
+	}
+	g.mutex.Unlock()
+
+	fmt.Printf("Loaded geo database %v\n", g.path)
+	return nil
+}
+
+func (g *GeoResolver) WatchReload(frequency time.Duration) {
+	ticker := time.NewTicker(frequency)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		info, err := os.Stat(g.path)
+		if err != nil {
+			continue
+		}
+
+		g.mutex.RLock()
+		changed := !info.ModTime().Equal(g.modTime)
+		g.mutex.RUnlock()
+
+		if changed {
+			if err := g.Reload(); err != nil {
+				fmt.Println(err)
+			}
+		}
+	}
+}
+
+// ParseIP takes the first address of an X-Forwarded-For style value, with or
+// without a port.
+func ParseIP(value string) net.IP {
+	value = strings.TrimSpace(strings.Split(value, ",")[0])
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	return net.ParseIP(value)
+}
+
+func (g *GeoResolver) Lookup(ipValue string) *Country {
+	ip := ParseIP(ipValue)
+	if g == nil || ip == nil {
+		return nil
+	}
+	key := ip.String()
+
+	// the read lock is held for the whole lookup so Reload can't close the db under it
+	g.mutex.RLock()
+	country, found := g.cache[key]
+	db := g.db
+	var err error
+	if !found {
+		country, err = db.lookup(ip)
+	}
+	g.mutex.RUnlock()
+
+	if found {
+		return country
+	}
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+
+	g.mutex.Lock()
+	if g.db == db {
+		if len(g.cache) >= geoCacheSize {
+			g.cache = map[string]*Country{}
+		}
+		g.cache[key] = country
+	}
+	g.mutex.Unlock()
+
+	return country
+}
+
+// LookupCountry returns the country name of the ip, or UnknownCountry.
+func (g *GeoResolver) LookupCountry(ipValue string) database.CountryName {
+	country := g.Lookup(ipValue)
+	if country == nil || country.Name == "" {
+		return UnknownCountry
+	}
+	return country.Name
+}
+
+type geoMMDB struct {
+	reader *maxminddb.Reader
+}
+
+type mmdbCountryRecord struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+}
+
+func openGeoMMDB(path string) (geoDB, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &geoMMDB{reader: reader}, nil
+}
+
+func (m *geoMMDB) lookup(ip net.IP) (*Country, error) {
+	var record mmdbCountryRecord
+	if err := m.reader.Lookup(ip, &record); err != nil {
+		return nil, err
+	}
+	if record.Country.ISOCode == "" {
+		return nil, nil
+	}
+
+	name := record.Country.Names["en"]
+	if name == "" {
+		name = record.Country.ISOCode
+	}
+	return &Country{ISOCode: record.Country.ISOCode, Name: database.CountryName(name)}, nil
+}
+
+func (m *geoMMDB) close() error {
+	return m.reader.Close()
+}
+
+type geoRange struct {
+	start   net.IP
+	end     net.IP
+	country *Country
+}
+
+// geoCSV holds rows of start,end,iso_code[,name] sorted by start, the bounds
+// are ip addresses or their decimal form.
+type geoCSV struct {
+	ranges []geoRange
+}
+
+func parseRangeIP(value string) (net.IP, error) {
+	value = strings.TrimSpace(value)
+	if ip := net.ParseIP(value); ip != nil {
+		return ip.To16(), nil
+	}
+
+	n, ok := new(big.Int).SetString(value, 10)
+	if !ok || n.Sign() < 0 || n.BitLen() > 128 {
+		return nil, fmt.Errorf("invalid ip %v", value)
+	}
+	if n.BitLen() <= 32 {
+		ip := make(net.IP, 4)
+		n.FillBytes(ip)
+		return ip.To16(), nil
+	}
+	ip := make(net.IP, 16)
+	n.FillBytes(ip)
+	return ip, nil
+}
+
+func openGeoCSV(path string) (geoDB, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+
+	db := &geoCSV{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("invalid geo range on line %v", line)
+		}
+
+		start, err := parseRangeIP(record[0])
+		if err != nil {
+			// skip a header row
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("invalid geo range on line %v: %v", line, err)
+		}
+		end, err := parseRangeIP(record[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid geo range on line %v: %v", line, err)
+		}
+
+		code := strings.TrimSpace(record[2])
+		if code == "" || code == "-" {
+			continue
+		}
+		name := code
+		if len(record) > 3 && strings.TrimSpace(record[3]) != "" {
+			name = strings.TrimSpace(record[3])
+		}
+
+		db.ranges = append(db.ranges, geoRange{start: start, end: end, country: &Country{ISOCode: code, Name: database.CountryName(name)}})
+	}
+
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return bytes.Compare(db.ranges[i].start, db.ranges[j].start) < 0
+	})
+	return db, nil
+}
+
+func (c *geoCSV) lookup(ip net.IP) (*Country, error) {
+	ip = ip.To16()
+	// first range starting after the ip, the candidate is the one before it
+	i := sort.Search(len(c.ranges), func(i int) bool {
+		return bytes.Compare(c.ranges[i].start, ip) > 0
+	})
+	if i == 0 {
+		return nil, nil
+	}
+
+	candidate := c.ranges[i-1]
+	if bytes.Compare(ip, candidate.end) > 0 {
+		return nil, nil
+	}
+	return candidate.country, nil
+}
+
+func (c *geoCSV) close() error {
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
 	"regexp"
 	"strings"
 	"time"
@@ -44,9 +45,10 @@ func SendJSONError(w http.ResponseWriter, statusCode int, errorMessage string) {
 	json.NewEncoder(w).Encode(errorResponse)
 }
 
+// ContainsString reports whether target is one of the strings of arr.
 func ContainsString(arr *[]string, target *string) bool {
 	for _, s := range *arr {
-		if strings.Contains(s, *target) {
+		if s == *target {
 			return true
 		}
 	}
@@ -85,3 +87,16 @@ func NotValidShortString(short *string) bool {
 func LowestUnixTime() int64 {
 	return time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
 }
+
+// IsAdmin reports whether the email is one of the space or comma separated ADMIN_EMAILS.
+func IsAdmin(email string) bool {
+	if email == "" {
+		return false
+	}
+	for _, admin := range strings.FieldsFunc(os.Getenv("ADMIN_EMAILS"), func(r rune) bool { return r == ' ' || r == ',' }) {
+		if strings.EqualFold(admin, email) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,247 @@
+package helpers
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+const memoryCacheSweepFrequency = time.Minute
+
+type memoryCacheEntry struct {
+	value  string
+	expiry time.Time
+}
+
+func (e *memoryCacheEntry) expired(now time.Time) bool {
+	return !e.expiry.IsZero() && !now.Before(e.expiry)
+}
+
+// MemoryDB is an in-process CacheDB for single node deployments and local
+// development, expired keys are dropped lazily and by a periodic sweep.
+type MemoryDB struct {
+	mutex   sync.Mutex
+	entries map[string]*memoryCacheEntry
+	lists   map[string][]string
+	done    chan struct{}
+}
+
+func NewMemoryDB() *MemoryDB {
+	m := &MemoryDB{
+		entries: map[string]*memoryCacheEntry{},
+		lists:   map[string][]string{},
+		done:    make(chan struct{}),
+	}
+	go m.sweep()
+	return m
+}
+
+func (m *MemoryDB) sweep() {
+	ticker := time.NewTicker(memoryCacheSweepFrequency)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case now := <-ticker.C:
+			m.mutex.Lock()
+			for key, entry := range m.entries {
+				if entry.expired(now) {
+					delete(m.entries, key)
+				}
+			}
+			m.mutex.Unlock()
+		}
+	}
+}
+
+func (m *MemoryDB) entry(key string) *memoryCacheEntry {
+	entry, found := m.entries[key]
+	if !found {
+		return nil
+	}
+	if entry.expired(time.Now()) {
+		delete(m.entries, key)
+		return nil
+	}
+	return entry
+}
+
+func (m *MemoryDB) SetJSON(key string, value interface{}, expiry time.Duration) error {
+	p, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	entry := &memoryCacheEntry{value: string(p)}
+	if expiry > 0 {
+		entry.expiry = time.Now().Add(expiry)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.entries[key] = entry
+	return nil
+}
+
+func (m *MemoryDB) GetJSON(key string, dest interface{}) error {
+	m.mutex.Lock()
+	entry := m.entry(key)
+	m.mutex.Unlock()
+
+	if entry == nil {
+		return ErrCacheMiss
+	}
+	return json.Unmarshal([]byte(entry.value), dest)
+}
+
+func (m *MemoryDB) TTL(key string) (time.Duration, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	entry := m.entry(key)
+	if entry == nil {
+		if _, found := m.lists[key]; found {
+			return -1, nil
+		}
+		return -2, nil
+	}
+	if entry.expiry.IsZero() {
+		return -1, nil
+	}
+	return time.Until(entry.expiry), nil
+}
+
+func (m *MemoryDB) Del(keys ...string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, key := range keys {
+		delete(m.entries, key)
+		delete(m.lists, key)
+	}
+	return nil
+}
+
+func (m *MemoryDB) LPush(key string, values ...string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	list := m.lists[key]
+	for _, value := range values {
+		list = append([]string{value}, list...)
+	}
+	m.lists[key] = list
+	return nil
+}
+
+// listRange converts redis style inclusive, possibly negative, indexes into
+// slice bounds for a list of the given length.
+func listRange(length int, start int64, stop int64) (int, int) {
+	n := int64(length)
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop {
+		return 0, 0
+	}
+	return int(start), int(stop) + 1
+}
+
+func (m *MemoryDB) LRange(key string, start int64, stop int64) ([]string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	list := m.lists[key]
+	from, to := listRange(len(list), start, stop)
+	result := make([]string, to-from)
+	copy(result, list[from:to])
+	return result, nil
+}
+
+func (m *MemoryDB) LTrim(key string, start int64, stop int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	list := m.lists[key]
+	from, to := listRange(len(list), start, stop)
+	if from == to {
+		delete(m.lists, key)
+		return nil
+	}
+	m.lists[key] = append([]string{}, list[from:to]...)
+	return nil
+}
+
+func (m *MemoryDB) RPopLPush(source string, destination string) (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	list := m.lists[source]
+	if len(list) == 0 {
+		return "", ErrCacheMiss
+	}
+
+	value := list[len(list)-1]
+	if len(list) == 1 {
+		delete(m.lists, source)
+	} else {
+		m.lists[source] = list[:len(list)-1]
+	}
+	m.lists[destination] = append([]string{value}, m.lists[destination]...)
+	return value, nil
+}
+
+func (m *MemoryDB) LRem(key string, count int64, value string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	list := m.lists[key]
+	kept := make([]string, 0, len(list))
+	removed := int64(0)
+	for _, v := range list {
+		if v == value && (count == 0 || removed < count) {
+			removed++
+			continue
+		}
+		kept = append(kept, v)
+	}
+	if len(kept) == 0 {
+		delete(m.lists, key)
+		return nil
+	}
+	m.lists[key] = kept
+	return nil
+}
+
+func (m *MemoryDB) FlushAll() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.entries = map[string]*memoryCacheEntry{}
+	m.lists = map[string][]string{}
+	return nil
+}
+
+// Close stops the expiry sweep, the cached data stays readable.
+func (m *MemoryDB) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	select {
+	case <-m.done:
+	default:
+		close(m.done)
+	}
+	return nil
+}
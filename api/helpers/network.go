@@ -0,0 +1,90 @@
+package helpers
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var ErrPrivateAddress = errors.New("address is not publicly routable")
+
+// AllowPrivateNetworks lets PublicHTTPClient reach loopback and private
+// addresses, tests turn it on to deliver to a local server.
+var AllowPrivateNetworks = false
+
+// non public ranges the net.IP predicates don't cover
+var reservedNetworks = func() []*net.IPNet {
+	networks := []*net.IPNet{}
+	for _, cidr := range []string{
+		"0.0.0.0/8",       // this network
+		"100.64.0.0/10",   // carrier grade nat
+		"192.0.0.0/24",    // ietf protocol assignments
+		"192.0.2.0/24",    // documentation
+		"198.18.0.0/15",   // benchmarking
+		"198.51.100.0/24", // documentation
+		"203.0.113.0/24",  // documentation
+		"240.0.0.0/4",     // reserved
+		"64:ff9b::/96",    // nat64, can embed a private ipv4
+		"2001:db8::/32",   // documentation
+	} {
+		_, network, _ := net.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+// IsPublicIP reports whether the ip is routable on the internet, loopback,
+// private, link local (including 169.254.169.254) and reserved addresses aren't.
+func IsPublicIP(ip net.IP) bool {
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsPrivateHost reports whether the host of a url is a literal non public ip or
+// localhost, hostnames are checked when connecting instead.
+func IsPrivateHost(host string) bool {
+	host = NormalizeHost(host)
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && !IsPublicIP(ip)
+}
+
+// publicDialControl runs after the address is resolved and before connecting, so
+// a hostname which resolves to a private address is refused whatever its DNS says
+// at the time the url was checked.
+func publicDialControl(network string, address string, c syscall.RawConn) error {
+	if AllowPrivateNetworks {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if !IsPublicIP(net.ParseIP(host)) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// PublicHTTPClient is a client for user supplied urls, it only connects to public
+// addresses and doesn't go through a proxy which could reach the rest.
+func PublicHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second, Control: publicDialControl}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
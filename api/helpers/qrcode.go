@@ -0,0 +1,203 @@
+package helpers
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+type QRFormat string
+
+const (
+	QRFormatPNG QRFormat = "png"
+	QRFormatSVG QRFormat = "svg"
+)
+
+const qrDefaultSize = 256
+const qrMinSize = 64
+const qrMaxSize = 2048
+
+// the spec asks for a quiet zone of 4 modules around the code
+const qrDefaultMargin = 4
+const qrMaxMargin = 16
+
+var qrLevels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// QROptions control how a QR code is rendered, Size is the image width in pixels
+// and Margin the quiet zone in modules.
+type QROptions struct {
+	Format     QRFormat
+	Size       int
+	Level      qrcode.RecoveryLevel
+	Margin     int
+	Foreground color.RGBA
+	Background color.RGBA
+}
+
+func parseHexColor(value string) (color.RGBA, error) {
+	value = strings.TrimPrefix(value, "#")
+	if len(value) == 3 {
+		value = string([]byte{value[0], value[0], value[1], value[1], value[2], value[2]})
+	}
+	if len(value) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid colour %v", value)
+	}
+
+	rgb, err := strconv.ParseUint(value, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid colour %v", value)
+	}
+	return color.RGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 0xff}, nil
+}
+
+// ParseQROptions reads format, size, level (L, M, Q or H), margin and the fg and
+// bg hex colours from the query, falling back to a black on white 256px PNG.
+func ParseQROptions(query url.Values) (*QROptions, error) {
+	opts := &QROptions{
+		Format:     QRFormatPNG,
+		Size:       qrDefaultSize,
+		Level:      qrcode.Medium,
+		Margin:     qrDefaultMargin,
+		Foreground: color.RGBA{A: 0xff},
+		Background: color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+	}
+	var err error
+
+	if format := strings.ToLower(query.Get("format")); format != "" {
+		opts.Format = QRFormat(format)
+		if opts.Format != QRFormatPNG && opts.Format != QRFormatSVG {
+			return nil, fmt.Errorf("invalid format, use png or svg")
+		}
+	}
+
+	if size := query.Get("size"); size != "" {
+		opts.Size, err = strconv.Atoi(size)
+		if err != nil || opts.Size < qrMinSize || opts.Size > qrMaxSize {
+			return nil, fmt.Errorf("invalid size, use %v to %v pixels", qrMinSize, qrMaxSize)
+		}
+	}
+
+	if level := strings.ToUpper(query.Get("level")); level != "" {
+		var found bool
+		opts.Level, found = qrLevels[level]
+		if !found {
+			return nil, fmt.Errorf("invalid level, use L, M, Q or H")
+		}
+	}
+
+	if margin := query.Get("margin"); margin != "" {
+		opts.Margin, err = strconv.Atoi(margin)
+		if err != nil || opts.Margin < 0 || opts.Margin > qrMaxMargin {
+			return nil, fmt.Errorf("invalid margin, use 0 to %v modules", qrMaxMargin)
+		}
+	}
+
+	if fg := query.Get("fg"); fg != "" {
+		if opts.Foreground, err = parseHexColor(fg); err != nil {
+			return nil, err
+		}
+	}
+	if bg := query.Get("bg"); bg != "" {
+		if opts.Background, err = parseHexColor(bg); err != nil {
+			return nil, err
+		}
+	}
+
+	return opts, nil
+}
+
+// qrModules encodes the content into its dark modules, surrounded by the margin.
+func qrModules(content string, opts *QROptions) ([][]bool, error) {
+	code, err := qrcode.New(content, opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	code.DisableBorder = true
+	bitmap := code.Bitmap()
+
+	total := len(bitmap) + 2*opts.Margin
+	modules := make([][]bool, total)
+	for y := range modules {
+		modules[y] = make([]bool, total)
+	}
+	for y, row := range bitmap {
+		copy(modules[y+opts.Margin][opts.Margin:], row)
+	}
+	return modules, nil
+}
+
+// QRCode renders the content as a Size x Size image in the requested format, it
+// returns the image with its content type.
+func QRCode(content string, opts *QROptions) ([]byte, string, error) {
+	modules, err := qrModules(content, opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if opts.Format == QRFormatSVG {
+		return qrSVG(modules, opts), "image/svg+xml", nil
+	}
+
+	p, err := qrPNG(modules, opts)
+	return p, "image/png", err
+}
+
+func qrPNG(modules [][]bool, opts *QROptions) ([]byte, error) {
+	scale := opts.Size / len(modules)
+	if scale < 1 {
+		return nil, fmt.Errorf("size is too small for this code, use at least %v pixels", len(modules))
+	}
+	// the leftover pixels are split around the code
+	offset := (opts.Size - scale*len(modules)) / 2
+
+	img := image.NewPaletted(image.Rect(0, 0, opts.Size, opts.Size), color.Palette{opts.Background, opts.Foreground})
+	for y, row := range modules {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for py := 0; py < scale; py++ {
+				for px := 0; px < scale; px++ {
+					img.SetColorIndex(offset+x*scale+px, offset+y*scale+py, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func qrSVG(modules [][]bool, opts *QROptions) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%v" height="%v" viewBox="0 0 %v %v" shape-rendering="crispEdges">`, opts.Size, opts.Size, len(modules), len(modules))
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="%v"/><path fill="%v" d="`, hexColor(opts.Background), hexColor(opts.Foreground))
+	for y, row := range modules {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&buf, "M%v %vh1v1h-1z", x, y)
+			}
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes()
+}
@@ -1,13 +1,11 @@
 package helpers
 
 import (
-	"context"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/ivinayakg/shorte.live/api/database"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -29,6 +27,11 @@ type RateLimitLog struct {
 	CoolDown time.Duration `json:"cooldown"`
 }
 
+type apiKeyAuth string
+
+// APIKeyAuthKey holds the *database.APIKey of requests authenticated with an API key
+const APIKeyAuthKey apiKeyAuth = "APIKey"
+
 const RateConfigName string = "rate_limit_config"
 const RateConfigNameCacheKey string = "cached_rate_limit_config"
 
@@ -41,10 +44,10 @@ func getDefaultRateConfig() RateConfig {
 	}
 }
 
-func GetRateConfig(revalidateCache bool) *RateConfig {
+func (c *Config) GetRateConfig(revalidateCache bool) *RateConfig {
 	rateConfig := &RateConfig{}
 
-	err := Redis.GetJSON(RateConfigNameCacheKey, rateConfig)
+	err := Cache.GetJSON(RateConfigNameCacheKey, rateConfig)
 	if err != nil {
 		fmt.Println(err)
 	}
@@ -52,9 +55,7 @@ func GetRateConfig(revalidateCache bool) *RateConfig {
 	if rateConfig.ID != primitive.NilObjectID && !revalidateCache {
 		return rateConfig
 	} else {
-		var rateConfigFilters = bson.M{"name": RateConfigName}
-
-		err = database.CurrentDb.Config.FindOne(context.Background(), rateConfigFilters).Decode(rateConfig)
+		err = c.store.FindByName(string(RateConfigName), rateConfig)
 		if err != nil && err != mongo.ErrNoDocuments {
 			fmt.Println(err)
 			return nil
@@ -62,24 +63,78 @@ func GetRateConfig(revalidateCache bool) *RateConfig {
 
 		if err == mongo.ErrNoDocuments {
 			defaultRateConfig := getDefaultRateConfig()
-			res, err := database.CurrentDb.Config.InsertOne(context.Background(), defaultRateConfig)
+			id, err := c.store.Insert(defaultRateConfig)
 			if err != nil {
 				fmt.Println(err)
 				return nil
 			}
 
 			rateConfig = &defaultRateConfig
-			rateConfig.ID = res.InsertedID.(primitive.ObjectID)
+			rateConfig.ID = id
 		}
 
-		Redis.SetJSON(RateConfigNameCacheKey, rateConfig, time.Duration(time.Minute*60))
+		Cache.SetJSON(RateConfigNameCacheKey, rateConfig, time.Duration(time.Minute*60))
 		return rateConfig
 	}
 }
 
-func RateLimit(r *http.Request, auth string, defaultLimit *URLLimit) (time.Duration, error) {
-	rateConfig := GetRateConfig(false)
-	urlRateName := r.URL.Path + "-" + r.Method
+// capAPIKeyLimit applies the limit of an API key within the route limit, a key can
+// only tighten it: the smaller value and the longer window win.
+func capAPIKeyLimit(route *URLLimit, key *database.APIKeyRateLimit) *URLLimit {
+	limit := &URLLimit{Value: key.Value, Expiry: key.Expiry}
+	if route.Value < limit.Value {
+		limit.Value = route.Value
+	}
+	if route.Expiry > limit.Expiry {
+		limit.Expiry = route.Expiry
+	}
+	return limit
+}
+
+// ValidateAPIKeyRateLimit rejects a key limit which allows more requests or a
+// shorter window than any configured route limit, it would always be capped.
+func (c *Config) ValidateAPIKeyRateLimit(limit *database.APIKeyRateLimit) error {
+	if limit.Value <= 0 || limit.Expiry <= 0 {
+		return fmt.Errorf("invalid rate limit")
+	}
+
+	rateConfig := c.GetRateConfig(false)
+	if rateConfig == nil {
+		return fmt.Errorf("rate limits are unavailable")
+	}
+
+	maxValue, minExpiry := 0, 0
+	for _, route := range rateConfig.Limit {
+		if route.Value > maxValue {
+			maxValue = route.Value
+		}
+		if minExpiry == 0 || route.Expiry < minExpiry {
+			minExpiry = route.Expiry
+		}
+	}
+	if limit.Value > maxValue {
+		return fmt.Errorf("rate limit value can be at most %v", maxValue)
+	}
+	if limit.Expiry < minExpiry {
+		return fmt.Errorf("rate limit expiry must be at least %v minutes", minExpiry)
+	}
+	return nil
+}
+
+func (c *Config) RateLimit(r *http.Request, auth string, defaultLimit *URLLimit) (time.Duration, error) {
+	return c.rateLimit(r, auth, r.URL.Path, defaultLimit, 1)
+}
+
+// RateLimitItems charges items requests to the limit of the route at path, so a
+// batch counts like the same number of single requests. The whole batch is
+// rejected when the quota left is smaller than it.
+func (c *Config) RateLimitItems(r *http.Request, auth string, path string, items int) (time.Duration, error) {
+	return c.rateLimit(r, auth, path, nil, items)
+}
+
+func (c *Config) rateLimit(r *http.Request, auth string, path string, defaultLimit *URLLimit, items int) (time.Duration, error) {
+	rateConfig := c.GetRateConfig(false)
+	urlRateName := path + "-" + r.Method
 
 	urlRateConfig, found := rateConfig.Limit[urlRateName]
 	if !found {
@@ -94,11 +149,18 @@ func RateLimit(r *http.Request, auth string, defaultLimit *URLLimit) (time.Durat
 		auth = GetUserIP(r)
 	}
 
+	// API keys are limited on their own, with the key's limit when it has one
+	if key, ok := r.Context().Value(APIKeyAuthKey).(*database.APIKey); ok {
+		auth = "apikey-" + key.ID.Hex()
+		if key.RateLimit != nil {
+			urlRateConfig = capAPIKeyLimit(urlRateConfig, key.RateLimit)
+		}
+	}
+
 	rateLimitLog := &RateLimitLog{}
 	userRateLimitKey := auth + "-" + urlRateName
-	c := context.Background()
 
-	cacheExpiry, err := Redis.Client.TTL(c, userRateLimitKey).Result()
+	cacheExpiry, err := Cache.TTL(userRateLimitKey)
 	if err != nil {
 		return 0, err
 	}
@@ -107,23 +169,26 @@ func RateLimit(r *http.Request, auth string, defaultLimit *URLLimit) (time.Durat
 		rateLimitLog = &RateLimitLog{
 			CoolDown: time.Duration(urlRateConfig.Expiry) * time.Minute,
 			Limit:    urlRateConfig.Value,
-			Used:     1,
+			Used:     items,
+		}
+		if rateLimitLog.Limit < items {
+			return rateLimitLog.CoolDown, fmt.Errorf("too many requests")
 		}
 	} else {
-		err = Redis.GetJSON(userRateLimitKey, rateLimitLog)
+		err = Cache.GetJSON(userRateLimitKey, rateLimitLog)
 		if err != nil {
 			return 0, err
 		}
 		rateLimitLog.CoolDown = cacheExpiry
 
-		if rateLimitLog.Limit <= rateLimitLog.Used {
+		if rateLimitLog.Limit-rateLimitLog.Used < items {
 			return rateLimitLog.CoolDown, fmt.Errorf("too many requests")
 		}
 
-		rateLimitLog.Used += 1
+		rateLimitLog.Used += items
 	}
 
-	if err := Redis.SetJSON(userRateLimitKey, rateLimitLog, rateLimitLog.CoolDown); err != nil {
+	if err := Cache.SetJSON(userRateLimitKey, rateLimitLog, rateLimitLog.CoolDown); err != nil {
 		return 0, err
 	}
 
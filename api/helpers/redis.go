@@ -3,7 +3,6 @@ package helpers
 import (
 	"context"
 	"encoding/json"
-	"os"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -13,15 +12,13 @@ type RedisDB struct {
 	Client *redis.Client
 }
 
-var Redis = &RedisDB{}
-
-func RedisSetup() {
-	opt, err := redis.ParseURL(os.Getenv("REDIS_URL"))
+func RedisSetup(url string) *RedisDB {
+	opt, err := redis.ParseURL(url)
 	if err != nil {
 		panic(err)
 	}
 
-	Redis.Client = redis.NewClient(opt)
+	return &RedisDB{Client: redis.NewClient(opt)}
 }
 
 func (r RedisDB) SetJSON(key string, value interface{}, expiry time.Duration) error {
@@ -34,8 +31,55 @@ func (r RedisDB) SetJSON(key string, value interface{}, expiry time.Duration) er
 
 func (r RedisDB) GetJSON(key string, dest interface{}) error {
 	p, err := r.Client.Get(context.Background(), key).Result()
+	if err == redis.Nil {
+		return ErrCacheMiss
+	}
 	if err != nil {
 		return err
 	}
 	return json.Unmarshal([]byte(p), dest)
 }
+
+func (r RedisDB) TTL(key string) (time.Duration, error) {
+	return r.Client.TTL(context.Background(), key).Result()
+}
+
+func (r RedisDB) Del(keys ...string) error {
+	return r.Client.Del(context.Background(), keys...).Err()
+}
+
+func (r RedisDB) LPush(key string, values ...string) error {
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return r.Client.LPush(context.Background(), key, args...).Err()
+}
+
+func (r RedisDB) LRange(key string, start int64, stop int64) ([]string, error) {
+	return r.Client.LRange(context.Background(), key, start, stop).Result()
+}
+
+func (r RedisDB) LTrim(key string, start int64, stop int64) error {
+	return r.Client.LTrim(context.Background(), key, start, stop).Err()
+}
+
+func (r RedisDB) RPopLPush(source string, destination string) (string, error) {
+	value, err := r.Client.RPopLPush(context.Background(), source, destination).Result()
+	if err == redis.Nil {
+		return "", ErrCacheMiss
+	}
+	return value, err
+}
+
+func (r RedisDB) LRem(key string, count int64, value string) error {
+	return r.Client.LRem(context.Background(), key, count, value).Err()
+}
+
+func (r RedisDB) FlushAll() error {
+	return r.Client.FlushAll(context.Background()).Err()
+}
+
+func (r RedisDB) Close() error {
+	return r.Client.Close()
+}
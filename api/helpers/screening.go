@@ -0,0 +1,338 @@
+package helpers
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ivinayakg/shorte.live/api/database"
+)
+
+type ScreeningAction string
+
+const (
+	// ScreeningBlock rejects matching destinations
+	ScreeningBlock ScreeningAction = "block"
+	// ScreeningFlag accepts matching destinations but records the match for admins
+	ScreeningFlag ScreeningAction = "flag"
+)
+
+var ErrUnsafeDestination = errors.New("destination is blocked as unsafe")
+
+// Blocklist is a source of unsafe destinations, Match returns the entry the url
+// matched or "" when it's clean.
+type Blocklist interface {
+	Name() string
+	Match(u *url.URL) string
+}
+
+type blocklistKind string
+
+const (
+	domainBlocklist     blocklistKind = "domains"
+	hashPrefixBlocklist blocklistKind = "hash_prefixes"
+)
+
+// fileBlocklist is a blocklist loaded from a local file, reloaded when the file changes.
+type fileBlocklist struct {
+	kind    blocklistKind
+	path    string
+	modTime time.Time
+	entries map[string]bool
+	// prefixLengths are the distinct hash prefix lengths in the file
+	prefixLengths []int
+	mutex         sync.RWMutex
+}
+
+// NewDomainBlocklist loads a file with one domain per line, hosts file lines like
+// "0.0.0.0 example.com" work too. A domain also blocks its subdomains.
+func NewDomainBlocklist(path string) (Blocklist, error) {
+	list := &fileBlocklist{kind: domainBlocklist, path: path}
+	return list, list.Reload()
+}
+
+// NewHashPrefixBlocklist loads a Safe Browsing style file with one hex encoded
+// SHA256 prefix (4 to 32 bytes) per line, matched against the host suffix and
+// path prefix expressions of the url.
+func NewHashPrefixBlocklist(path string) (Blocklist, error) {
+	list := &fileBlocklist{kind: hashPrefixBlocklist, path: path}
+	return list, list.Reload()
+}
+
+func (l *fileBlocklist) Name() string {
+	return filepath.Base(l.path)
+}
+
+func (l *fileBlocklist) parseLine(line string) (string, error) {
+	fields := strings.Fields(line)
+	entry := fields[len(fields)-1]
+
+	if l.kind == domainBlocklist {
+		return strings.TrimSuffix(strings.ToLower(entry), "."), nil
+	}
+
+	prefix, err := hex.DecodeString(entry)
+	if err != nil || len(prefix) < 4 || len(prefix) > sha256.Size {
+		return "", fmt.Errorf("invalid hash prefix %v", entry)
+	}
+	return string(prefix), nil
+}
+
+// Reload reads the file again, a failed reload keeps the current entries.
+func (l *fileBlocklist) Reload() error {
+	info, err := os.Stat(l.path)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(l.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	entries := map[string]bool{}
+	lengths := map[int]bool{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		entry, err := l.parseLine(text)
+		if err != nil {
+			return fmt.Errorf("%v line %v: %v", l.path, line, err)
+		}
+		entries[entry] = true
+		lengths[len(entry)] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	prefixLengths := []int{}
+	for length := range lengths {
+		prefixLengths = append(prefixLengths, length)
+	}
+	sort.Ints(prefixLengths)
+
+	l.mutex.Lock()
+	l.entries = entries
+	l.prefixLengths = prefixLengths
+	l.modTime = info.ModTime()
+	l.mutex.Unlock()
+
+	fmt.Printf("Loaded %v blocklist %v with %v entries\n", l.kind, l.path, len(entries))
+	return nil
+}
+
+func (l *fileBlocklist) reloadIfChanged() {
+	info, err := os.Stat(l.path)
+	if err != nil {
+		return
+	}
+
+	l.mutex.RLock()
+	changed := !info.ModTime().Equal(l.modTime)
+	l.mutex.RUnlock()
+
+	if changed {
+		if err := l.Reload(); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+func (l *fileBlocklist) Match(u *url.URL) string {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	if l.kind == domainBlocklist {
+		for _, host := range hostSuffixes(u, -1) {
+			if l.entries[host] {
+				return host
+			}
+		}
+		return ""
+	}
+
+	for _, expression := range urlExpressions(u) {
+		sum := sha256.Sum256([]byte(expression))
+		for _, length := range l.prefixLengths {
+			if l.entries[string(sum[:length])] {
+				return expression
+			}
+		}
+	}
+	return ""
+}
+
+// hostSuffixes is the host followed by its parent domains, limited to the last
+// maxComponents components unless maxComponents is negative.
+func hostSuffixes(u *url.URL, maxComponents int) []string {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return nil
+	}
+	if net.ParseIP(host) != nil {
+		return []string{host}
+	}
+
+	suffixes := []string{host}
+	components := strings.Split(host, ".")
+	start := 1
+	if maxComponents > 0 && len(components) > maxComponents {
+		start = len(components) - maxComponents
+	}
+	for i := start; i < len(components)-1; i++ {
+		suffixes = append(suffixes, strings.Join(components[i:], "."))
+	}
+	return suffixes
+}
+
+// urlExpressions are the host suffix and path prefix combinations of the url
+// which Safe Browsing hash prefixes are computed over.
+func urlExpressions(u *url.URL) []string {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	paths := []string{}
+	if u.RawQuery != "" {
+		paths = append(paths, path+"?"+u.RawQuery)
+	}
+	paths = append(paths, path)
+
+	prefix := "/"
+	components := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 0; i < len(components) && i < 4; i++ {
+		if prefix != path {
+			paths = append(paths, prefix)
+		}
+		prefix += components[i] + "/"
+	}
+
+	expressions := []string{}
+	for _, host := range hostSuffixes(u, 5) {
+		for _, p := range paths {
+			expressions = append(expressions, host+p)
+		}
+	}
+	return expressions
+}
+
+// ScreenerType checks destinations against the blocklists.
+type ScreenerType struct {
+	action ScreeningAction
+	lists  []Blocklist
+	mutex  sync.RWMutex
+}
+
+// Screener is nil when no blocklist is configured, Screen then lets everything through.
+var Screener *ScreenerType
+
+func NewScreener(action ScreeningAction) *ScreenerType {
+	return &ScreenerType{action: action}
+}
+
+// AddBlocklist plugs another blocklist into the screener.
+func (s *ScreenerType) AddBlocklist(list Blocklist) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.lists = append(s.lists, list)
+}
+
+// Blocks reports whether matching destinations are rejected instead of flagged.
+func (s *ScreenerType) Blocks() bool {
+	return s != nil && s.action == ScreeningBlock
+}
+
+// Screen returns the first blocklist match of the destination, nil when it's clean.
+func (s *ScreenerType) Screen(destination string) *database.URLScreening {
+	if s == nil {
+		return nil
+	}
+
+	u, err := url.Parse(destination)
+	if err != nil {
+		return nil
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, list := range s.lists {
+		if match := list.Match(u); match != "" {
+			return &database.URLScreening{List: list.Name(), Match: match, ScannedAt: database.UnixTime(time.Now().Unix())}
+		}
+	}
+	return nil
+}
+
+// WatchReload reloads the file blocklists whose file changed.
+func (s *ScreenerType) WatchReload(frequency time.Duration) {
+	ticker := time.NewTicker(frequency)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.mutex.RLock()
+		lists := s.lists
+		s.mutex.RUnlock()
+
+		for _, list := range lists {
+			if fileList, ok := list.(*fileBlocklist); ok {
+				fileList.reloadIfChanged()
+			}
+		}
+	}
+}
+
+// SetupScreener loads the space separated blocklist files of SCREENING_DOMAIN_LISTS
+// and SCREENING_HASH_PREFIX_LISTS, SCREENING_ACTION is block (default) or flag.
+func SetupScreener(reloadFrequency time.Duration) error {
+	domainLists := strings.Fields(os.Getenv("SCREENING_DOMAIN_LISTS"))
+	hashPrefixLists := strings.Fields(os.Getenv("SCREENING_HASH_PREFIX_LISTS"))
+	if len(domainLists) == 0 && len(hashPrefixLists) == 0 {
+		return nil
+	}
+
+	action := ScreeningAction(os.Getenv("SCREENING_ACTION"))
+	if action == "" {
+		action = ScreeningBlock
+	}
+	if action != ScreeningBlock && action != ScreeningFlag {
+		return fmt.Errorf("invalid SCREENING_ACTION %v, use block or flag", action)
+	}
+
+	screener := NewScreener(action)
+	for _, path := range domainLists {
+		list, err := NewDomainBlocklist(path)
+		if err != nil {
+			return err
+		}
+		screener.AddBlocklist(list)
+	}
+	for _, path := range hashPrefixLists {
+		list, err := NewHashPrefixBlocklist(path)
+		if err != nil {
+			return err
+		}
+		screener.AddBlocklist(list)
+	}
+
+	Screener = screener
+	go Screener.WatchReload(reloadFrequency)
+	return nil
+}
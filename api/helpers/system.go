@@ -1,12 +1,9 @@
 package helpers
 
 import (
-	"context"
 	"fmt"
 	"time"
 
-	"github.com/ivinayakg/shorte.live/api/database"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -29,10 +26,10 @@ func GetDefaultSystemConfig() *SystemConfig {
 	}
 }
 
-func GetSystemConfig(revalidateCache bool) *SystemConfig {
+func (c *Config) GetSystemConfig(revalidateCache bool) *SystemConfig {
 	systemConfig := &SystemConfig{}
 
-	err := Redis.GetJSON(string(SystemConfigNameCacheKey), systemConfig)
+	err := Cache.GetJSON(string(SystemConfigNameCacheKey), systemConfig)
 	if err != nil {
 		fmt.Println(err)
 	}
@@ -40,9 +37,7 @@ func GetSystemConfig(revalidateCache bool) *SystemConfig {
 	if systemConfig.ID != primitive.NilObjectID && !revalidateCache {
 		return systemConfig
 	} else {
-		var systemConfigFilters = bson.M{"name": SystemConfigName}
-
-		err = database.CurrentDb.Config.FindOne(context.Background(), systemConfigFilters).Decode(systemConfig)
+		err = c.store.FindByName(string(SystemConfigName), systemConfig)
 		if err != nil && err != mongo.ErrNoDocuments {
 			fmt.Println(err)
 			return nil
@@ -50,23 +45,23 @@ func GetSystemConfig(revalidateCache bool) *SystemConfig {
 
 		if err == mongo.ErrNoDocuments {
 			defaultSystemConfig := GetDefaultSystemConfig()
-			res, err := database.CurrentDb.Config.InsertOne(context.Background(), defaultSystemConfig)
+			id, err := c.store.Insert(defaultSystemConfig)
 			if err != nil {
 				fmt.Println(err)
 				return nil
 			}
 
 			systemConfig = defaultSystemConfig
-			systemConfig.ID = res.InsertedID.(primitive.ObjectID)
+			systemConfig.ID = id
 		}
 
-		Redis.SetJSON(string(SystemConfigNameCacheKey), systemConfig, time.Duration(time.Minute*60))
+		Cache.SetJSON(string(SystemConfigNameCacheKey), systemConfig, time.Duration(time.Minute*60))
 		return systemConfig
 	}
 }
 
-func SystemUnderMaintenance(revalidate bool) bool {
-	systemConfig := GetSystemConfig(revalidate)
+func (c *Config) SystemUnderMaintenance(revalidate bool) bool {
+	systemConfig := c.GetSystemConfig(revalidate)
 	if systemConfig == nil {
 		return false
 	}
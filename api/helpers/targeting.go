@@ -0,0 +1,195 @@
+package helpers
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/avct/uasurfer"
+	"github.com/ivinayakg/shorte.live/api/database"
+)
+
+const MaxURLTargets = 10
+const MaxURLGeoRules = 50
+const MaxURLVariants = 10
+
+// variant ids end up in cookies and stats, keep them plain
+var variantIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+var targetDevices = map[string]uasurfer.DeviceType{
+	"desktop":  uasurfer.DeviceComputer,
+	"tablet":   uasurfer.DeviceTablet,
+	"phone":    uasurfer.DevicePhone,
+	"console":  uasurfer.DeviceConsole,
+	"wearable": uasurfer.DeviceWearable,
+	"tv":       uasurfer.DeviceTV,
+}
+
+var targetOSes = map[string]uasurfer.OSName{
+	"windows":      uasurfer.OSWindows,
+	"windowsphone": uasurfer.OSWindowsPhone,
+	"macos":        uasurfer.OSMacOSX,
+	"ios":          uasurfer.OSiOS,
+	"android":      uasurfer.OSAndroid,
+	"blackberry":   uasurfer.OSBlackberry,
+	"chromeos":     uasurfer.OSChromeOS,
+	"kindle":       uasurfer.OSKindle,
+	"webos":        uasurfer.OSWebOS,
+	"linux":        uasurfer.OSLinux,
+	"playstation":  uasurfer.OSPlaystation,
+	"xbox":         uasurfer.OSXbox,
+	"nintendo":     uasurfer.OSNintendo,
+}
+
+// ValidateURLTargets checks the targeting rules of a url, normalising the device,
+// os and destination of each rule in place.
+func ValidateURLTargets(targets []database.URLTarget) error {
+	if len(targets) > MaxURLTargets {
+		return fmt.Errorf("a url can have at most %v targets", MaxURLTargets)
+	}
+
+	for i := range targets {
+		target := &targets[i]
+		target.Device = strings.ToLower(strings.TrimSpace(target.Device))
+		target.OS = strings.ToLower(strings.TrimSpace(target.OS))
+
+		if target.Device == "" && target.OS == "" {
+			return fmt.Errorf("target %v needs a device or an os", i+1)
+		}
+		if _, found := targetDevices[target.Device]; target.Device != "" && !found {
+			return fmt.Errorf("invalid target device %v", target.Device)
+		}
+		if _, found := targetOSes[target.OS]; target.OS != "" && !found {
+			return fmt.Errorf("invalid target os %v", target.OS)
+		}
+		if !govalidator.IsURL(target.Destination) || !RemoverDomainError(target.Destination) {
+			return fmt.Errorf("invalid target url")
+		}
+		target.Destination = EnforceHTTP(target.Destination)
+	}
+
+	return nil
+}
+
+// ValidateURLGeoRules checks the country rules of a url, normalising the country
+// code and destination of each rule in place.
+func ValidateURLGeoRules(rules []database.URLGeoRule) error {
+	if len(rules) > MaxURLGeoRules {
+		return fmt.Errorf("a url can have at most %v geo rules", MaxURLGeoRules)
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+		rule.Country = strings.ToUpper(strings.TrimSpace(rule.Country))
+
+		if len(rule.Country) != 2 || !govalidator.IsAlpha(rule.Country) {
+			return fmt.Errorf("invalid geo rule country %v, use an ISO 3166 alpha-2 code", rule.Country)
+		}
+		if !govalidator.IsURL(rule.Destination) || !RemoverDomainError(rule.Destination) {
+			return fmt.Errorf("invalid geo rule url")
+		}
+		rule.Destination = EnforceHTTP(rule.Destination)
+	}
+
+	return nil
+}
+
+// ValidateURLVariants checks the A/B variants of a url, normalising the destination
+// of each variant in place. Variants without an id are numbered v1, v2...
+func ValidateURLVariants(variants []database.URLVariant) error {
+	if len(variants) == 0 {
+		return nil
+	}
+	if len(variants) < 2 || len(variants) > MaxURLVariants {
+		return fmt.Errorf("a url can have between 2 and %v variants", MaxURLVariants)
+	}
+
+	ids := map[string]bool{}
+	for i := range variants {
+		variant := &variants[i]
+		variant.ID = strings.TrimSpace(variant.ID)
+		if variant.ID == "" {
+			variant.ID = fmt.Sprintf("v%v", i+1)
+		}
+
+		if !variantIDPattern.MatchString(variant.ID) {
+			return fmt.Errorf("invalid variant id %v", variant.ID)
+		}
+		if ids[variant.ID] {
+			return fmt.Errorf("duplicate variant id %v", variant.ID)
+		}
+		ids[variant.ID] = true
+
+		if variant.Weight <= 0 {
+			return fmt.Errorf("variant %v needs a positive weight", variant.ID)
+		}
+		if !govalidator.IsURL(variant.Destination) || !RemoverDomainError(variant.Destination) {
+			return fmt.Errorf("invalid variant url")
+		}
+		variant.Destination = EnforceHTTP(variant.Destination)
+	}
+
+	return nil
+}
+
+// PickVariant draws a variant by weight, the sticky id of a returning visitor
+// is kept as long as the variant still exists. It returns nil without variants.
+func PickVariant(variants []database.URLVariant, sticky string) *database.URLVariant {
+	total := 0
+	for i := range variants {
+		if sticky != "" && variants[i].ID == sticky {
+			return &variants[i]
+		}
+		total += variants[i].Weight
+	}
+	if total <= 0 {
+		return nil
+	}
+
+	draw := rand.Intn(total)
+	for i := range variants {
+		if draw < variants[i].Weight {
+			return &variants[i]
+		}
+		draw -= variants[i].Weight
+	}
+	return nil
+}
+
+// ResolveDestination picks where to send the visitor, the first matching device
+// target wins, then the first geo rule of the visitor's country and the default
+// destination of the url when none match. country is the ISO code of the
+// visitor, empty when it's unknown. The id of the chosen rule is returned along.
+func ResolveDestination(url *database.URL, ua *uasurfer.UserAgent, country string) (string, string) {
+	for _, target := range url.Targets {
+		if target.Device != "" && targetDevices[target.Device] != ua.DeviceType {
+			continue
+		}
+		if target.OS != "" && targetOSes[target.OS] != ua.OS.Name {
+			continue
+		}
+		return target.Destination, target.ID()
+	}
+
+	if country != "" {
+		for _, rule := range url.GeoRules {
+			if rule.Country == country {
+				return rule.Destination, rule.ID()
+			}
+		}
+	}
+
+	return url.Destination, database.DefaultClickRule
+}
+
+// VisitorCountry is the ISO code of the country of the ip, empty when it's
+// unknown or no geo database is configured.
+func VisitorCountry(ip string) string {
+	country := Geo.Lookup(ip)
+	if country == nil {
+		return ""
+	}
+	return strings.ToUpper(country.ISOCode)
+}
@@ -3,8 +3,8 @@ package helpers
 import (
 	"context"
 	"fmt"
-	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ivinayakg/shorte.live/api/database"
@@ -16,81 +16,257 @@ type TrackEventType string
 
 const track_event_redis_key = "track_event"
 
+// events are moved one by one into the processing list before they are inserted
+// and only removed from it once the insert succeeded
+const track_event_processing_redis_key = "track_event_processing"
+
+// batches which failed to insert maxAttempts times, kept for manual replay
+const track_event_dead_letter_redis_key = "track_event_dead_letter"
+
+const trackerDefaultMaxAttempts = 5
+const trackerDefaultRetryBackoff = time.Second * 5
+const trackerMaxRetryBackoff = time.Minute * 5
+
+// trackerBatch is the set of events currently in the processing list
+type trackerBatch struct {
+	values      []string
+	attempts    int
+	nextAttempt time.Time
+}
+
 type TrackerType struct {
 	maxEvents      int
-	eventsLength   int
+	eventsLength   int64
 	flushFrequency time.Duration
-	mutex          sync.Mutex
+	maxAttempts    int
+	retryBackoff   time.Duration
+	insert         func(events []*database.ClickEvent) error
+	ready          func() bool
+	// onInserted is called with every batch once it's stored
+	onInserted func(events []*database.ClickEvent)
+	batch      *trackerBatch
+	lastFlush  time.Time
+	lastError  string
+	mutex      sync.Mutex
 }
 
 var Tracker *TrackerType
 
-func flushToDB(events []*database.ClickEvent) {
+// claimBatch moves up to maxEvents of the oldest queued events into the processing list
+func (eq *TrackerType) claimBatch() (*trackerBatch, error) {
+	batch := &trackerBatch{}
+	for len(batch.values) < eq.maxEvents {
+		value, err := Cache.RPopLPush(track_event_redis_key, track_event_processing_redis_key)
+		if err == ErrCacheMiss {
+			break
+		}
+		if err != nil {
+			return batch, err
+		}
+		batch.values = append(batch.values, value)
+	}
+	atomic.AddInt64(&eq.eventsLength, -int64(len(batch.values)))
+	return batch, nil
+}
+
+// ack removes the batch from the processing list once it's stored
+func (eq *TrackerType) ack(batch *trackerBatch) {
+	for _, value := range batch.values {
+		if err := Cache.LRem(track_event_processing_redis_key, 1, value); err != nil {
+			fmt.Println("Failed to acknowledge click event", err)
+		}
+	}
+}
+
+func (eq *TrackerType) deadLetter(batch *trackerBatch) {
+	if err := Cache.LPush(track_event_dead_letter_redis_key, batch.values...); err != nil {
+		fmt.Println("Failed to dead letter click events", err)
+		return
+	}
+	eq.ack(batch)
+	fmt.Printf("Dead lettered %v click events after %v attempts\n", len(batch.values), batch.attempts)
+}
+
+func (eq *TrackerType) backoff(attempts int) time.Duration {
+	backoff := eq.retryBackoff
+	for i := 1; i < attempts && backoff < trackerMaxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > trackerMaxRetryBackoff {
+		backoff = trackerMaxRetryBackoff
+	}
+	return backoff
+}
+
+// process tries to insert the batch, it returns false when the batch has to be retried later
+func (eq *TrackerType) process(batch *trackerBatch) bool {
+	var events []*database.ClickEvent
+	var values []string
+	for _, v := range batch.values {
+		var temp database.ClickEvent
+		if err := bson.Unmarshal([]byte(v), &temp); err != nil {
+			// a corrupt event will never insert, don't hold the rest of the batch back for it
+			fmt.Println("Failed to decode click event", err)
+			eq.deadLetter(&trackerBatch{values: []string{v}, attempts: batch.attempts})
+			continue
+		}
+		events = append(events, &temp)
+		values = append(values, v)
+	}
+	batch.values = values
+
 	if len(events) > 0 {
-		if err := timescale.InsertClickEventsBulk(events); err != nil {
-			log.Fatal(err)
+		if err := eq.insert(events); err != nil {
+			batch.attempts++
+			if batch.attempts >= eq.maxAttempts {
+				eq.lastError = err.Error()
+				eq.deadLetter(batch)
+				return true
+			}
+			eq.lastError = err.Error()
+			batch.nextAttempt = time.Now().Add(eq.backoff(batch.attempts))
+			fmt.Printf("Failed to insert click events (attempt %v), retrying at %v: %v\n", batch.attempts, batch.nextAttempt, err)
+			return false
+		}
+		if eq.onInserted != nil {
+			eq.onInserted(events)
 		}
 	}
+
+	eq.ack(batch)
+	eq.lastFlush = time.Now()
+	eq.lastError = ""
+	return true
 }
 
-func (eq *TrackerType) flush() {
+// Flush inserts the queued events batch by batch until the queue is drained or an
+// insert fails, a failed batch stays in the processing list until its retry is due.
+// Nothing is flushed while the database isn't ready, the events stay queued.
+func (eq *TrackerType) Flush() {
 	eq.mutex.Lock()
 	defer eq.mutex.Unlock()
 
-	jsondata, err := Redis.Client.LRange(context.TODO(), track_event_redis_key, 0, int64(eq.eventsLength)).Result()
-	if err != nil {
-		log.Fatal(err)
+	if !eq.ready() {
+		return
 	}
 
-	Redis.Client.LTrim(context.TODO(), track_event_redis_key, int64(eq.eventsLength), -1)
-	eq.eventsLength = 0
-
-	var data []*database.ClickEvent
+	for {
+		if eq.batch == nil {
+			batch, err := eq.claimBatch()
+			if len(batch.values) == 0 {
+				if err != nil {
+					fmt.Println("Failed to claim click events", err)
+				}
+				return
+			}
+			eq.batch = batch
+		}
 
-	for _, v := range jsondata {
-		var temp database.ClickEvent
-		bson.Unmarshal([]byte(v), &temp)
-		data = append(data, &temp)
+		if time.Now().Before(eq.batch.nextAttempt) || !eq.process(eq.batch) {
+			return
+		}
+		eq.batch = nil
 	}
-
-	go flushToDB(data)
 }
 
-func (eq *TrackerType) CaptureRedirectEvent(device string, ip string, os string, referrer string, urlId string, timestamp int64) {
-	fmt.Println(ip)
-	// add the ip-2-geo location handler here
-	geo := "null"
+func (eq *TrackerType) CaptureRedirectEvent(device string, ip string, os string, referrer string, urlId string, rule string, variant string, timestamp int64) {
+	geo := Geo.LookupCountry(ip)
 
-	data := database.ClickEvent{URLId: urlId, Device: device, Geo: database.CountryName(geo), OS: os, Referrer: referrer, Timestamp: database.UnixTime(timestamp)}
+	data := database.ClickEvent{URLId: urlId, Device: device, Geo: geo, OS: os, Referrer: referrer, Rule: rule, Variant: variant, Timestamp: database.UnixTime(timestamp)}
 
 	jsonData, _ := bson.Marshal(data)
 
-	// Push the entire slice as a single element into the Redis list
-	err := Redis.Client.LPush(context.TODO(), track_event_redis_key, jsonData).Err()
+	// Push the entire slice as a single element into the cache list
+	err := Cache.LPush(track_event_redis_key, string(jsonData))
 	if err != nil {
-		log.Fatal(err)
+		fmt.Println("Failed to queue click event", err)
+		return
+	}
+
+	if atomic.AddInt64(&eq.eventsLength, 1) >= int64(eq.maxEvents) {
+		eq.Flush()
 	}
+}
+
+// SetRetryPolicy sets after how many failed inserts a batch is dead lettered and
+// the backoff before the first retry, which doubles with every further attempt.
+func (eq *TrackerType) SetRetryPolicy(maxAttempts int, retryBackoff time.Duration) {
+	eq.mutex.Lock()
+	defer eq.mutex.Unlock()
+
+	eq.maxAttempts = maxAttempts
+	eq.retryBackoff = retryBackoff
+}
+
+// SetInsertFunc replaces the TimescaleDB insert, used to run the tracker without a database.
+func (eq *TrackerType) SetInsertFunc(insert func(events []*database.ClickEvent) error) {
+	eq.mutex.Lock()
+	defer eq.mutex.Unlock()
+
+	eq.insert = insert
+	eq.ready = func() bool { return true }
+}
 
-	eq.eventsLength += 1
-	if eq.eventsLength >= eq.maxEvents {
-		eq.flush()
+// SetInsertHook sets the function called with the click events of every stored batch.
+func (eq *TrackerType) SetInsertHook(hook func(events []*database.ClickEvent)) {
+	eq.mutex.Lock()
+	defer eq.mutex.Unlock()
+
+	eq.onInserted = hook
+}
+
+func (eq *TrackerType) status() (lastFlush database.UnixTime, failedAttempts int, lastError string) {
+	eq.mutex.Lock()
+	defer eq.mutex.Unlock()
+
+	if !eq.lastFlush.IsZero() {
+		lastFlush = database.UnixTime(eq.lastFlush.Unix())
 	}
+	if eq.batch != nil {
+		failedAttempts = eq.batch.attempts
+	}
+	return lastFlush, failedAttempts, eq.lastError
 }
 
-func (eq *TrackerType) StartFlush() {
+// StartFlush flushes the queued click events periodically until ctx is cancelled.
+func (eq *TrackerType) StartFlush(ctx context.Context) {
 	ticker := time.NewTicker(eq.flushFrequency)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		eq.flush()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		eq.Flush()
+	}
+}
+
+// recover picks up the events left in the processing list by a previous run,
+// they are retried before any newly queued event. Events in flight on another
+// instance sharing the cache get picked up too, so they may be inserted twice.
+func (eq *TrackerType) recover() {
+	values, err := Cache.LRange(track_event_processing_redis_key, 0, -1)
+	if err != nil {
+		fmt.Println("Failed to recover click events", err)
+		return
+	}
+	if len(values) > 0 {
+		fmt.Printf("Recovered %v unacknowledged click events\n", len(values))
+		eq.batch = &trackerBatch{values: values}
 	}
 }
 
 func SetupTracker(dur time.Duration, maxEvents int, eventsLength int) {
-	Redis.Client.LTrim(context.TODO(), track_event_redis_key, int64(eventsLength), -1)
 	Tracker = &TrackerType{
 		maxEvents:      maxEvents,
-		eventsLength:   eventsLength,
+		eventsLength:   int64(eventsLength),
 		flushFrequency: dur,
+		maxAttempts:    trackerDefaultMaxAttempts,
+		retryBackoff:   trackerDefaultRetryBackoff,
+		insert:         timescale.InsertClickEventsBulk,
+		ready:          timescale.Connected,
 	}
+	Tracker.recover()
 }
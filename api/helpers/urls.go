@@ -1,12 +1,19 @@
 package helpers
 
 import (
+	"fmt"
+	neturl "net/url"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/ivinayakg/shorte.live/api/constants"
+	"github.com/ivinayakg/shorte.live/api/database"
 )
 
+// query parameters of the short url which are meant for the api, they are never forwarded
+var resolveQueryParams = map[string]bool{"revalidate": true}
+
 func EnforceHTTP(url string) string {
 	if url[:4] != "http" {
 		return "https://" + url
@@ -32,8 +39,97 @@ func RemoverDomainError(url string) bool {
 }
 
 func BuildUrl(url string) string {
+	return BuildDomainUrl("", url)
+}
+
+// BuildDomainUrl builds the url on a custom domain, an empty domain is SHORTED_URL_DOMAIN.
+func BuildDomainUrl(domain string, url string) string {
+	if domain == "" {
+		domain = os.Getenv("SHORTED_URL_DOMAIN")
+	}
 	if ENV != string(constants.Prod) {
-		return "http://" + os.Getenv("SHORTED_URL_DOMAIN") + url
+		return "http://" + domain + url
+	}
+	return "https://" + domain + url
+}
+
+const maxUTMLength = 250
+
+// NormalizeURLUTM trims the utm tags, it returns nil when none are set.
+func NormalizeURLUTM(utm *database.URLUTM) (*database.URLUTM, error) {
+	if utm == nil {
+		return nil, nil
+	}
+
+	normalized := *utm
+	fields := []*string{&normalized.Source, &normalized.Medium, &normalized.Campaign, &normalized.Term, &normalized.Content}
+	empty := true
+	for _, field := range fields {
+		*field = strings.TrimSpace(*field)
+		if len(*field) > maxUTMLength {
+			return nil, fmt.Errorf("utm tags can be at most %v characters", maxUTMLength)
+		}
+		empty = empty && *field == ""
+	}
+	if empty {
+		return nil, nil
+	}
+	return &normalized, nil
+}
+
+// BuildDestination adds the utm tags and the forwarded query parameters to the
+// destination, each replacing a parameter of the same name the destination
+// already has, with the forwarded ones winning over the tags. The other
+// parameters keep their order and the fragment stays at the end.
+func BuildDestination(destination string, utm *database.URLUTM, forwarded neturl.Values) string {
+	params := neturl.Values{}
+	if utm != nil {
+		for key, value := range map[string]string{"utm_source": utm.Source, "utm_medium": utm.Medium, "utm_campaign": utm.Campaign, "utm_term": utm.Term, "utm_content": utm.Content} {
+			if value != "" {
+				params.Set(key, value)
+			}
+		}
+	}
+	for key, values := range forwarded {
+		if !resolveQueryParams[key] {
+			params[key] = values
+		}
+	}
+	if len(params) == 0 {
+		return destination
+	}
+
+	parsed, err := neturl.Parse(destination)
+	if err != nil {
+		return destination
 	}
-	return "https://" + os.Getenv("SHORTED_URL_DOMAIN") + url
+
+	query := []string{}
+	for _, pair := range strings.Split(parsed.RawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		key, _, _ := strings.Cut(pair, "=")
+		if unescaped, err := neturl.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+		if _, replaced := params[key]; !replaced {
+			query = append(query, pair)
+		}
+	}
+
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range params[key] {
+			query = append(query, neturl.QueryEscape(key)+"="+neturl.QueryEscape(value))
+		}
+	}
+
+	parsed.RawQuery = strings.Join(query, "&")
+	parsed.ForceQuery = false
+	return parsed.String()
 }
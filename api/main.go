@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -14,24 +19,30 @@ import (
 	"github.com/ivinayakg/shorte.live/api/database"
 	"github.com/ivinayakg/shorte.live/api/helpers"
 	"github.com/ivinayakg/shorte.live/api/middleware"
+	"github.com/ivinayakg/shorte.live/api/models"
 	"github.com/ivinayakg/shorte.live/api/routes"
 	"github.com/ivinayakg/shorte.live/api/timescale"
 	"github.com/joho/godotenv"
 	"github.com/rs/cors"
 )
 
-func setupRoutes(router *mux.Router) {
-	routes.UserRoutes(router.PathPrefix("/user").Subrouter())
-	routes.URLResolveRoutes(router)
-	routes.URLRoutes(router.PathPrefix("/url").Subrouter())
-	router.HandleFunc("/system/available", controllers.SystemAvailable).Methods("GET")
+func setupRoutes(router *mux.Router, m *models.Models, h *controllers.Handler) {
+	routes.UserRoutes(router.PathPrefix("/user").Subrouter(), m, h)
+	routes.URLRoutes(router.PathPrefix("/url").Subrouter(), m, h)
+	routes.WorkspaceRoutes(router.PathPrefix("/workspace").Subrouter(), m, h)
+	routes.DomainRoutes(router.PathPrefix("/domain").Subrouter(), m, h)
+	routes.WebhookRoutes(router.PathPrefix("/webhook").Subrouter(), m, h)
+	routes.AdminRoutes(router.PathPrefix("/admin").Subrouter(), m, h)
+	routes.URLResolveRoutes(router, h)
+	router.HandleFunc("/system/available", h.SystemAvailable).Methods("GET")
+	router.HandleFunc("/system/health", controllers.SystemHealth).Methods("GET")
 	router.NotFoundHandler = http.HandlerFunc(controllers.NotFound)
 	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		http.ServeFile(w, r, "static/index.html")
 	}).Methods("GET", "POST", "PATCH", "DELETE")
 }
 
-func createRouter() *http.Handler {
+func createRouter(m *models.Models, h *controllers.Handler) *http.Handler {
 	allowed_origins := strings.Split(os.Getenv("ALLOWED_ORIGINS"), " ")
 	corsHandler := cors.New(cors.Options{
 		AllowedOrigins:   allowed_origins,
@@ -42,9 +53,9 @@ func createRouter() *http.Handler {
 
 	r := mux.NewRouter()
 	r.Use(middleware.LogMW)
-	r.Use(middleware.OriginHandler)
+	r.Use(middleware.OriginHandler(m))
 
-	setupRoutes(r)
+	setupRoutes(r, m, h)
 	routerProtected := corsHandler.Handler(r)
 	return &routerProtected
 }
@@ -58,25 +69,113 @@ func main() {
 	PORT := os.Getenv("PORT")
 	helpers.ENV = os.Getenv("ENV")
 
-	database.CreateDBInstance()
-	helpers.RedisSetup()
+	store, err := database.CreateStore(os.Getenv("DB_BACKEND"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	m := models.New(store)
+	h := controllers.NewHandler(m)
 
-	if helpers.ENV != string(constants.Prod) {
-		timescale.SetupTimeScale()
+	helpers.CacheSetup()
+
+	if err := helpers.SetupGeo(time.Minute); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := helpers.SetupScreener(time.Minute); err != nil {
+		log.Fatal(err)
+	}
+
+	// the periodic loops are stopped by shutdown before the final flushes
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	startWorker := func(run func(ctx context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(workersCtx)
+		}()
+	}
+
+	m.SetupVisitRecorder(time.Second * 10)
+	startWorker(m.Visits.StartFlush)
+
+	m.SetupWebhookDispatcher(time.Second*10, time.Second*30)
+	startWorker(m.Webhooks.StartDelivery)
+
+	// cancelled on a signal, so the timescale retry is stopped before shutdown closes the pool
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if helpers.AnalyticsEnabled() {
+		// clicks keep being queued in the cache while TimescaleDB is unreachable
+		if err := timescale.SetupTimeScale(); err != nil {
+			fmt.Println("TimescaleDB unavailable, analytics degraded:", err)
+			go timescale.RetrySetupTimeScale(ctx, time.Second*30)
+		}
 		helpers.SetupTracker(time.Second*10, 200, 0)
-		go helpers.Tracker.StartFlush()
+		helpers.Tracker.SetInsertHook(m.DispatchClickEvents)
+		startWorker(helpers.Tracker.StartFlush)
+	}
+
+	servers := []*http.Server{{Addr: fmt.Sprintf(":%v", PORT), Handler: *createRouter(m, h)}}
+	if helpers.ENV != string(constants.Prod) {
+		servers = append(servers, &http.Server{Addr: fmt.Sprintf(":%v", 5100), Handler: *createRouter(m, h)})
 	}
 
-	go func() {
-		if os.Getenv("ENV") == string(constants.Prod) {
-			return
+	for _, server := range servers {
+		go func(server *http.Server) {
+			fmt.Println("Starting the server on " + server.Addr)
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fmt.Println("Server failed:", err)
+				stop()
+			}
+		}(server)
+	}
+
+	<-ctx.Done()
+	stop()
+	shutdown(servers, store, m, func() {
+		stopWorkers()
+		workers.Wait()
+	})
+}
+
+// shutdown stops accepting connections, drains the in-flight requests and background
+// work, flushes the pending clicks and disconnects mongo, redis and timescale in order.
+func shutdown(servers []*http.Server, store *database.Store, m *models.Models, stopWorkers func()) {
+	timeout := time.Second * 30
+	if seconds, err := strconv.Atoi(os.Getenv("SHUTDOWN_TIMEOUT")); err == nil && seconds > 0 {
+		timeout = time.Second * time.Duration(seconds)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	fmt.Println("Shutting down")
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			fmt.Println("Server shutdown failed:", err)
 		}
-		router := createRouter()
-		fmt.Println("Starting the server on port " + "5100")
-		log.Fatal(http.ListenAndServe(fmt.Sprintf(":%v", 5100), *router))
-	}()
-
-	router := createRouter()
-	fmt.Println("Starting the server on port " + PORT)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%v", PORT), *router))
+	}
+
+	if err := helpers.WaitBackground(ctx); err != nil {
+		fmt.Println("Background work didn't finish:", err)
+	}
+
+	// an in flight tick finishes first, so the last flushes don't race it
+	stopWorkers()
+
+	if helpers.Tracker != nil {
+		helpers.Tracker.Flush()
+	}
+	m.Visits.Flush()
+
+	if err := store.Close(ctx); err != nil {
+		fmt.Println("MongoDB disconnect failed:", err)
+	}
+	if err := helpers.Cache.Close(); err != nil {
+		fmt.Println("Redis disconnect failed:", err)
+	}
+	timescale.Close()
+	fmt.Println("Shutdown complete")
 }
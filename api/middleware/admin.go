@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/ivinayakg/shorte.live/api/database"
+	"github.com/ivinayakg/shorte.live/api/helpers"
+)
+
+// AdminOnly lets through the users listed in ADMIN_EMAILS, it runs after Authentication.
+func AdminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value(UserAuthKey).(*database.User)
+		if !ok || !helpers.IsAdmin(user.Email) {
+			helpers.SendJSONError(w, http.StatusForbidden, "admin access required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
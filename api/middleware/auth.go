@@ -7,7 +7,9 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/gorilla/mux"
 	"github.com/ivinayakg/shorte.live/api/constants"
+	"github.com/ivinayakg/shorte.live/api/database"
 	"github.com/ivinayakg/shorte.live/api/helpers"
 	"github.com/ivinayakg/shorte.live/api/models"
 	"github.com/ivinayakg/shorte.live/api/utils"
@@ -18,9 +20,39 @@ type userAuth string
 
 const UserAuthKey userAuth = "User"
 
-func Authentication(next http.Handler) http.Handler {
+func authError(w http.ResponseWriter, errMsg string) {
+	helpers.SendJSONError(w, http.StatusForbidden, errMsg)
+	log.Println(errMsg)
+}
+
+// Authentication accepts the session cookie, and outside of prod a jwt bearer token.
+func Authentication(m *models.Models) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return authentication(m, next, "", "")
+	}
+}
+
+// APIKeyAuthentication also accepts API keys as bearer tokens in every environment,
+// GET requests need the read scope on the key and everything else the write scope.
+func APIKeyAuthentication(m *models.Models, readScope database.APIKeyScope, writeScope database.APIKeyScope) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return authentication(m, next, readScope, writeScope)
+	}
+}
+
+func authentication(m *models.Models, next http.Handler, readScope database.APIKeyScope, writeScope database.APIKeyScope) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var token string
+		bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		if utils.IsAPIKey(bearer) {
+			if readScope == "" {
+				authError(w, "Authentication error!, API keys can't be used here")
+				return
+			}
+			apiKeyAuthentication(m, next, w, r, bearer, readScope, writeScope)
+			return
+		}
 
 		cookie := utils.GetCookie(r)
 		if cookie != nil {
@@ -28,20 +60,16 @@ func Authentication(next http.Handler) http.Handler {
 		} else if helpers.ENV != string(constants.Prod) {
 			tokenHeader := strings.Split(r.Header.Get("Authorization"), "Bearer ")
 			if len(tokenHeader) < 2 {
-				errMsg := "Authentication error!, Provide valid auth token"
-				helpers.SendJSONError(w, http.StatusForbidden, errMsg)
-				log.Println(errMsg)
+				authError(w, "Authentication error!, Provide valid auth token")
 				return
 			}
 			token = tokenHeader[1]
 		} else {
-			errMsg := "Authentication error!, login first"
-			helpers.SendJSONError(w, http.StatusForbidden, errMsg)
-			log.Println(errMsg)
+			authError(w, "Authentication error!, login first")
 			return
 		}
 
-		systemNotAvailable := helpers.SystemUnderMaintenance(false)
+		systemNotAvailable := m.Config.SystemUnderMaintenance(false)
 		if systemNotAvailable {
 			error := fmt.Errorf("system is under maintenance")
 			helpers.SendJSONError(w, http.StatusServiceUnavailable, error.Error())
@@ -50,20 +78,17 @@ func Authentication(next http.Handler) http.Handler {
 
 		verifyUserData, err := utils.VerifyJwt(token)
 		if err != nil {
-			errMsg := err.Error()
-			helpers.SendJSONError(w, http.StatusForbidden, errMsg)
-			log.Println(errMsg)
+			authError(w, err.Error())
 			return
 		}
 
-		user, err := models.GetUser((*verifyUserData)["email"])
+		user, err := m.GetUser((*verifyUserData)["email"])
 		if err != nil {
 			errMsg := err.Error()
 			if err != mongo.ErrNoDocuments {
 				errMsg = "Authentication error!"
 			}
-			helpers.SendJSONError(w, http.StatusForbidden, errMsg)
-			log.Println(errMsg)
+			authError(w, errMsg)
 			return
 		}
 
@@ -75,3 +100,35 @@ func Authentication(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r.WithContext(c))
 	})
 }
+
+func apiKeyAuthentication(m *models.Models, next http.Handler, w http.ResponseWriter, r *http.Request, plainKey string, readScope database.APIKeyScope, writeScope database.APIKeyScope) {
+	systemNotAvailable := m.Config.SystemUnderMaintenance(false)
+	if systemNotAvailable {
+		error := fmt.Errorf("system is under maintenance")
+		helpers.SendJSONError(w, http.StatusServiceUnavailable, error.Error())
+		return
+	}
+
+	user, key, err := m.AuthenticateAPIKey(plainKey)
+	if err != nil {
+		errMsg := "Authentication error!, invalid API key"
+		if err != mongo.ErrNoDocuments {
+			errMsg = "Authentication error!"
+		}
+		authError(w, errMsg)
+		return
+	}
+
+	scope := writeScope
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		scope = readScope
+	}
+	if !key.HasScope(scope) {
+		authError(w, fmt.Sprintf("Authentication error!, API key is missing the %v scope", scope))
+		return
+	}
+
+	c := context.WithValue(r.Context(), UserAuthKey, user)
+	c = context.WithValue(c, helpers.APIKeyAuthKey, key)
+	next.ServeHTTP(w, r.WithContext(c))
+}
@@ -4,19 +4,26 @@ import (
 	"net/http"
 	"os"
 	"regexp"
+
+	"github.com/gorilla/mux"
+	"github.com/ivinayakg/shorte.live/api/models"
 )
 
 var re = regexp.MustCompile(`^/[^/]+$`)
 
-func OriginHandler(next http.Handler) http.Handler {
-	var RedirectServiceUrl = os.Getenv("SHORTED_URL_DOMAIN")
-	notFoundUrl := os.Getenv("UI_NOT_FOUND_URL")
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Host == RedirectServiceUrl && !re.MatchString(r.URL.Path) && r.URL.Path != "/" {
-			w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-			http.Redirect(w, r, notFoundUrl, http.StatusTemporaryRedirect)
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
+// OriginHandler only lets short links through on the short domain and on the
+// verified custom domains, anything else there goes to the not found page.
+func OriginHandler(m *models.Models) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		var RedirectServiceUrl = os.Getenv("SHORTED_URL_DOMAIN")
+		notFoundUrl := os.Getenv("UI_NOT_FOUND_URL")
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !re.MatchString(r.URL.Path) && r.URL.Path != "/" && (r.Host == RedirectServiceUrl || m.RequestDomain(r.Host) != "") {
+				w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+				http.Redirect(w, r, notFoundUrl, http.StatusTemporaryRedirect)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
 }
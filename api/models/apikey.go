@@ -0,0 +1,93 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ivinayakg/shorte.live/api/database"
+	"github.com/ivinayakg/shorte.live/api/helpers"
+	"github.com/ivinayakg/shorte.live/api/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+// last used is only written once per interval to keep busy keys from writing on every request
+const apiKeyLastUsedInterval = time.Minute
+
+// CreateAPIKey mints a key for the user, the returned plain key isn't stored and
+// can't be shown again.
+func (m *Models) CreateAPIKey(user *database.User, name string, scopes []database.APIKeyScope, rateLimit *database.APIKeyRateLimit) (string, *database.APIKey, error) {
+	plainKey, prefix, hash, err := utils.GenerateAPIKey()
+	if err != nil {
+		fmt.Println(err)
+		return "", nil, err
+	}
+
+	key := &database.APIKey{
+		User:      user.ID,
+		Name:      name,
+		Prefix:    prefix,
+		Hash:      hash,
+		Scopes:    scopes,
+		RateLimit: rateLimit,
+		CreatedAt: database.UnixTime(time.Now().Unix()),
+	}
+
+	if err := m.store.APIKey.Insert(key); err != nil {
+		fmt.Println(err)
+		return "", nil, err
+	}
+
+	fmt.Printf("API key created with id %v\n", key.ID)
+	return plainKey, key, nil
+}
+
+func (m *Models) GetUserAPIKeys(userId primitive.ObjectID) ([]*database.APIKey, error) {
+	return m.store.APIKey.FindByUser(userId)
+}
+
+func (m *Models) DeleteAPIKey(userId primitive.ObjectID, keyId string) error {
+	keyObjectId, err := primitive.ObjectIDFromHex(keyId)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	deleted, err := m.store.APIKey.Delete(keyObjectId, userId)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	if deleted == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	fmt.Printf("API key revoked %v\n", keyId)
+	return nil
+}
+
+// AuthenticateAPIKey looks up the key and its user, revoked keys are gone from the m.store.
+func (m *Models) AuthenticateAPIKey(plainKey string) (*database.User, *database.APIKey, error) {
+	key, err := m.store.APIKey.FindByHash(utils.HashAPIKey(plainKey))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := m.store.User.FindByID(key.User)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	if now.Sub(time.Unix(int64(key.LastUsed), 0)) > apiKeyLastUsedInterval {
+		helpers.Background(func() {
+			if err := m.store.APIKey.SetLastUsed(key.ID, database.UnixTime(now.Unix())); err != nil {
+				fmt.Println(err)
+			}
+		})
+	}
+
+	return user, key, nil
+}
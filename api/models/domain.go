@@ -0,0 +1,243 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ivinayakg/shorte.live/api/database"
+	"github.com/ivinayakg/shorte.live/api/helpers"
+	"github.com/ivinayakg/shorte.live/api/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ErrDomainNotFound = errors.New("domain not found")
+var ErrDomainExists = errors.New("domain is already registered")
+var ErrDomainNotVerified = errors.New("domain is not verified")
+var ErrDomainTokenNotFound = errors.New("verification token not found in the domain TXT records")
+
+const domainLookupTimeout = time.Second * 10
+
+// resolved hosts are cached so routing by host doesn't hit the store on every redirect
+const domainCacheExpiry = time.Minute * 5
+
+func domainCacheKey(host string) string {
+	return "domain-" + host
+}
+
+// RegisterDomain adds an unverified domain for the user, it can be used once
+// VerifyDomain finds its token.
+func (m *Models) RegisterDomain(user *database.User, host string) (*database.Domain, error) {
+	_, err := m.store.Domain.FindOne(database.DomainFilter{User: user.ID, Host: host})
+	if err == nil {
+		return nil, ErrDomainExists
+	}
+	if err != mongo.ErrNoDocuments {
+		fmt.Println(err)
+		return nil, err
+	}
+
+	token, err := utils.GenerateDomainToken()
+	if err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+
+	domain := &database.Domain{
+		User:      user.ID,
+		Host:      host,
+		Token:     token,
+		CreatedAt: database.UnixTime(time.Now().Unix()),
+	}
+
+	if err := m.store.Domain.Insert(domain); err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+
+	fmt.Printf("Domain registered with id %v\n", domain.ID)
+	return domain, nil
+}
+
+func (m *Models) GetUserDomains(userId primitive.ObjectID) ([]*database.Domain, error) {
+	return m.store.Domain.Find(database.DomainFilter{User: userId})
+}
+
+func (m *Models) getUserDomain(userId primitive.ObjectID, domainId string) (*database.Domain, error) {
+	domainObjectId, err := primitive.ObjectIDFromHex(domainId)
+	if err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+
+	domain, err := m.store.Domain.FindOne(database.DomainFilter{ID: domainObjectId, User: userId})
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrDomainNotFound
+	}
+	return domain, err
+}
+
+// VerifyDomain looks for the token of the domain in the TXT records of
+// DomainVerificationPrefix + host through helpers.Resolver.
+func (m *Models) VerifyDomain(userId primitive.ObjectID, domainId string) (*database.Domain, error) {
+	domain, err := m.getUserDomain(userId, domainId)
+	if err != nil {
+		return nil, err
+	}
+	if domain.Verified {
+		return domain, nil
+	}
+
+	if _, err := m.store.Domain.FindOne(database.DomainFilter{Host: domain.Host, Verified: true}); err == nil {
+		return nil, database.ErrDomainTaken
+	} else if err != mongo.ErrNoDocuments {
+		fmt.Println(err)
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), domainLookupTimeout)
+	defer cancel()
+
+	records, err := helpers.Resolver.LookupTXT(ctx, helpers.DomainVerificationPrefix+domain.Host)
+	if err != nil {
+		fmt.Println(err)
+		return nil, ErrDomainTokenNotFound
+	}
+
+	found := false
+	for _, record := range records {
+		if record == domain.Token {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, ErrDomainTokenNotFound
+	}
+
+	verifiedAt := database.UnixTime(time.Now().Unix())
+	matched, err := m.store.Domain.SetVerified(domain.ID, verifiedAt)
+	if err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+	if !matched {
+		return nil, ErrDomainNotFound
+	}
+
+	helpers.Cache.Del(domainCacheKey(domain.Host))
+
+	domain.Verified = true
+	domain.VerifiedAt = verifiedAt
+	fmt.Printf("Domain verified %v\n", domain.Host)
+	return domain, nil
+}
+
+// DeleteDomain removes the domain, its links stop resolving with it.
+func (m *Models) DeleteDomain(userId primitive.ObjectID, domainId string) error {
+	domain, err := m.getUserDomain(userId, domainId)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := m.store.Domain.Delete(domain.ID, userId)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	if deleted == 0 {
+		return ErrDomainNotFound
+	}
+
+	helpers.Cache.Del(domainCacheKey(domain.Host))
+
+	// links only exist on verified domains, they go with the domain so whoever
+	// verifies the host next doesn't take them over
+	if domain.Verified {
+		if err := m.deleteDomainURLs(domain.Host); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Domain deleted %v\n", domain.Host)
+	return nil
+}
+
+func (m *Models) deleteDomainURLs(host string) error {
+	urls, err := m.store.URL.Find(database.URLFilter{Domain: host})
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	if len(urls) == 0 {
+		return nil
+	}
+
+	deleted, err := m.store.URL.DeleteMany(database.URLFilter{Domain: host})
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	// links which are still there weren't removed and aren't announced
+	remaining := map[primitive.ObjectID]bool{}
+	if deleted < int64(len(urls)) {
+		left, err := m.store.URL.Find(database.URLFilter{Domain: host})
+		if err != nil {
+			fmt.Println(err)
+			return err
+		}
+		for _, url := range left {
+			remaining[url.ID] = true
+		}
+	}
+	for _, url := range urls {
+		if remaining[url.ID] {
+			continue
+		}
+		helpers.Cache.Del(URLCacheKey(url.Domain, url.Short))
+		m.DispatchURLEvent(database.WebhookURLDeleted, url)
+	}
+
+	fmt.Printf("Deleted %v urls of domain %v\n", deleted, host)
+	return nil
+}
+
+// GetUserVerifiedDomain returns the verified domain of the user links are created on.
+func (m *Models) GetUserVerifiedDomain(userId primitive.ObjectID, host string) (*database.Domain, error) {
+	domain, err := m.store.Domain.FindOne(database.DomainFilter{User: userId, Host: helpers.NormalizeHost(host), Verified: true})
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrDomainNotVerified
+	}
+	return domain, err
+}
+
+// RequestDomain maps the host of a request to the verified custom domain it
+// serves, it returns "" for the default domain and any unknown host.
+func (m *Models) RequestDomain(requestHost string) string {
+	host := helpers.NormalizeHost(requestHost)
+	if host == "" || host == helpers.NormalizeHost(os.Getenv("SHORTED_URL_DOMAIN")) {
+		return ""
+	}
+
+	cached := &database.Domain{}
+	if err := helpers.Cache.GetJSON(domainCacheKey(host), cached); err == nil {
+		return cached.Host
+	}
+
+	domain, err := m.store.Domain.FindOne(database.DomainFilter{Host: host, Verified: true})
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			fmt.Println(err)
+			return ""
+		}
+		// unknown hosts are cached too, as an empty domain
+		domain = &database.Domain{}
+	}
+
+	helpers.Cache.SetJSON(domainCacheKey(host), database.Domain{Host: domain.Host}, domainCacheExpiry)
+	return domain.Host
+}
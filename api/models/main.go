@@ -0,0 +1,19 @@
+package models
+
+import (
+	"github.com/ivinayakg/shorte.live/api/database"
+	"github.com/ivinayakg/shorte.live/api/helpers"
+)
+
+// Models holds the store and the workers writing to it, main creates it once
+// and hands it to the controllers and the middleware.
+type Models struct {
+	store    *database.Store
+	Config   *helpers.Config
+	Visits   *VisitRecorder
+	Webhooks *WebhookDispatcher
+}
+
+func New(store *database.Store) *Models {
+	return &Models{store: store, Config: helpers.NewConfig(store.Config)}
+}
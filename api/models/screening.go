@@ -0,0 +1,135 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ivinayakg/shorte.live/api/database"
+	"github.com/ivinayakg/shorte.live/api/helpers"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var ErrScreeningDisabled = errors.New("destination screening is not configured")
+
+// the reason given to urls suspended by a rescan
+const unsafeDestinationReason = "unsafe destination"
+
+// the urls a rescan loads from the store at once
+const rescanBatchSize = 500
+
+type ScreeningReport struct {
+	Scanned   int
+	Flagged   int
+	Suspended int
+}
+
+// RescanURLs screens the destinations of every url against the current blocklists
+// in the background, recording the matches and clearing stale ones. With suspend
+// the matching urls are suspended as well.
+func (m *Models) RescanURLs(suspend bool) error {
+	if helpers.Screener == nil {
+		return ErrScreeningDisabled
+	}
+
+	helpers.Background(func() {
+		report := &ScreeningReport{}
+		err := m.store.URL.FindBatches(database.URLFilter{}, rescanBatchSize, func(urls []*database.URL) error {
+			return m.rescanURLs(urls, suspend, report)
+		})
+		if err != nil {
+			fmt.Println("Rescan failed:", err)
+		}
+		fmt.Printf("Rescanned %v urls, %v flagged and %v suspended\n", report.Scanned, report.Flagged, report.Suspended)
+	})
+	return nil
+}
+
+func (m *Models) rescanURLs(urls []*database.URL, suspend bool, report *ScreeningReport) error {
+	for _, url := range urls {
+		report.Scanned++
+
+		var screening *database.URLScreening
+		for _, destination := range url.Destinations() {
+			if screening = helpers.Screener.Screen(destination); screening != nil {
+				break
+			}
+		}
+		if screening == nil && url.Screening == nil {
+			continue
+		}
+
+		set := bson.M{"screening": screening}
+		if screening != nil && suspend && !url.Suspended {
+			set["suspended"] = true
+			set["suspended_reason"] = unsafeDestinationReason
+			url.Suspended = true
+			report.Suspended++
+		}
+
+		if _, err := m.store.URL.Update(database.URLFilter{ID: url.ID}, set); err != nil {
+			fmt.Println(err)
+			return err
+		}
+		if url.Suspended {
+			helpers.Cache.Del(URLCacheKey(url.Domain, url.Short))
+		}
+		if screening != nil {
+			report.Flagged++
+		}
+	}
+	return nil
+}
+
+func (m *Models) GetFlaggedURLs() ([]*database.URL, error) {
+	return m.findURLs(database.URLFilter{Flagged: true})
+}
+
+// SuspendURL takes the url down, its owner can't resolve or re-enable it.
+func (m *Models) SuspendURL(urlId string, reason string) error {
+	urlObjectId, err := primitive.ObjectIDFromHex(urlId)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	url, err := m.store.URL.FindOne(database.URLFilter{ID: urlObjectId})
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	if _, err := m.store.URL.Update(database.URLFilter{ID: urlObjectId}, bson.M{"suspended": true, "suspended_reason": reason}); err != nil {
+		fmt.Println(err)
+		return err
+	}
+	helpers.Cache.Del(URLCacheKey(url.Domain, url.Short))
+
+	fmt.Printf("Suspended URL %v: %v\n", urlId, reason)
+	return nil
+}
+
+// UnsuspendURL lifts an admin suspension, the url resolves again unless its
+// owner disabled it.
+func (m *Models) UnsuspendURL(urlId string) error {
+	urlObjectId, err := primitive.ObjectIDFromHex(urlId)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	url, err := m.store.URL.FindOne(database.URLFilter{ID: urlObjectId})
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	if _, err := m.store.URL.Update(database.URLFilter{ID: urlObjectId}, bson.M{"suspended": false, "suspended_reason": ""}); err != nil {
+		fmt.Println(err)
+		return err
+	}
+	helpers.Cache.Del(URLCacheKey(url.Domain, url.Short))
+
+	fmt.Printf("Unsuspended URL %v\n", urlId)
+	return nil
+}
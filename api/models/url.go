@@ -1,7 +1,6 @@
 package models
 
 import (
-	"context"
 	"errors"
 	"fmt"
 	"time"
@@ -14,11 +13,11 @@ import (
 	"gopkg.in/mgo.v2/bson"
 )
 
-func CreateURL(user *database.User, short string, destination string, expiry int64) (*database.URL, error) {
-	url := new(database.URL)
+const bulkInsertBatchSize = 100
 
-	if short != "" {
-		err := database.CurrentDb.Url.FindOne(context.TODO(), bson.M{"short": short}).Decode(&url)
+func (m *Models) CreateURL(user *database.User, url *database.URL) (*database.URL, error) {
+	if url.Short != "" {
+		_, err := m.store.URL.FindOne(database.URLFilter{Short: url.Short, Domain: url.Domain})
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
 				fmt.Println("url Document not found")
@@ -27,53 +26,136 @@ func CreateURL(user *database.User, short string, destination string, expiry int
 				return nil, err
 			}
 		} else {
-			return nil, fmt.Errorf("URL custom short is already in user")
+			return nil, database.ErrDuplicateShort
 		}
 	} else {
-		short = uuid.New().String()[:10]
+		url.Short = uuid.New().String()[:10]
 	}
 
 	url.User = user.ID
-	url.Short = short
-	url.Destination = destination
-	url.Expiry = database.UnixTime(expiry)
 	// url.UpdateAt = database.UnixTime(time.Now().Unix())
 	url.CreatedAt = database.UnixTime(time.Now().Unix())
 	url.ID = primitive.NilObjectID
-	ctx := context.TODO()
 
-	res, err := database.CurrentDb.Url.InsertOne(ctx, url)
+	err := m.store.URL.Insert(url)
 	if err != nil {
 		fmt.Println(err)
 		return nil, err
 	}
-	url.ID = res.InsertedID.(primitive.ObjectID)
 	fmt.Printf("URL created with id %v\n", url.ID)
 
-	url.Short = helpers.BuildUrl("/" + url.Short)
+	url.Short = helpers.BuildDomainUrl(url.Domain, "/"+url.Short)
 	url.UserDoc = user
 
 	return url, nil
 }
 
-func GetURL(short string, id string) (*database.URL, error) {
-	url := new(database.URL)
+// CreateURLBulk inserts the given urls for the user in batches, returning one
+// error slot per url so a failed entry doesn't abort the rest of the batch.
+func (m *Models) CreateURLBulk(user *database.User, urls []*database.URL) []error {
+	errs := make([]error, len(urls))
+	seenShorts := map[string]bool{}
 
-	ctx := context.TODO()
+	for start := 0; start < len(urls); start += bulkInsertBatchSize {
+		end := start + bulkInsertBatchSize
+		if end > len(urls) {
+			end = len(urls)
+		}
+		batch := urls[start:end]
+
+		// shorts are only unique per domain, so they are checked domain by domain
+		customShorts := map[string][]string{}
+		for _, url := range batch {
+			if url.Short != "" {
+				customShorts[url.Domain] = append(customShorts[url.Domain], url.Short)
+			}
+		}
+
+		takenShorts := map[string]bool{}
+		var findErr error
+		for domain, shorts := range customShorts {
+			existing, err := m.store.URL.Find(database.URLFilter{Shorts: shorts, Domain: domain})
+			if err != nil {
+				findErr = err
+				break
+			}
+			for _, url := range existing {
+				takenShorts[domainShortKey(url.Domain, url.Short)] = true
+			}
+		}
+		if findErr != nil {
+			fmt.Println(findErr)
+			for i := start; i < end; i++ {
+				errs[i] = findErr
+			}
+			continue
+		}
 
-	var urlFilter bson.M
+		docs := []*database.URL{}
+		docIndex := []int{}
+		for i, url := range batch {
+			if url.Short != "" && (takenShorts[domainShortKey(url.Domain, url.Short)] || seenShorts[domainShortKey(url.Domain, url.Short)]) {
+				errs[start+i] = database.ErrDuplicateShort
+				continue
+			}
+			if url.Short == "" {
+				url.Short = uuid.New().String()[:10]
+			}
+			seenShorts[domainShortKey(url.Domain, url.Short)] = true
+
+			url.User = user.ID
+			url.CreatedAt = database.UnixTime(time.Now().Unix())
+			url.ID = primitive.NilObjectID
+			docs = append(docs, url)
+			docIndex = append(docIndex, start+i)
+		}
+
+		if len(docs) == 0 {
+			continue
+		}
+
+		for j, err := range m.store.URL.InsertMany(docs) {
+			i := docIndex[j]
+			if err != nil {
+				fmt.Println(err)
+				errs[i] = err
+				continue
+			}
+			urls[i].Short = helpers.BuildDomainUrl(urls[i].Domain, "/"+urls[i].Short)
+			urls[i].UserDoc = user
+		}
+	}
+
+	return errs
+}
+
+func domainShortKey(domain string, short string) string {
+	return domain + "/" + short
+}
+
+// URLCacheKey is the cache key of a resolved url, default domain urls keep their plain short.
+func URLCacheKey(domain string, short string) string {
+	if domain == "" {
+		return short
+	}
+	return domainShortKey(domain, short)
+}
+
+// GetURL finds the url by id, or by its short on the default domain when id is empty.
+func (m *Models) GetURL(short string, id string) (*database.URL, error) {
+	var urlFilter database.URLFilter
 	if id == "" {
-		urlFilter = bson.M{"short": short}
+		urlFilter = database.URLFilter{Short: short}
 	} else {
 		urlObjectId, err := primitive.ObjectIDFromHex(id)
 		if err != nil {
 			fmt.Println(err)
 			return nil, err
 		}
-		urlFilter = bson.M{"_id": urlObjectId}
+		urlFilter = database.URLFilter{ID: urlObjectId}
 	}
 
-	err := database.CurrentDb.Url.FindOne(ctx, urlFilter).Decode(url)
+	url, err := m.store.URL.FindOne(urlFilter)
 	if err != nil {
 		fmt.Println(err)
 		return nil, err
@@ -83,121 +165,111 @@ func GetURL(short string, id string) (*database.URL, error) {
 	return url, nil
 }
 
-func GetUserURL(userId primitive.ObjectID) ([]*database.URL, error) {
-	ctx := context.TODO()
-	urlFilter := bson.M{"user": userId}
-
-	curr, err := database.CurrentDb.Url.Find(ctx, urlFilter)
+// GetDomainURL finds the url with the short on a custom domain, an empty domain is the default one.
+func (m *Models) GetDomainURL(domain string, short string) (*database.URL, error) {
+	url, err := m.store.URL.FindOne(database.URLFilter{Short: short, Domain: domain})
 	if err != nil {
+		fmt.Println(err)
 		return nil, err
 	}
-	defer curr.Close(context.TODO())
 
-	var results []*database.URL
-	for curr.Next(context.TODO()) {
-		var result database.URL
-		e := curr.Decode(&result)
-		if e != nil {
-			fmt.Println(err)
-		}
-		result.Short = helpers.BuildUrl("/" + result.Short)
-		results = append(results, &result)
-	}
+	fmt.Printf("URL found with id %v\n", url.ID)
+	return url, nil
+}
 
-	if err := curr.Err(); err != nil {
+// GetUserURL lists the personal urls of the user, workspace urls are listed with GetWorkspaceURL.
+func (m *Models) GetUserURL(userId primitive.ObjectID) ([]*database.URL, error) {
+	return m.findURLs(database.URLFilter{User: userId, Personal: true})
+}
+
+func (m *Models) GetWorkspaceURL(workspaceId primitive.ObjectID) ([]*database.URL, error) {
+	return m.findURLs(database.URLFilter{Workspace: workspaceId})
+}
+
+func (m *Models) findURLs(filter database.URLFilter) ([]*database.URL, error) {
+	results, err := m.store.URL.Find(filter)
+	if err != nil {
 		return nil, err
 	}
 
+	for _, result := range results {
+		result.Short = helpers.BuildDomainUrl(result.Domain, "/"+result.Short)
+		result.Protected = result.Password != ""
+		result.Active = !result.Disabled && !result.Suspended
+		result.Password = ""
+	}
+
 	return results, nil
 }
 
-func UpdateUserURL(userId primitive.ObjectID, urlId string, newShort string, destination string, expiry database.UnixTime) error {
+// UpdateURL saves the editable fields of url onto the url with urlId, access is
+// checked by the caller with URLRole.
+func (m *Models) UpdateURL(urlId string, url *database.URL) error {
 	urlObjectId, err := primitive.ObjectIDFromHex(urlId)
 	if err != nil {
 		fmt.Println(err)
 		return err
 	}
 
-	ctx := context.TODO()
-	urlFilter := bson.M{"user": userId, "_id": urlObjectId}
+	urlFilter := database.URLFilter{ID: urlObjectId}
+	updateData := bson.M{"short": url.Short, "destination": url.Destination, "expiry": url.Expiry, "password": url.Password, "max_clicks": url.MaxClicks, "screening": url.Screening, "disabled": url.Disabled, "targets": url.Targets, "geo_rules": url.GeoRules, "variants": url.Variants, "sticky_variants": url.StickyVariants, "utm": url.UTM, "forward_query": url.ForwardQuery, "activates_at": url.ActivatesAt, "coming_soon_url": url.ComingSoonURL}
+	if url.Expiry > database.UnixTime(time.Now().Unix()) {
+		// a url moved back before its expiry is announced again when it passes
+		updateData["expiry_notified"] = false
+	}
 
-	// Check if the document exists
-	count, err := database.CurrentDb.Url.CountDocuments(ctx, urlFilter)
+	matched, err := m.store.URL.Update(urlFilter, updateData)
 	if err != nil {
 		fmt.Println(err)
 		return err
 	}
 
-	if count == 0 {
+	if matched == 0 {
 		fmt.Println("URL Document not found")
 		return errors.New("URL document not found")
 	}
 
-	updateData := bson.M{"$set": bson.M{"short": newShort, "destination": destination, "expiry": expiry}}
-
-	res, err := database.CurrentDb.Url.UpdateOne(ctx, urlFilter, updateData)
-	if err != nil {
-		if writeError, ok := err.(mongo.WriteException); ok && writeError.WriteErrors[0].Code == 11000 {
-			fmt.Println(err)
-			return fmt.Errorf("URL custom short is already in user")
-		} else {
-			fmt.Println(err)
-		}
-		return err
-	} else {
-		fmt.Printf("Update document successfully URL: %+v\n", res.UpsertedID)
-	}
-
+	fmt.Printf("Update document successfully URL: %+v\n", urlId)
 	return nil
 }
 
-func UpdateUserURLVisited(urlId string, visited time.Time) error {
-	urlObjectId, err := primitive.ObjectIDFromHex(urlId)
-	if err != nil {
-		fmt.Println(err)
-		return err
+// URLCacheTTL is how long the resolved url can be cached, a scheduled url until it
+// activates so the cached "coming soon" state never outlives the window, and
+// any other until it expires.
+func URLCacheTTL(url *database.URL, now time.Time) time.Duration {
+	activatesAt := time.Unix(int64(url.ActivatesAt), 0)
+	if url.ActivatesAt > 0 && now.Before(activatesAt) {
+		return activatesAt.Sub(now)
 	}
+	return time.Unix(int64(url.Expiry), 0).Sub(now)
+}
 
-	ctx := context.TODO()
-	urlFilter := bson.M{"_id": urlObjectId}
-	updateData := bson.M{"$set": bson.M{"lastvisited": visited}}
-
-	res, err := database.CurrentDb.Url.UpdateOne(ctx, urlFilter, updateData)
+// ClaimURLClick counts a redirect against a click limited url, it returns false
+// when the url has no clicks left.
+func (m *Models) ClaimURLClick(id primitive.ObjectID) (bool, error) {
+	claimed, err := m.store.URL.ClaimClick(id)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			fmt.Println("URL Document not found")
-		} else {
-			fmt.Println(err)
-		}
-		return err
-	} else {
-		fmt.Printf("Update document successfully URL: %+v\n", res.UpsertedID)
+		fmt.Println(err)
+		return false, err
 	}
-
-	return nil
+	return claimed, nil
 }
 
-func DeleteURL(userId primitive.ObjectID, urlId string) error {
+func (m *Models) DeleteURL(urlId string) error {
 	urlObjectId, err := primitive.ObjectIDFromHex(urlId)
 	if err != nil {
 		fmt.Println(err)
 		return err
 	}
 
-	ctx := context.TODO()
-	urlFilter := bson.M{"user": userId, "_id": urlObjectId}
+	urlFilter := database.URLFilter{ID: urlObjectId}
 
-	res, err := database.CurrentDb.Url.DeleteOne(ctx, urlFilter)
+	deleted, err := m.store.URL.Delete(urlFilter)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			fmt.Println("URL Document not found")
-		} else {
-			fmt.Println(err)
-		}
+		fmt.Println(err)
 		return err
-	} else {
-		fmt.Printf("Deleted document successfully URL: %+v. Total documents deleted - %d\n", urlId, res.DeletedCount)
 	}
 
+	fmt.Printf("Deleted document successfully URL: %+v. Total documents deleted - %d\n", urlId, deleted)
 	return nil
 }
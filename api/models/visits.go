@@ -0,0 +1,90 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ivinayakg/shorte.live/api/database"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// VisitRecorder coalesces redirects in memory and writes the per url click
+// counts and last visited times to the store in one batch per flush.
+type VisitRecorder struct {
+	store          *database.Store
+	pending        map[primitive.ObjectID]*database.URLVisits
+	flushFrequency time.Duration
+	mutex          sync.Mutex
+}
+
+func (m *Models) SetupVisitRecorder(dur time.Duration) {
+	m.Visits = &VisitRecorder{
+		store:          m.store,
+		pending:        map[primitive.ObjectID]*database.URLVisits{},
+		flushFrequency: dur,
+	}
+}
+
+// add merges the visits into the pending ones, the caller holds the mutex.
+func (vr *VisitRecorder) add(urlId primitive.ObjectID, clicks int64, lastVisited database.UnixTime) {
+	visit, found := vr.pending[urlId]
+	if !found {
+		visit = &database.URLVisits{}
+		vr.pending[urlId] = visit
+	}
+	visit.Clicks += clicks
+	if lastVisited > visit.LastVisited {
+		visit.LastVisited = lastVisited
+	}
+}
+
+// Record queues a visit of the url, countClick is false for click limited urls
+// whose total_clicks was already claimed when resolving.
+func (vr *VisitRecorder) Record(urlId primitive.ObjectID, countClick bool, visited time.Time) {
+	vr.mutex.Lock()
+	defer vr.mutex.Unlock()
+
+	var clicks int64
+	if countClick {
+		clicks = 1
+	}
+	vr.add(urlId, clicks, database.UnixTime(visited.Unix()))
+}
+
+func (vr *VisitRecorder) Flush() {
+	vr.mutex.Lock()
+	pending := vr.pending
+	vr.pending = map[primitive.ObjectID]*database.URLVisits{}
+	vr.mutex.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	if err := vr.store.URL.RecordVisits(pending); err != nil {
+		fmt.Println(err)
+		// put the visits back so they are retried on the next flush
+		vr.mutex.Lock()
+		for id, visit := range pending {
+			vr.add(id, visit.Clicks, visit.LastVisited)
+		}
+		vr.mutex.Unlock()
+	}
+}
+
+// StartFlush flushes the visits periodically until ctx is cancelled.
+func (vr *VisitRecorder) StartFlush(ctx context.Context) {
+	ticker := time.NewTicker(vr.flushFrequency)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		vr.Flush()
+	}
+}
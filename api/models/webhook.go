@@ -0,0 +1,436 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ivinayakg/shorte.live/api/database"
+	"github.com/ivinayakg/shorte.live/api/helpers"
+	"github.com/ivinayakg/shorte.live/api/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+const webhookMaxAttempts = 6
+const webhookMaxRetryBackoff = time.Hour
+const webhookDeliveryTimeout = time.Second * 10
+const webhookDeliveryBatchSize = 100
+const WebhookDeliveryLogLimit = 50
+
+// WebhookPayload is the signed json body posted to the webhook url.
+type WebhookPayload struct {
+	ID        string                `json:"id"`
+	Event     database.WebhookEvent `json:"event"`
+	CreatedAt database.UnixTime     `json:"created_at"`
+	Data      interface{}           `json:"data"`
+}
+
+// WebhookURL is the url as sent in webhook payloads, without its password.
+type WebhookURL struct {
+	ID           string                `json:"_id"`
+	ShortURL     string                `json:"short_url"`
+	Destination  string                `json:"destination"`
+	Expiry       database.UnixTime     `json:"expiry"`
+	MaxClicks    int64                 `json:"max_clicks"`
+	Protected    bool                  `json:"protected"`
+	Active       bool                  `json:"active"`
+	Targets      []database.URLTarget  `json:"targets,omitempty"`
+	GeoRules     []database.URLGeoRule `json:"geo_rules,omitempty"`
+	Variants     []database.URLVariant `json:"variants,omitempty"`
+	UTM          *database.URLUTM      `json:"utm,omitempty"`
+	ForwardQuery bool                  `json:"forward_query,omitempty"`
+	ActivatesAt  database.UnixTime     `json:"activates_at,omitempty"`
+	Workspace    string                `json:"workspace,omitempty"`
+	Domain       string                `json:"domain,omitempty"`
+}
+
+func newWebhookURL(url *database.URL) *WebhookURL {
+	// created urls come back from CreateURL with the short already built
+	shortURL := url.Short
+	if !strings.Contains(shortURL, "://") {
+		shortURL = helpers.BuildDomainUrl(url.Domain, "/"+url.Short)
+	}
+
+	data := &WebhookURL{
+		ID:           url.ID.Hex(),
+		ShortURL:     shortURL,
+		Destination:  url.Destination,
+		Expiry:       url.Expiry,
+		MaxClicks:    url.MaxClicks,
+		Protected:    url.Password != "",
+		Active:       !url.Disabled && !url.Suspended,
+		Targets:      url.Targets,
+		GeoRules:     url.GeoRules,
+		Variants:     url.Variants,
+		UTM:          url.UTM,
+		ForwardQuery: url.ForwardQuery,
+		ActivatesAt:  url.ActivatesAt,
+		Domain:       url.Domain,
+	}
+	if url.Workspace != primitive.NilObjectID {
+		data.Workspace = url.Workspace.Hex()
+	}
+	return data
+}
+
+// WebhookClick is the click event sent with url.clicked.
+type WebhookClick struct {
+	URL *WebhookURL `json:"url"`
+	*database.ClickEvent
+}
+
+func (m *Models) CreateWebhook(user *database.User, url string, events []database.WebhookEvent) (*database.Webhook, error) {
+	secret, err := utils.GenerateWebhookSecret()
+	if err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+
+	wh := &database.Webhook{
+		User:      user.ID,
+		URL:       url,
+		Events:    events,
+		Secret:    secret,
+		CreatedAt: database.UnixTime(time.Now().Unix()),
+	}
+
+	if err := m.store.Webhook.Insert(wh); err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+
+	fmt.Printf("Webhook created with id %v\n", wh.ID)
+	return wh, nil
+}
+
+func (m *Models) GetUserWebhooks(userId primitive.ObjectID) ([]*database.Webhook, error) {
+	return m.store.Webhook.Find(database.WebhookFilter{User: userId})
+}
+
+func (m *Models) getUserWebhook(userId primitive.ObjectID, webhookId string) (*database.Webhook, error) {
+	webhookObjectId, err := primitive.ObjectIDFromHex(webhookId)
+	if err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+
+	webhooks, err := m.store.Webhook.Find(database.WebhookFilter{ID: webhookObjectId, User: userId})
+	if err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+	if len(webhooks) == 0 {
+		return nil, ErrWebhookNotFound
+	}
+	return webhooks[0], nil
+}
+
+func (m *Models) DeleteWebhook(userId primitive.ObjectID, webhookId string) error {
+	wh, err := m.getUserWebhook(userId, webhookId)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := m.store.Webhook.Delete(wh.ID, userId)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	if deleted == 0 {
+		return ErrWebhookNotFound
+	}
+
+	fmt.Printf("Webhook deleted %v\n", webhookId)
+	return nil
+}
+
+// GetWebhookDeliveries returns the latest deliveries of the webhook of the user.
+func (m *Models) GetWebhookDeliveries(userId primitive.ObjectID, webhookId string) ([]*database.WebhookDelivery, error) {
+	wh, err := m.getUserWebhook(userId, webhookId)
+	if err != nil {
+		return nil, err
+	}
+	return m.store.Webhook.FindDeliveries(wh.ID, WebhookDeliveryLogLimit)
+}
+
+// queueWebhooks stores a pending delivery of the event for each of the webhooks.
+func (m *Models) queueWebhooks(webhooks []*database.Webhook, event database.WebhookEvent, data interface{}) {
+	now := time.Now()
+	for _, wh := range webhooks {
+		delivery := &database.WebhookDelivery{
+			ID:          primitive.NewObjectID(),
+			Webhook:     wh.ID,
+			Event:       event,
+			Status:      database.WebhookDeliveryPending,
+			NextAttempt: database.UnixTime(now.Unix()),
+			CreatedAt:   database.UnixTime(now.Unix()),
+		}
+
+		payload, err := json.Marshal(WebhookPayload{ID: delivery.ID.Hex(), Event: event, CreatedAt: delivery.CreatedAt, Data: data})
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		delivery.Payload = string(payload)
+
+		if err := m.store.Webhook.InsertDelivery(delivery); err != nil {
+			fmt.Println("Failed to queue webhook delivery", err)
+		}
+	}
+
+	if len(webhooks) > 0 && m.Webhooks != nil {
+		m.Webhooks.wake()
+	}
+}
+
+// DispatchURLEvent queues the event for the webhooks of the user who created the url.
+func (m *Models) DispatchURLEvent(event database.WebhookEvent, url *database.URL) {
+	webhooks, err := m.store.Webhook.Find(database.WebhookFilter{User: url.User, Event: event})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+	m.queueWebhooks(webhooks, event, newWebhookURL(url))
+}
+
+// DispatchClickEvents queues url.clicked for the stored click events, it's the
+// insert hook of the tracker.
+func (m *Models) DispatchClickEvents(events []*database.ClickEvent) {
+	subscribed, err := m.store.Webhook.Find(database.WebhookFilter{Event: database.WebhookURLClicked})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if len(subscribed) == 0 {
+		return
+	}
+
+	userWebhooks := map[primitive.ObjectID][]*database.Webhook{}
+	for _, wh := range subscribed {
+		userWebhooks[wh.User] = append(userWebhooks[wh.User], wh)
+	}
+
+	urls := map[string]*database.URL{}
+	for _, event := range events {
+		url, found := urls[event.URLId]
+		if !found {
+			url, _ = m.GetURL("", event.URLId)
+			urls[event.URLId] = url
+		}
+		if url == nil || len(userWebhooks[url.User]) == 0 {
+			continue
+		}
+		m.queueWebhooks(userWebhooks[url.User], database.WebhookURLClicked, WebhookClick{URL: newWebhookURL(url), ClickEvent: event})
+	}
+}
+
+// WebhookDispatcher posts the pending deliveries and retries the failed ones with
+// an exponential backoff, it also looks for expired urls at most once a second.
+type WebhookDispatcher struct {
+	models       *Models
+	frequency    time.Duration
+	retryBackoff time.Duration
+	client       *http.Client
+	lastSweep    time.Time
+	wakeup       chan struct{}
+	mutex        sync.Mutex
+}
+
+func (m *Models) SetupWebhookDispatcher(frequency time.Duration, retryBackoff time.Duration) {
+	m.Webhooks = &WebhookDispatcher{
+		models:       m,
+		frequency:    frequency,
+		retryBackoff: retryBackoff,
+		client:       helpers.PublicHTTPClient(webhookDeliveryTimeout),
+		wakeup:       make(chan struct{}, 1),
+	}
+}
+
+func (wd *WebhookDispatcher) wake() {
+	select {
+	case wd.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (wd *WebhookDispatcher) backoff(attempts int) time.Duration {
+	backoff := wd.retryBackoff
+	for i := 1; i < attempts && backoff < webhookMaxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > webhookMaxRetryBackoff {
+		backoff = webhookMaxRetryBackoff
+	}
+	return backoff
+}
+
+// post sends the delivery once, it returns the response status and the error of the attempt.
+func (wd *WebhookDispatcher) post(wh *database.Webhook, delivery *database.WebhookDelivery) (int, error) {
+	timestamp := time.Now().Unix()
+	body := []byte(delivery.Payload)
+
+	req, err := http.NewRequest(http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "shorte.live-webhooks")
+	req.Header.Set("X-Shorte-Event", string(delivery.Event))
+	req.Header.Set("X-Shorte-Delivery", delivery.ID.Hex())
+	req.Header.Set("X-Shorte-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Shorte-Signature", "sha256="+utils.SignWebhookPayload(wh.Secret, timestamp, body))
+
+	resp, err := wd.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with %v", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// deliver sends a due delivery unless another instance claimed it first, the
+// error is only returned when the claim couldn't be made.
+func (wd *WebhookDispatcher) deliver(delivery *database.WebhookDelivery) error {
+	now := time.Now()
+	// the lease keeps other instances from sending the delivery while it's in flight
+	claimed, err := wd.models.store.Webhook.ClaimDelivery(delivery, database.UnixTime(now.Add(webhookDeliveryTimeout*2).Unix()))
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return nil
+	}
+
+	webhooks, err := wd.models.store.Webhook.Find(database.WebhookFilter{ID: delivery.Webhook})
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+
+	delivery.Attempts++
+	if len(webhooks) == 0 {
+		delivery.Status = database.WebhookDeliveryFailed
+		delivery.Error = ErrWebhookNotFound.Error()
+	} else {
+		delivery.ResponseStatus, err = wd.post(webhooks[0], delivery)
+		switch {
+		case err == nil:
+			delivery.Status = database.WebhookDeliveryDelivered
+			delivery.DeliveredAt = database.UnixTime(time.Now().Unix())
+			delivery.Error = ""
+		case delivery.Attempts >= webhookMaxAttempts:
+			delivery.Status = database.WebhookDeliveryFailed
+			delivery.Error = err.Error()
+		default:
+			delivery.NextAttempt = database.UnixTime(time.Now().Add(wd.backoff(delivery.Attempts)).Unix())
+			delivery.Error = err.Error()
+		}
+	}
+
+	if err := wd.models.store.Webhook.UpdateDelivery(delivery); err != nil {
+		fmt.Println("Failed to update webhook delivery", err)
+	}
+	return nil
+}
+
+// sweepExpired sends url.expired for the expired urls which weren't notified yet,
+// so urls expiring while the api is down are picked up by the first sweep after
+// it. Every url is claimed in the store first, only one instance sends its event.
+func (wd *WebhookDispatcher) sweepExpired(now time.Time) {
+	subscribed, err := wd.models.store.Webhook.Find(database.WebhookFilter{Event: database.WebhookURLExpired})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// urls which expired before the user's first subscription aren't announced
+	subscribedSince := map[primitive.ObjectID]database.UnixTime{}
+	for _, wh := range subscribed {
+		if since, found := subscribedSince[wh.User]; !found || wh.CreatedAt < since {
+			subscribedSince[wh.User] = wh.CreatedAt
+		}
+	}
+
+	for user, since := range subscribedSince {
+		urls, err := wd.models.store.URL.Find(database.URLFilter{User: user, ExpiredAfter: since - 1, ExpiredBefore: database.UnixTime(now.Unix()), ExpiryUnnotified: true})
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		for _, url := range urls {
+			claimed, err := wd.models.store.URL.ClaimExpiryNotification(url.ID)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			if claimed {
+				wd.models.DispatchURLEvent(database.WebhookURLExpired, url)
+			}
+		}
+	}
+	wd.lastSweep = now
+}
+
+// Deliver sends every due delivery, one batch at a time.
+func (wd *WebhookDispatcher) Deliver() {
+	wd.mutex.Lock()
+	defer wd.mutex.Unlock()
+
+	now := time.Now()
+	if now.Unix() > wd.lastSweep.Unix() {
+		wd.sweepExpired(now)
+	}
+
+	for {
+		due, err := wd.models.store.Webhook.DueDeliveries(database.UnixTime(time.Now().Unix()), webhookDeliveryBatchSize)
+		if err != nil {
+			fmt.Println("Failed to load webhook deliveries", err)
+			return
+		}
+		for _, delivery := range due {
+			// the same rows would be selected again, the next run retries them
+			if err := wd.deliver(delivery); err != nil {
+				fmt.Println("Failed to claim webhook delivery", err)
+				return
+			}
+		}
+		if len(due) < webhookDeliveryBatchSize {
+			return
+		}
+	}
+}
+
+// StartDelivery sends the deliveries periodically and when woken up, until ctx
+// is cancelled.
+func (wd *WebhookDispatcher) StartDelivery(ctx context.Context) {
+	ticker := time.NewTicker(wd.frequency)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wd.wakeup:
+		}
+		wd.Deliver()
+	}
+}
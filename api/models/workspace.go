@@ -0,0 +1,193 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ivinayakg/shorte.live/api/database"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ErrInviteeNotFound = errors.New("no user with this email")
+var ErrAlreadyMember = errors.New("user is already a member of the workspace")
+var ErrAlreadyInvited = errors.New("user is already invited to the workspace")
+var ErrInviteNotFound = errors.New("workspace invite not found")
+var ErrMemberNotFound = errors.New("workspace member not found")
+var ErrLastOwner = errors.New("workspace needs at least one owner")
+
+func (m *Models) CreateWorkspace(user *database.User, name string) (*database.Workspace, error) {
+	ws := &database.Workspace{
+		Name:      name,
+		Members:   []database.WorkspaceMember{{User: user.ID, Role: database.WorkspaceOwner}},
+		Invites:   []database.WorkspaceInvite{},
+		CreatedAt: database.UnixTime(time.Now().Unix()),
+	}
+
+	if err := m.store.Workspace.Insert(ws); err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+
+	fmt.Printf("Workspace created with id %v\n", ws.ID)
+	return ws, nil
+}
+
+func (m *Models) GetWorkspace(id string) (*database.Workspace, error) {
+	wsObjectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+
+	ws, err := m.store.Workspace.FindOne(database.WorkspaceFilter{ID: wsObjectId})
+	if err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+	return ws, nil
+}
+
+func (m *Models) GetUserWorkspaces(userId primitive.ObjectID) ([]*database.Workspace, error) {
+	return m.store.Workspace.Find(database.WorkspaceFilter{Member: userId})
+}
+
+// GetInvitedWorkspaces lists the workspaces with a pending invite for the email.
+func (m *Models) GetInvitedWorkspaces(email string) ([]*database.Workspace, error) {
+	return m.store.Workspace.Find(database.WorkspaceFilter{InviteEmail: email})
+}
+
+// InviteToWorkspace invites an existing user by email, the invite is pending until they accept it.
+func (m *Models) InviteToWorkspace(ws *database.Workspace, invitedBy *database.User, email string, role database.WorkspaceRole) error {
+	invitee, err := m.store.User.FindByEmail(email)
+	if err == mongo.ErrNoDocuments {
+		return ErrInviteeNotFound
+	}
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	if ws.MemberRole(invitee.ID) != "" {
+		return ErrAlreadyMember
+	}
+
+	invite := database.WorkspaceInvite{Email: email, Role: role, InvitedBy: invitedBy.ID, CreatedAt: database.UnixTime(time.Now().Unix())}
+	added, err := m.store.Workspace.AddInvite(ws.ID, invite)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	if !added {
+		return ErrAlreadyInvited
+	}
+
+	fmt.Printf("Invited %v to workspace %v\n", email, ws.ID)
+	return nil
+}
+
+// AcceptWorkspaceInvite makes the user a member with the role they were invited with.
+func (m *Models) AcceptWorkspaceInvite(ws *database.Workspace, user *database.User) error {
+	invite := ws.Invite(user.Email)
+	if invite == nil {
+		return ErrInviteNotFound
+	}
+	if ws.MemberRole(user.ID) != "" {
+		return ErrAlreadyMember
+	}
+
+	accepted, err := m.store.Workspace.AcceptInvite(ws.ID, user.Email, database.WorkspaceMember{User: user.ID, Role: invite.Role})
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	if !accepted {
+		return ErrInviteNotFound
+	}
+	return nil
+}
+
+func (m *Models) RemoveWorkspaceInvite(ws *database.Workspace, email string) error {
+	removed, err := m.store.Workspace.RemoveInvite(ws.ID, email)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	if !removed {
+		return ErrInviteNotFound
+	}
+	return nil
+}
+
+func countOwners(ws *database.Workspace) int {
+	owners := 0
+	for _, member := range ws.Members {
+		if member.Role == database.WorkspaceOwner {
+			owners++
+		}
+	}
+	return owners
+}
+
+func (m *Models) SetWorkspaceMemberRole(ws *database.Workspace, userId primitive.ObjectID, role database.WorkspaceRole) error {
+	current := ws.MemberRole(userId)
+	if current == "" {
+		return ErrMemberNotFound
+	}
+	if current == database.WorkspaceOwner && role != database.WorkspaceOwner && countOwners(ws) == 1 {
+		return ErrLastOwner
+	}
+
+	updated, err := m.store.Workspace.SetMemberRole(ws.ID, userId, role)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	if !updated {
+		return ErrMemberNotFound
+	}
+	return nil
+}
+
+func (m *Models) RemoveWorkspaceMember(ws *database.Workspace, userId primitive.ObjectID) error {
+	current := ws.MemberRole(userId)
+	if current == "" {
+		return ErrMemberNotFound
+	}
+	if current == database.WorkspaceOwner && countOwners(ws) == 1 {
+		return ErrLastOwner
+	}
+
+	removed, err := m.store.Workspace.RemoveMember(ws.ID, userId)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	if !removed {
+		return ErrMemberNotFound
+	}
+	return nil
+}
+
+// URLRole is the role of the user on the url, personal urls are owned by the user
+// who created them and workspace urls follow the workspace membership. It's empty
+// when the user has no access.
+func (m *Models) URLRole(user *database.User, url *database.URL) (database.WorkspaceRole, error) {
+	if url.Workspace == primitive.NilObjectID {
+		if url.User == user.ID {
+			return database.WorkspaceOwner, nil
+		}
+		return "", nil
+	}
+
+	ws, err := m.store.Workspace.FindOne(database.WorkspaceFilter{ID: url.Workspace})
+	if err == mongo.ErrNoDocuments {
+		return "", nil
+	}
+	if err != nil {
+		fmt.Println(err)
+		return "", err
+	}
+	return ws.MemberRole(user.ID), nil
+}
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/ivinayakg/shorte.live/api/controllers"
+	"github.com/ivinayakg/shorte.live/api/middleware"
+	"github.com/ivinayakg/shorte.live/api/models"
+)
+
+func AdminRoutes(r *mux.Router, m *models.Models, h *controllers.Handler) {
+	protectedR := r.NewRoute().Subrouter()
+	protectedR.Use(middleware.Authentication(m))
+	protectedR.Use(middleware.AdminOnly)
+	protectedR.HandleFunc("/screening/rescan", h.RescanURLs).Methods("POST")
+	protectedR.HandleFunc("/screening/flagged", h.GetFlaggedURLs).Methods("GET")
+	protectedR.HandleFunc("/url/{id}/suspend", h.SuspendURL).Methods("POST")
+	protectedR.HandleFunc("/url/{id}/suspend", h.UnsuspendURL).Methods("DELETE")
+}
@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/ivinayakg/shorte.live/api/controllers"
+	"github.com/ivinayakg/shorte.live/api/middleware"
+	"github.com/ivinayakg/shorte.live/api/models"
+)
+
+func DomainRoutes(r *mux.Router, m *models.Models, h *controllers.Handler) {
+	protectedR := r.NewRoute().Subrouter()
+	protectedR.Use(middleware.Authentication(m))
+	protectedR.HandleFunc("", h.RegisterDomain).Methods("POST")
+	protectedR.HandleFunc("/all", h.GetUserDomains).Methods("GET")
+	protectedR.HandleFunc("/{id}/verify", h.VerifyDomain).Methods("POST")
+	protectedR.HandleFunc("/{id}", h.DeleteDomain).Methods("DELETE")
+}
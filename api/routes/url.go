@@ -3,19 +3,24 @@ package routes
 import (
 	"github.com/gorilla/mux"
 	"github.com/ivinayakg/shorte.live/api/controllers"
+	"github.com/ivinayakg/shorte.live/api/database"
 	"github.com/ivinayakg/shorte.live/api/middleware"
+	"github.com/ivinayakg/shorte.live/api/models"
 )
 
-func URLRoutes(r *mux.Router) {
+func URLRoutes(r *mux.Router, m *models.Models, h *controllers.Handler) {
 	protectedR := r.NewRoute().Subrouter()
-	protectedR.Use(middleware.Authentication)
-	protectedR.HandleFunc("", controllers.ShortenURL).Methods("POST")
-	protectedR.HandleFunc("/all", controllers.GetUserURL).Methods("GET")
-	protectedR.HandleFunc("/{id}", controllers.UpdateUrl).Methods("PATCH")
-	protectedR.HandleFunc("/{id}", controllers.DeleteUrl).Methods("DELETE")
-	protectedR.HandleFunc("/{id}/stats", controllers.GetURLStats).Methods("GET")
+	protectedR.Use(middleware.APIKeyAuthentication(m, database.ScopeURLRead, database.ScopeURLWrite))
+	protectedR.HandleFunc("", h.ShortenURL).Methods("POST")
+	protectedR.HandleFunc("/bulk", h.ShortenURLBulk).Methods("POST")
+	protectedR.HandleFunc("/all", h.GetUserURL).Methods("GET")
+	protectedR.HandleFunc("/{id}", h.UpdateUrl).Methods("PATCH")
+	protectedR.HandleFunc("/{id}", h.DeleteUrl).Methods("DELETE")
+	protectedR.HandleFunc("/{id}/stats", h.GetURLStats).Methods("GET")
+	protectedR.HandleFunc("/{id}/qr", h.GetURLQRCode).Methods("GET")
 }
 
-func URLResolveRoutes(r *mux.Router) {
-	r.HandleFunc("/{short}", controllers.ResolveURL).Methods("GET")
+func URLResolveRoutes(r *mux.Router, h *controllers.Handler) {
+	r.HandleFunc("/{short}", h.ResolveURL).Methods("GET")
+	r.HandleFunc("/{short}", h.UnlockURL).Methods("POST")
 }
@@ -4,14 +4,18 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/ivinayakg/shorte.live/api/controllers"
 	"github.com/ivinayakg/shorte.live/api/middleware"
+	"github.com/ivinayakg/shorte.live/api/models"
 )
 
-func UserRoutes(r *mux.Router) {
+func UserRoutes(r *mux.Router, m *models.Models, h *controllers.Handler) {
 	r.HandleFunc("/sign_in_with_google", controllers.SignInWithGoogle).Methods("GET")
-	r.HandleFunc("/google/callback", controllers.CallbackSignInWithGoogle).Methods("GET")
+	r.HandleFunc("/google/callback", h.CallbackSignInWithGoogle).Methods("GET")
 
 	protectedR := r.NewRoute().Subrouter()
-	protectedR.Use(middleware.Authentication)
+	protectedR.Use(middleware.Authentication(m))
 	protectedR.HandleFunc("/self", controllers.SelfUser).Methods("GET")
 	protectedR.HandleFunc("/logout", controllers.Logout).Methods("GET")
+	protectedR.HandleFunc("/api_keys", h.CreateAPIKey).Methods("POST")
+	protectedR.HandleFunc("/api_keys", h.GetUserAPIKeys).Methods("GET")
+	protectedR.HandleFunc("/api_keys/{id}", h.DeleteAPIKey).Methods("DELETE")
 }
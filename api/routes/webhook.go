@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/ivinayakg/shorte.live/api/controllers"
+	"github.com/ivinayakg/shorte.live/api/middleware"
+	"github.com/ivinayakg/shorte.live/api/models"
+)
+
+func WebhookRoutes(r *mux.Router, m *models.Models, h *controllers.Handler) {
+	protectedR := r.NewRoute().Subrouter()
+	protectedR.Use(middleware.Authentication(m))
+	protectedR.HandleFunc("", h.CreateWebhook).Methods("POST")
+	protectedR.HandleFunc("/all", h.GetUserWebhooks).Methods("GET")
+	protectedR.HandleFunc("/{id}", h.DeleteWebhook).Methods("DELETE")
+	protectedR.HandleFunc("/{id}/deliveries", h.GetWebhookDeliveries).Methods("GET")
+}
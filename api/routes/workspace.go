@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/ivinayakg/shorte.live/api/controllers"
+	"github.com/ivinayakg/shorte.live/api/middleware"
+	"github.com/ivinayakg/shorte.live/api/models"
+)
+
+func WorkspaceRoutes(r *mux.Router, m *models.Models, h *controllers.Handler) {
+	protectedR := r.NewRoute().Subrouter()
+	protectedR.Use(middleware.Authentication(m))
+	protectedR.HandleFunc("", h.CreateWorkspace).Methods("POST")
+	protectedR.HandleFunc("/all", h.GetUserWorkspaces).Methods("GET")
+	protectedR.HandleFunc("/invites", h.GetWorkspaceInvites).Methods("GET")
+	protectedR.HandleFunc("/{id}/invites", h.InviteToWorkspace).Methods("POST")
+	protectedR.HandleFunc("/{id}/invites/accept", h.AcceptWorkspaceInvite).Methods("POST")
+	protectedR.HandleFunc("/{id}/invites/{email}", h.RemoveWorkspaceInvite).Methods("DELETE")
+	protectedR.HandleFunc("/{id}/members/{user}", h.UpdateWorkspaceMember).Methods("PATCH")
+	protectedR.HandleFunc("/{id}/members/{user}", h.RemoveWorkspaceMember).Methods("DELETE")
+}
@@ -0,0 +1,11 @@
+package static
+
+import (
+	_ "embed"
+	"html/template"
+)
+
+//go:embed unlock.html
+var unlockHTML string
+
+var UnlockTemplate = template.Must(template.New("unlock").Parse(unlockHTML))
@@ -0,0 +1,15 @@
+//go:build !postgres
+
+package integration_tests
+
+import (
+	"github.com/ivinayakg/shorte.live/api/helpers"
+)
+
+// without the postgres build tag there is no TimescaleDB, analytics stay disabled
+// and redirects aren't tracked
+func setupTestAnalytics() func() {
+	helpers.Tracker = nil
+
+	return func() {}
+}
@@ -0,0 +1,27 @@
+//go:build postgres
+
+package integration_tests
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ivinayakg/shorte.live/api/helpers"
+	"github.com/ivinayakg/shorte.live/api/timescale"
+)
+
+func setupTestAnalytics() func() {
+	if err := timescale.SetupTimeScale(); err != nil {
+		log.Fatal(err)
+	}
+	helpers.SetupTracker(time.Second*2, 5, 0)
+
+	ctx, stopFlush := context.WithCancel(context.Background())
+	go helpers.Tracker.StartFlush(ctx)
+
+	return func() {
+		stopFlush()
+		timescale.Close()
+	}
+}
@@ -0,0 +1,121 @@
+package integration_tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ivinayakg/shorte.live/api/constants"
+	"github.com/ivinayakg/shorte.live/api/database"
+	"github.com/ivinayakg/shorte.live/api/helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+// sendWithKey sends the request with the API key as bearer token
+func sendWithKey(t *testing.T, key string, method string, path string, payload interface{}, dest interface{}) *http.Response {
+	var body bytes.Buffer
+	if payload != nil {
+		json.NewEncoder(&body).Encode(payload)
+	}
+
+	req, _ := http.NewRequest(method, ServerURL+path, &body)
+	req.Header.Set("Authorization", "Bearer "+key)
+
+	resp, err := HttpClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dest != nil {
+		json.NewDecoder(resp.Body).Decode(dest)
+	}
+	return resp
+}
+
+func TestAPIKey(t *testing.T) {
+	// a user of its own, so the urls created with the keys don't show up in the other tests
+	keyUser := database.User{Name: "API Key User", Email: "apikey@gmail.com", Picture: "https://lh3.googleusercontent.com/a-/AOh14Gh"}
+	TestStore.User.Insert(&keyUser)
+
+	readKey := map[string]interface{}{}
+	resp := sendAs(t, &keyUser, http.MethodPost, "/user/api_keys", map[string]interface{}{"name": "ci read", "scopes": []string{"url:read"}}, &readKey)
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, "Excpected status code to be 201")
+	readToken, _ := readKey["key"].(string)
+	assert.True(t, strings.HasPrefix(readToken, "shorte_"), "Expected the plain key to be returned")
+	assert.True(t, strings.HasPrefix(readToken, readKey["prefix"].(string)), "Expected the prefix to match the key")
+
+	keys := []map[string]interface{}{}
+	sendAs(t, &keyUser, http.MethodGet, "/user/api_keys", nil, &keys)
+	assert.Len(t, keys, 1, "Expected the key to be listed")
+	assert.NotContains(t, keys[0], "key", "Expected the plain key not to be listed")
+	assert.NotContains(t, keys[0], "hash", "Expected the key hash not to be listed")
+
+	respBody := map[string]interface{}{}
+	resp = sendAs(t, &keyUser, http.MethodPost, "/user/api_keys", map[string]interface{}{"name": "bad", "scopes": []string{"url:admin"}}, &respBody)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Excpected status code to be 400")
+	assert.Equal(t, "invalid scope url:admin", respBody["error"], "Expected unknown scopes to be rejected")
+
+	t.Run("TestScopes", func(t *testing.T) {
+		// API keys work in prod too, unlike jwt bearer tokens
+		helpers.ENV = string(constants.Prod)
+		defer func() { helpers.ENV = "test" }()
+
+		resp := sendWithKey(t, readToken, http.MethodGet, "/url/all", nil, nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Excpected status code to be 200")
+
+		respBody := map[string]interface{}{}
+		resp = sendWithKey(t, readToken, http.MethodPost, "/url", map[string]string{"destination": "https://www.google.com"}, &respBody)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, "Excpected status code to be 403")
+		assert.Equal(t, "Authentication error!, API key is missing the url:write scope", respBody["error"], "Expected the write scope to be required")
+
+		resp = sendWithKey(t, readToken, http.MethodGet, "/user/self", nil, nil)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, "Expected API keys to only work on the url routes")
+
+		resp = sendWithKey(t, "shorte_not-a-real-key", http.MethodGet, "/url/all", nil, nil)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, "Expected unknown keys to be rejected")
+	})
+
+	t.Run("TestRateLimit", func(t *testing.T) {
+		respBody := map[string]interface{}{}
+		resp := sendAs(t, &keyUser, http.MethodPost, "/user/api_keys", map[string]interface{}{"name": "unlimited", "rate_limit": map[string]int{"value": 1000000, "expiry": 30}}, &respBody)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Expected limits above the configured ones to be rejected")
+		assert.Equal(t, "rate limit value can be at most 10", respBody["error"])
+
+		resp = sendAs(t, &keyUser, http.MethodPost, "/user/api_keys", map[string]interface{}{"name": "short window", "rate_limit": map[string]int{"value": 10, "expiry": 1}}, &respBody)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Expected windows shorter than the configured ones to be rejected")
+
+		writeKey := map[string]interface{}{}
+		sendAs(t, &keyUser, http.MethodPost, "/user/api_keys", map[string]interface{}{"name": "ci write", "rate_limit": map[string]int{"value": 1, "expiry": 30}}, &writeKey)
+		writeToken, _ := writeKey["key"].(string)
+
+		resp = sendWithKey(t, writeToken, http.MethodPost, "/url", map[string]string{"destination": "https://www.google.com"}, nil)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, "Excpected status code to be 201")
+
+		resp = sendWithKey(t, writeToken, http.MethodPost, "/url", map[string]string{"destination": "https://www.google.com"}, nil)
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode, "Expected the key's own rate limit to apply")
+
+		// a key stored before limits were validated is still capped by the route limit
+		looseToken, _, err := TestModels.CreateAPIKey(&keyUser, "loose", database.APIKeyScopes, &database.APIKeyRateLimit{Value: 1000000, Expiry: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 10; i++ {
+			sendWithKey(t, looseToken, http.MethodPost, "/url", map[string]string{"destination": "https://www.google.com"}, nil)
+		}
+		resp = sendWithKey(t, looseToken, http.MethodPost, "/url", map[string]string{"destination": "https://www.google.com"}, nil)
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode, "Expected the route limit to cap the key's limit")
+	})
+
+	t.Run("TestRevoke", func(t *testing.T) {
+		resp := sendAs(t, &UserFixture2, http.MethodDelete, "/user/api_keys/"+readKey["_id"].(string), nil, nil)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Expected other users not to revoke the key")
+
+		resp = sendAs(t, &keyUser, http.MethodDelete, "/user/api_keys/"+readKey["_id"].(string), nil, nil)
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode, "Excpected status code to be 204")
+
+		resp = sendWithKey(t, readToken, http.MethodGet, "/url/all", nil, nil)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, "Expected revoked keys to be rejected")
+	})
+}
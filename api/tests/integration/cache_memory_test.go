@@ -0,0 +1,10 @@
+//go:build !redis
+
+package integration_tests
+
+import "github.com/ivinayakg/shorte.live/api/helpers"
+
+// without the redis build tag the suite runs against the in-process cache
+func setupTestCache() helpers.CacheDB {
+	return helpers.NewMemoryDB()
+}
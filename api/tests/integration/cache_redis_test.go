@@ -0,0 +1,13 @@
+//go:build redis
+
+package integration_tests
+
+import (
+	"os"
+
+	"github.com/ivinayakg/shorte.live/api/helpers"
+)
+
+func setupTestCache() helpers.CacheDB {
+	return helpers.RedisSetup(os.Getenv("REDIS_URL"))
+}
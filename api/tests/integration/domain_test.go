@@ -0,0 +1,158 @@
+package integration_tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ivinayakg/shorte.live/api/controllers"
+	"github.com/ivinayakg/shorte.live/api/database"
+	"github.com/ivinayakg/shorte.live/api/helpers"
+	"github.com/ivinayakg/shorte.live/api/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubResolver answers TXT lookups from a map instead of DNS
+type stubResolver map[string][]string
+
+func (s stubResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	records, found := s[name]
+	if !found {
+		return nil, errors.New("no such host")
+	}
+	return records, nil
+}
+
+// resolveOnHost resolves the short with the Host header of a custom domain
+func resolveOnHost(t *testing.T, host string, short string) *http.Response {
+	req, _ := http.NewRequest(http.MethodGet, ServerURL+"/"+short, nil)
+	req.Host = host
+
+	resp, err := RedirecthttpClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestDomain(t *testing.T) {
+	// a user of its own, so the domain urls don't show up in the other tests
+	domainUser := database.User{Name: "Domain User", Email: "domain@gmail.com", Picture: "https://lh3.googleusercontent.com/a-/AOh14Gh"}
+	TestStore.User.Insert(&domainUser)
+
+	resolver := stubResolver{}
+	defaultResolver := helpers.Resolver
+	helpers.Resolver = resolver
+	defer func() { helpers.Resolver = defaultResolver }()
+
+	respBody := map[string]interface{}{}
+	resp := sendAs(t, &domainUser, http.MethodPost, "/domain", map[string]string{"host": "not a domain"}, &respBody)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Excpected status code to be 400")
+	assert.Equal(t, "invalid domain", respBody["error"])
+
+	domain := controllers.RegisterDomainResponse{}
+	resp = sendAs(t, &domainUser, http.MethodPost, "/domain", map[string]string{"host": "Links.Example.com"}, &domain)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, "Excpected status code to be 201")
+	assert.Equal(t, "links.example.com", domain.Host, "Expected the host to be normalized")
+	assert.Equal(t, "_shorte-verification.links.example.com", domain.Record)
+	assert.False(t, domain.Verified)
+
+	domainPath := "/domain/" + domain.ID.Hex()
+
+	t.Run("TestUnverifiedDomain", func(t *testing.T) {
+		respBody := map[string]interface{}{}
+		resp := sendAs(t, &domainUser, http.MethodPost, "/url", map[string]string{"destination": "https://www.google.com", "short": "branded", "domain": domain.Host}, &respBody)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Expected links not to be created on unverified domains")
+		assert.Equal(t, "domain is not verified", respBody["error"])
+
+		resp = sendAs(t, &domainUser, http.MethodPost, domainPath+"/verify", nil, &respBody)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Expected verification to fail without the TXT record")
+
+		resolver[domain.Record] = []string{"v=spf1 -all", "shorte-verification=wrong"}
+		resp = sendAs(t, &domainUser, http.MethodPost, domainPath+"/verify", nil, &respBody)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Expected verification to fail with the wrong token")
+	})
+
+	resolver[domain.Record] = []string{"v=spf1 -all", domain.Token}
+	verified := database.Domain{}
+	resp = sendAs(t, &domainUser, http.MethodPost, domainPath+"/verify", nil, &verified)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "Excpected status code to be 200")
+	assert.True(t, verified.Verified, "Expected the domain to be verified")
+
+	t.Run("TestDomainTaken", func(t *testing.T) {
+		other := controllers.RegisterDomainResponse{}
+		sendAs(t, &UserFixture2, http.MethodPost, "/domain", map[string]string{"host": domain.Host}, &other)
+
+		resp := sendAs(t, &UserFixture2, http.MethodPost, "/domain/"+other.ID.Hex()+"/verify", nil, nil)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode, "Expected a verified host not to be verified twice")
+
+		sendAs(t, &UserFixture2, http.MethodDelete, "/domain/"+other.ID.Hex(), nil, nil)
+	})
+
+	url := map[string]interface{}{}
+	resp = sendAs(t, &domainUser, http.MethodPost, "/url", map[string]string{"destination": "https://www.example.org", "short": URLFixture.Short, "domain": domain.Host}, &url)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, "Expected the same short to be free on another domain")
+	assert.Equal(t, "http://links.example.com/"+URLFixture.Short, url["short"])
+	assert.Equal(t, domain.Host, url["domain"])
+
+	resp = sendAs(t, &domainUser, http.MethodPost, "/url", map[string]string{"destination": "https://www.example.org", "short": URLFixture.Short, "domain": domain.Host}, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Expected shorts to stay unique on a domain")
+
+	resp = sendAs(t, &domainUser, http.MethodPost, "/url", map[string]string{"destination": "https://www.example.net", "short": "branded-2", "domain": domain.Host}, nil)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, "Excpected status code to be 201")
+
+	t.Run("TestResolveByHost", func(t *testing.T) {
+		resp := resolveOnHost(t, "links.example.com:443", URLFixture.Short)
+		assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode, "Excpected status code to be 301")
+		assert.Equal(t, "https://www.example.org", resp.Header.Get("Location"), "Expected the link of the domain")
+
+		resp = resolveOnHost(t, "unknown.example.com", URLFixture.Short)
+		assert.Equal(t, URLFixture.Destination, resp.Header.Get("Location"), "Expected unknown hosts to serve the default domain")
+	})
+
+	t.Run("TestOriginHandler", func(t *testing.T) {
+		handler := middleware.OriginHandler(TestModels)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		for path, status := range map[string]int{"/url/all": http.StatusTemporaryRedirect, "/" + URLFixture.Short: http.StatusOK} {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://links.example.com"+path, nil))
+			assert.Equal(t, status, rec.Code, path)
+
+			rec = httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://api.example.com"+path, nil))
+			assert.Equal(t, http.StatusOK, rec.Code, "Expected other hosts to pass through")
+		}
+	})
+
+	domains := []*database.Domain{}
+	sendAs(t, &domainUser, http.MethodGet, "/domain/all", nil, &domains)
+	assert.Len(t, domains, 1)
+
+	resp = sendAs(t, &domainUser, http.MethodDelete, domainPath, nil, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode, "Excpected status code to be 204")
+
+	resp = resolveOnHost(t, "links.example.com", URLFixture.Short)
+	assert.Equal(t, URLFixture.Destination, resp.Header.Get("Location"), "Expected removed domains to stop resolving their links")
+
+	t.Run("TestDeletedDomainLinks", func(t *testing.T) {
+		urls, _ := TestStore.URL.Find(database.URLFilter{Domain: domain.Host})
+		assert.Empty(t, urls, "Expected the links of a removed domain to be deleted")
+
+		other := controllers.RegisterDomainResponse{}
+		sendAs(t, &UserFixture2, http.MethodPost, "/domain", map[string]string{"host": domain.Host}, &other)
+		resolver[other.Record] = []string{other.Token}
+		resp := sendAs(t, &UserFixture2, http.MethodPost, "/domain/"+other.ID.Hex()+"/verify", nil, nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Expected a removed host to be free again")
+
+		for short, destination := range map[string]string{URLFixture.Short: "https://www.example.org", "branded-2": "https://www.example.net"} {
+			resp = resolveOnHost(t, "links.example.com", short)
+			assert.NotEqual(t, destination, resp.Header.Get("Location"), "Expected the new owner not to take over the old links: "+short)
+		}
+
+		sendAs(t, &UserFixture2, http.MethodDelete, "/domain/"+other.ID.Hex(), nil, nil)
+	})
+}
@@ -1,7 +1,6 @@
 package integration_tests
 
 import (
-	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -14,17 +13,16 @@ import (
 	"github.com/ivinayakg/shorte.live/api/database"
 	"github.com/ivinayakg/shorte.live/api/helpers"
 	"github.com/ivinayakg/shorte.live/api/middleware"
-	"github.com/ivinayakg/shorte.live/api/timescale"
+	"github.com/ivinayakg/shorte.live/api/models"
 	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 var (
-	ServerURL    string
-	TestDb       *database.DB
-	TestRedis    *helpers.RedisDB
-	TestDbClient *mongo.Client
+	ServerURL  string
+	TestStore  *database.Store
+	TestModels *models.Models
+	TestCache  helpers.CacheDB
 )
 
 // Test remaining for
@@ -47,79 +45,115 @@ func TestMain(m *testing.M) {
 }
 
 func setupTests() func() {
-	// Set up HTTP server
-	router := setupRouter()
-	server := httptest.NewServer(router)
-	ServerURL = server.URL
 	err := godotenv.Load("../test.env")
 	if err != nil {
 		fmt.Println(err)
 	}
-	database.CreateDBInstance()
-	timescale.SetupTimeScale()
-	helpers.RedisSetup()
-	helpers.SetupTracker(time.Second*2, 5, 0)
-	helpers.ENV = "test"
+	store, teardownStore := setupTestStore()
+	TestModels = models.New(store)
+	helpers.Cache = setupTestCache()
+	TestModels.SetupVisitRecorder(time.Hour)
+	// deliveries are sent by the tests with Deliver, failed ones are due again right away
+	TestModels.SetupWebhookDispatcher(time.Hour, 0)
 
-	go helpers.Tracker.StartFlush()
+	// Set up HTTP server
+	router := setupRouter(TestModels, controllers.NewHandler(TestModels))
+	server := httptest.NewServer(router)
+	ServerURL = server.URL
+	// webhook receivers in the tests listen on loopback
+	helpers.AllowPrivateNetworks = true
+	teardownAnalytics := setupTestAnalytics()
+	helpers.ENV = "test"
 
-	TestDb = database.CurrentDb
-	TestRedis = helpers.Redis
-	TestDbClient = database.DBClient
+	TestStore = store
+	TestCache = helpers.Cache
 	// clean up database after tests
 
-	CreateFixtures(TestDb)
+	CreateFixtures(TestStore)
 
 	return func() {
 		server.Close()
-		TestRedis.Client.FlushAll(context.Background())
-		TestDbClient.Database(os.Getenv("DB_NAME")).Drop(context.Background())
+		TestCache.FlushAll()
+		teardownAnalytics()
+		teardownStore()
 	}
 }
 
-func setupRouter() *mux.Router {
+func setupRouter(m *models.Models, h *controllers.Handler) *mux.Router {
 	router := mux.NewRouter()
 	protectedRouter := router.PathPrefix("/").Subrouter()
-	protectedRouter.Use(middleware.Authentication)
+	protectedRouter.Use(middleware.Authentication(m))
+	urlRouter := router.PathPrefix("/url").Subrouter()
+	urlRouter.Use(middleware.APIKeyAuthentication(m, database.ScopeURLRead, database.ScopeURLWrite))
 
 	// user routes
 	router.HandleFunc("/user/sign_in_with_google", controllers.SignInWithGoogle).Methods("GET")
 	protectedRouter.HandleFunc("/user/self", controllers.SelfUser).Methods("GET")
+	protectedRouter.HandleFunc("/user/api_keys", h.CreateAPIKey).Methods("POST")
+	protectedRouter.HandleFunc("/user/api_keys", h.GetUserAPIKeys).Methods("GET")
+	protectedRouter.HandleFunc("/user/api_keys/{id}", h.DeleteAPIKey).Methods("DELETE")
 
 	// url resolve routes
-	router.HandleFunc("/{short}", controllers.ResolveURL).Methods("GET")
+	router.HandleFunc("/{short}", h.ResolveURL).Methods("GET")
+	router.HandleFunc("/{short}", h.UnlockURL).Methods("POST")
 
 	// url routes
-	protectedRouter.HandleFunc("/url", controllers.ShortenURL).Methods("POST")
-	protectedRouter.HandleFunc("/url/all", controllers.GetUserURL).Methods("GET")
-	protectedRouter.HandleFunc("/url/{id}", controllers.UpdateUrl).Methods("PATCH")
-	protectedRouter.HandleFunc("/url/{id}", controllers.DeleteUrl).Methods("DELETE")
-	protectedRouter.HandleFunc("/url/{id}/stats", controllers.GetURLStats).Methods("GET")
+	urlRouter.HandleFunc("", h.ShortenURL).Methods("POST")
+	urlRouter.HandleFunc("/bulk", h.ShortenURLBulk).Methods("POST")
+	urlRouter.HandleFunc("/all", h.GetUserURL).Methods("GET")
+	urlRouter.HandleFunc("/{id}", h.UpdateUrl).Methods("PATCH")
+	urlRouter.HandleFunc("/{id}", h.DeleteUrl).Methods("DELETE")
+	urlRouter.HandleFunc("/{id}/stats", h.GetURLStats).Methods("GET")
+	urlRouter.HandleFunc("/{id}/qr", h.GetURLQRCode).Methods("GET")
+
+	// workspace routes
+	protectedRouter.HandleFunc("/workspace", h.CreateWorkspace).Methods("POST")
+	protectedRouter.HandleFunc("/workspace/all", h.GetUserWorkspaces).Methods("GET")
+	protectedRouter.HandleFunc("/workspace/invites", h.GetWorkspaceInvites).Methods("GET")
+	protectedRouter.HandleFunc("/workspace/{id}/invites", h.InviteToWorkspace).Methods("POST")
+	protectedRouter.HandleFunc("/workspace/{id}/invites/accept", h.AcceptWorkspaceInvite).Methods("POST")
+	protectedRouter.HandleFunc("/workspace/{id}/invites/{email}", h.RemoveWorkspaceInvite).Methods("DELETE")
+	protectedRouter.HandleFunc("/workspace/{id}/members/{user}", h.UpdateWorkspaceMember).Methods("PATCH")
+	protectedRouter.HandleFunc("/workspace/{id}/members/{user}", h.RemoveWorkspaceMember).Methods("DELETE")
+
+	// domain routes
+	protectedRouter.HandleFunc("/domain", h.RegisterDomain).Methods("POST")
+	protectedRouter.HandleFunc("/domain/all", h.GetUserDomains).Methods("GET")
+	protectedRouter.HandleFunc("/domain/{id}/verify", h.VerifyDomain).Methods("POST")
+	protectedRouter.HandleFunc("/domain/{id}", h.DeleteDomain).Methods("DELETE")
+
+	// webhook routes
+	protectedRouter.HandleFunc("/webhook", h.CreateWebhook).Methods("POST")
+	protectedRouter.HandleFunc("/webhook/all", h.GetUserWebhooks).Methods("GET")
+	protectedRouter.HandleFunc("/webhook/{id}", h.DeleteWebhook).Methods("DELETE")
+	protectedRouter.HandleFunc("/webhook/{id}/deliveries", h.GetWebhookDeliveries).Methods("GET")
+
+	// admin routes
+	adminRouter := protectedRouter.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(middleware.AdminOnly)
+	adminRouter.HandleFunc("/screening/rescan", h.RescanURLs).Methods("POST")
+	adminRouter.HandleFunc("/screening/flagged", h.GetFlaggedURLs).Methods("GET")
+	adminRouter.HandleFunc("/url/{id}/suspend", h.SuspendURL).Methods("POST")
+	adminRouter.HandleFunc("/url/{id}/suspend", h.UnsuspendURL).Methods("DELETE")
 
 	// system routes
-	router.HandleFunc("/system/available", controllers.SystemAvailable).Methods("GET")
+	router.HandleFunc("/system/available", h.SystemAvailable).Methods("GET")
+	router.HandleFunc("/system/health", controllers.SystemHealth).Methods("GET")
 	router.NotFoundHandler = http.HandlerFunc(controllers.NotFound)
 	router.HandleFunc("/", controllers.RedirectHome).Methods("GET", "POST", "PATCH", "DELETE")
 
 	return router
 }
 
-func CreateFixtures(db *database.DB) {
-	userRes, _ := db.User.InsertOne(context.Background(), UserFixture2)
-	UserFixture2.ID = userRes.InsertedID.(primitive.ObjectID)
-	userRes, _ = db.User.InsertOne(context.Background(), UserFixture1)
-	UserFixture1.ID = userRes.InsertedID.(primitive.ObjectID)
-
-	URLFixture.User = userRes.InsertedID.(primitive.ObjectID)
-	ExpiredURLFixture.User = userRes.InsertedID.(primitive.ObjectID)
+func CreateFixtures(store *database.Store) {
+	store.User.Insert(&UserFixture2)
+	store.User.Insert(&UserFixture1)
 
 	URLFixture.User = UserFixture1.ID
 	ExpiredURLFixture.User = UserFixture1.ID
 
-	urlRes, _ := db.Url.InsertOne(context.Background(), URLFixture)
-	fmt.Println(urlRes, "urlRes.InsertedID")
-	URLFixture.ID = urlRes.InsertedID.(primitive.ObjectID)
+	store.URL.Insert(URLFixture)
+	fmt.Println(URLFixture.ID, "URLFixture.ID")
 
-	urlRes, _ = db.Url.InsertOne(context.Background(), ExpiredURLFixture)
-	ExpiredURLFixture.ID = urlRes.InsertedID.(primitive.ObjectID)
+	store.URL.Insert(ExpiredURLFixture)
 }
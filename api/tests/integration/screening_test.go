@@ -0,0 +1,126 @@
+package integration_tests
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ivinayakg/shorte.live/api/database"
+	"github.com/ivinayakg/shorte.live/api/helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupTestScreener screens destinations against a blocklist of evil.com
+func setupTestScreener(t *testing.T, action helpers.ScreeningAction) {
+	path := filepath.Join(t.TempDir(), "domains.txt")
+	os.WriteFile(path, []byte("evil.com\n"), 0644)
+
+	list, err := helpers.NewDomainBlocklist(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	helpers.Screener = helpers.NewScreener(action)
+	helpers.Screener.AddBlocklist(list)
+}
+
+func TestScreening(t *testing.T) {
+	// users of their own, so the screened urls don't show up in the other tests
+	screeningUser := database.User{Name: "Screening User", Email: "screening@gmail.com", Picture: "https://lh3.googleusercontent.com/a-/AOh14Gh"}
+	adminUser := database.User{Name: "Admin User", Email: "admin@gmail.com", Picture: "https://lh3.googleusercontent.com/a-/AOh14Gh"}
+	TestStore.User.Insert(&screeningUser)
+	TestStore.User.Insert(&adminUser)
+	defer func() { helpers.Screener = nil }()
+
+	t.Run("TestBlock", func(t *testing.T) {
+		setupTestScreener(t, helpers.ScreeningBlock)
+
+		respBody := map[string]interface{}{}
+		resp := sendAs(t, &screeningUser, http.MethodPost, "/url", map[string]string{"destination": "https://login.evil.com/account"}, &respBody)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Excpected status code to be 400")
+		assert.Equal(t, "destination is blocked as unsafe", respBody["error"])
+
+		url := map[string]interface{}{}
+		resp = sendAs(t, &screeningUser, http.MethodPost, "/url", map[string]string{"destination": "https://www.google.com", "short": "screening-clean"}, &url)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, "Excpected status code to be 201")
+
+		clean, _ := TestModels.GetURL("screening-clean", "")
+		resp = sendAs(t, &screeningUser, http.MethodPatch, "/url/"+clean.ID.Hex(), map[string]string{"destination": "https://evil.com"}, &respBody)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Expected updates to be screened too")
+		assert.Equal(t, "destination is blocked as unsafe", respBody["error"])
+
+		// the coming soon url is served until the url activates, so it's a destination as well
+		activatesAt := time.Now().Add(time.Hour).Unix()
+		resp = sendAs(t, &screeningUser, http.MethodPost, "/url", map[string]interface{}{"destination": "https://www.google.com", "activates_at": activatesAt, "coming_soon_url": "https://login.evil.com"}, &respBody)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Expected the coming soon url to be screened")
+		assert.Equal(t, "destination is blocked as unsafe", respBody["error"])
+
+		resp = sendAs(t, &screeningUser, http.MethodPatch, "/url/"+clean.ID.Hex(), map[string]interface{}{"activates_at": activatesAt, "coming_soon_url": "https://login.evil.com"}, &respBody)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Expected coming soon url updates to be screened")
+		assert.Equal(t, "destination is blocked as unsafe", respBody["error"])
+	})
+
+	t.Run("TestFlag", func(t *testing.T) {
+		setupTestScreener(t, helpers.ScreeningFlag)
+
+		resp := sendAs(t, &screeningUser, http.MethodPost, "/url", map[string]string{"destination": "https://evil.com/flagged", "short": "screening-flagged"}, nil)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, "Expected flagged destinations to be accepted")
+
+		resp = sendAs(t, &screeningUser, http.MethodGet, "/admin/screening/flagged", nil, nil)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, "Expected non admins to be rejected")
+
+		flagged := []*database.URL{}
+		resp = sendAs(t, &adminUser, http.MethodGet, "/admin/screening/flagged", nil, &flagged)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Excpected status code to be 200")
+		if assert.Len(t, flagged, 1) {
+			assert.Equal(t, "evil.com", flagged[0].Screening.Match)
+		}
+	})
+
+	t.Run("TestRescan", func(t *testing.T) {
+		setupTestScreener(t, helpers.ScreeningFlag)
+		// a link created before its destination was listed
+		TestStore.URL.Insert(&database.URL{User: screeningUser.ID, Short: "screening-old", Destination: "https://cdn.evil.com/payload", Expiry: database.UnixTime(time.Now().Add(time.Hour).Unix())})
+
+		resp := sendAs(t, &adminUser, http.MethodPost, "/admin/screening/rescan?suspend=true", nil, nil)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode, "Excpected status code to be 202")
+		helpers.WaitBackground(context.Background())
+
+		flagged := []*database.URL{}
+		sendAs(t, &adminUser, http.MethodGet, "/admin/screening/flagged", nil, &flagged)
+		assert.Len(t, flagged, 2, "Expected the old and the flagged link to match")
+		for _, url := range flagged {
+			assert.True(t, url.Suspended, "Expected the flagged links to be suspended")
+		}
+
+		resp, _ = RedirecthttpClient.Get(ServerURL + "/screening-old")
+		assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode, "Expected suspended links not to resolve")
+	})
+
+	t.Run("TestSuspend", func(t *testing.T) {
+		clean, _ := TestModels.GetURL("screening-clean", "")
+
+		resp := sendAs(t, &adminUser, http.MethodPost, "/admin/url/"+clean.ID.Hex()+"/suspend", map[string]string{}, nil)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Expected a reason to be required")
+
+		resp = sendAs(t, &adminUser, http.MethodPost, "/admin/url/"+clean.ID.Hex()+"/suspend", map[string]string{"reason": "spam"}, nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Excpected status code to be 200")
+
+		resp, _ = RedirecthttpClient.Get(ServerURL + "/screening-clean")
+		assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode, "Expected suspended links not to resolve")
+		assert.Contains(t, resp.Header.Get("Location"), "message=spam", "Expected the suspension reason on the not found page")
+
+		respBody := map[string]interface{}{}
+		resp = sendAs(t, &screeningUser, http.MethodPatch, "/url/"+clean.ID.Hex(), map[string]bool{"active": true}, &respBody)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, "Expected owners not to override a suspension")
+
+		helpers.WaitBackground(context.Background())
+		resp = sendAs(t, &adminUser, http.MethodDelete, "/admin/url/"+clean.ID.Hex()+"/suspend", nil, nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Excpected status code to be 200")
+
+		resp, _ = RedirecthttpClient.Get(ServerURL + "/screening-clean")
+		assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode, "Expected unsuspended links to resolve again")
+	})
+}
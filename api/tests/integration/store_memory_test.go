@@ -0,0 +1,10 @@
+//go:build !mongo
+
+package integration_tests
+
+import "github.com/ivinayakg/shorte.live/api/database"
+
+// without the mongo build tag the suite runs against the in-memory store
+func setupTestStore() (*database.Store, func()) {
+	return database.NewMemoryStore(), func() {}
+}
@@ -0,0 +1,17 @@
+//go:build mongo
+
+package integration_tests
+
+import (
+	"context"
+	"os"
+
+	"github.com/ivinayakg/shorte.live/api/database"
+)
+
+func setupTestStore() (*database.Store, func()) {
+	db := database.CreateDBInstance()
+	return database.NewMongoStore(db), func() {
+		db.Client.Database(os.Getenv("DB_NAME")).Drop(context.Background())
+	}
+}
@@ -17,7 +17,7 @@ func TestURLSystemAvailability(t *testing.T) {
 		t.Log(err)
 		t.Fail()
 	}
-	testhelper.PutSystemUnderMaintenance(helpers.Redis, false)
+	testhelper.PutSystemUnderMaintenance(helpers.Cache, false)
 
 	// Send the request using the default HTTP client
 	client := &http.Client{}
@@ -42,7 +42,7 @@ func TestURLSystemAvailabilityFail(t *testing.T) {
 		t.Fail()
 	}
 
-	testhelper.PutSystemUnderMaintenance(helpers.Redis, true)
+	testhelper.PutSystemUnderMaintenance(helpers.Cache, true)
 
 	// Send the request using the default HTTP client
 	client := &http.Client{}
@@ -60,6 +60,25 @@ func TestURLSystemAvailabilityFail(t *testing.T) {
 	assert.Equal(t, resp.StatusCode, http.StatusOK, "Expected status code to be 200")
 }
 
+func TestSystemHealth(t *testing.T) {
+	resp, err := HttpClient.Get(ServerURL + "/system/health")
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+
+	body := map[string]interface{}{}
+
+	json.NewDecoder(resp.Body).Decode(&body)
+
+	analytics, _ := body["analytics"].(map[string]interface{})
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "Expected status code to be 200")
+	assert.Equal(t, "ok", body["status"], "Expected status to be ok")
+	assert.Equal(t, helpers.Tracker != nil, analytics["enabled"], "Expected analytics enabled to match the tracker setup")
+	assert.Equal(t, true, analytics["healthy"], "Expected analytics to be healthy")
+}
+
 func TestNotFound(t *testing.T) {
 	resp, err := RedirecthttpClient.Get(ServerURL + "/" + "something/random")
 	if err != nil {
@@ -1,7 +1,10 @@
+//go:build postgres
+
 package integration_tests
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"testing"
@@ -9,6 +12,7 @@ import (
 
 	"github.com/ivinayakg/shorte.live/api/database"
 	"github.com/ivinayakg/shorte.live/api/timescale"
+	"github.com/ivinayakg/shorte.live/api/utils"
 	"github.com/jackc/pgx/v5"
 	"github.com/stretchr/testify/assert"
 )
@@ -28,10 +32,10 @@ func TestURLRedirectTracking(t *testing.T) {
 	result := &database.ClickEvent{}
 
 	for result.URLId == "" {
-		clickEventSelectQuery := `SELECT url_id, geo, device, os, referrer, timestamp FROM click_events WHERE url_id = $1 LIMIT 1;`
+		clickEventSelectQuery := `SELECT url_id, geo, device, os, referrer, rule, timestamp FROM click_events WHERE url_id = $1 LIMIT 1;`
 
 		fmt.Println(clickEventSelectQuery, URLFixture.ID)
-		err = timescale.TimescaleDB.QueryRow(context.TODO(), clickEventSelectQuery, URLFixture.ID.Hex()).Scan(&result.URLId, &result.Geo, &result.Device, &result.OS, &result.Referrer, &result.Timestamp)
+		err = timescale.DB().QueryRow(context.TODO(), clickEventSelectQuery, URLFixture.ID.Hex()).Scan(&result.URLId, &result.Geo, &result.Device, &result.OS, &result.Referrer, &result.Rule, &result.Timestamp)
 		if err != nil && err != pgx.ErrNoRows {
 			t.Log(err)
 			t.Fail()
@@ -42,4 +46,38 @@ func TestURLRedirectTracking(t *testing.T) {
 	fmt.Println((*result).URLId == URLFixture.ID.Hex())
 
 	assert.Equal(t, (*result).URLId, URLFixture.ID.Hex(), "Expected URL ID to be the same")
+	assert.Equal(t, database.DefaultClickRule, result.Rule, "Expected the click to be recorded without a rule")
+}
+
+func TestURLStatsClickSeries(t *testing.T) {
+	userJwt, _ := utils.CreateJWT(&UserFixture1)
+	authCookie := utils.CreateAuthCookie(*userJwt)
+
+	start := time.Now().Add(-time.Hour * 5).Unix()
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("%v/url/%v/stats?interval=hour&start=%v", ServerURL, URLFixture.ID.Hex(), start), nil)
+
+	req.AddCookie(authCookie)
+
+	resp, err := HttpClient.Do(req)
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+
+	respBody := struct {
+		Data struct {
+			ClickSeries []database.ClickBucket `json:"click_series"`
+			DeviceCount map[string]int         `json:"device_counts"`
+		} `json:"data"`
+	}{}
+	json.NewDecoder(resp.Body).Decode(&respBody)
+
+	total := 0
+	for _, bucket := range respBody.Data.ClickSeries {
+		total += bucket.Clicks
+	}
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "Excpected status code to be 200")
+	assert.GreaterOrEqual(t, len(respBody.Data.ClickSeries), 5, "Expected a gap filled bucket per hour")
+	assert.Equal(t, respBody.Data.DeviceCount["total"], total, "Expected the series to add up to the total clicks")
 }
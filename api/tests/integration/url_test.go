@@ -2,13 +2,19 @@ package integration_tests
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"image/png"
 	"net/http"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
-	"github.com/ivinayakg/shorte.live/api/models"
+	"github.com/ivinayakg/shorte.live/api/controllers"
+	"github.com/ivinayakg/shorte.live/api/database"
+	"github.com/ivinayakg/shorte.live/api/helpers"
 	"github.com/ivinayakg/shorte.live/api/utils"
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -219,6 +225,17 @@ func TestCreateShortedUrlWithPreoccupiedShort(t *testing.T) {
 	assert.Equal(t, respBody["error"], "can't use this short", "Expected short to be a preoccupied short")
 }
 
+func TestCreateShortedUrlWithPartOfPreoccupiedShort(t *testing.T) {
+	// a user of its own, so the urls don't show up in the other tests
+	shortsUser := database.User{Name: "Shorts User", Email: "shorts@gmail.com", Picture: "https://lh3.googleusercontent.com/a-/AOh14Gh"}
+	TestStore.User.Insert(&shortsUser)
+
+	for _, short := range []string{"a", "in", "do", "main", "web", "hook"} {
+		resp := sendAs(t, &shortsUser, http.MethodPost, "/url", map[string]string{"destination": "https://www.google.com", "short": short}, nil)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, "Expected only whole preoccupied shorts to be rejected: "+short)
+	}
+}
+
 func TestCreateShortedUrlWithInvalidShort(t *testing.T) {
 	// Data for the payload as a map
 	payloadData := map[string]interface{}{
@@ -283,6 +300,269 @@ func TestCreateShortedUrlWithDuplicateShort(t *testing.T) {
 	assert.Equal(t, respBody["error"], "URL custom short is already in user", "Expected short to be already in use")
 }
 
+func TestCreateShortedUrlBulk(t *testing.T) {
+	// a user of its own, every bulk url counts against the user's shorten quota
+	bulkUser := database.User{Name: "Bulk User", Email: "bulk@gmail.com", Picture: "https://lh3.googleusercontent.com/a-/AOh14Gh"}
+	TestStore.User.Insert(&bulkUser)
+
+	payloadData := []map[string]interface{}{
+		{"destination": "https://www.google.com", "short": "bulk-short-1", "expiry": time.Now().Add(time.Hour * 5).Unix()},
+		{"destination": "not-a-url", "short": "bulk-short-2"},
+		{"destination": "https://www.google.com", "short": URLFixture.Short},
+		{"destination": "https://www.google.com", "short": "bulk-short-1"},
+		{"destination": "https://www.google.com"},
+	}
+
+	payloadJSON, _ := json.Marshal(payloadData)
+
+	userJwt, _ := utils.CreateJWT(&bulkUser)
+	authCookie := utils.CreateAuthCookie(*userJwt)
+
+	req, _ := http.NewRequest(http.MethodPost, ServerURL+"/url/bulk", bytes.NewBuffer(payloadJSON))
+
+	req.AddCookie(authCookie)
+
+	resp, err := HttpClient.Do(req)
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+
+	respBody := struct {
+		Created int                      `json:"created"`
+		Failed  int                      `json:"failed"`
+		Results []map[string]interface{} `json:"results"`
+	}{}
+
+	json.NewDecoder(resp.Body).Decode(&respBody)
+
+	assert.Equal(t, http.StatusMultiStatus, resp.StatusCode, "Excpected status code to be 207")
+	assert.Equal(t, 2, respBody.Created, "Expected 2 urls to be created")
+	assert.Equal(t, 3, respBody.Failed, "Expected 3 urls to fail")
+	assert.Equal(t, "created", respBody.Results[0]["status"], "Expected first url to be created")
+	assert.Contains(t, respBody.Results[0]["short"], "bulk-short-1", "Expected short to be bulk-short-1")
+	assert.Equal(t, "invalid url", respBody.Results[1]["error"], "Expected second url to be invalid")
+	assert.Equal(t, "URL custom short is already in user", respBody.Results[2]["error"], "Expected third url short to be already in use")
+	assert.Equal(t, "URL custom short is already in user", respBody.Results[3]["error"], "Expected fourth url short to be duplicated in batch")
+	assert.Equal(t, "created", respBody.Results[4]["status"], "Expected fifth url to be created with a random short")
+
+	t.Run("TestBulkQuota", func(t *testing.T) {
+		// 5 of the 10 urls of the quota are used, a batch of 6 doesn't fit
+		batch := []map[string]interface{}{}
+		for i := 0; i < 6; i++ {
+			batch = append(batch, map[string]interface{}{"destination": "https://www.google.com"})
+		}
+		resp := sendAs(t, &bulkUser, http.MethodPost, "/url/bulk", batch, nil)
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode, "Expected the batch to be charged per url")
+
+		resp = sendAs(t, &bulkUser, http.MethodPost, "/url/bulk", batch[:5], nil)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, "Expected a batch within the quota to be created")
+
+		resp = sendAs(t, &bulkUser, http.MethodPost, "/url", map[string]string{"destination": "https://www.google.com"}, nil)
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode, "Expected bulk urls to use up the single url quota")
+	})
+}
+
+func TestCreateShortedUrlBulkCSV(t *testing.T) {
+	payloadCSV := "destination,short,expiry\nhttps://www.google.com,bulk-csv-1,\nhttps://www.google.com,bulk-csv-2,\n"
+
+	csvUser := database.User{Name: "Bulk CSV User", Email: "bulkcsv@gmail.com", Picture: "https://lh3.googleusercontent.com/a-/AOh14Gh"}
+	TestStore.User.Insert(&csvUser)
+	userJwt, _ := utils.CreateJWT(&csvUser)
+	authCookie := utils.CreateAuthCookie(*userJwt)
+
+	req, _ := http.NewRequest(http.MethodPost, ServerURL+"/url/bulk", bytes.NewBufferString(payloadCSV))
+	req.Header.Set("Content-Type", "text/csv")
+
+	req.AddCookie(authCookie)
+
+	resp, err := HttpClient.Do(req)
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+
+	respBody := map[string]interface{}{}
+
+	json.NewDecoder(resp.Body).Decode(&respBody)
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, "Excpected status code to be 201")
+	assert.Equal(t, float64(2), respBody["created"], "Expected 2 urls to be created")
+}
+
+func TestProtectedURL(t *testing.T) {
+	payloadData := map[string]interface{}{
+		"destination": "https://www.google.com",
+		"short":       "protected-short",
+		"password":    "secret",
+	}
+
+	payloadJSON, _ := json.Marshal(payloadData)
+
+	userJwt, _ := utils.CreateJWT(&UserFixture1)
+	authCookie := utils.CreateAuthCookie(*userJwt)
+
+	req, _ := http.NewRequest(http.MethodPost, ServerURL+"/url", bytes.NewBuffer(payloadJSON))
+
+	req.AddCookie(authCookie)
+
+	resp, err := HttpClient.Do(req)
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+
+	respBody := map[string]interface{}{}
+
+	json.NewDecoder(resp.Body).Decode(&respBody)
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, "Excpected status code to be 201")
+	assert.Equal(t, true, respBody["protected"], "Expected url to be protected")
+
+	resp, err = RedirecthttpClient.Get(ServerURL + "/protected-short")
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "Excpected status code to be 200")
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/html", "Expected the unlock form")
+
+	resp, err = RedirecthttpClient.PostForm(ServerURL+"/protected-short", map[string][]string{"password": {"wrong"}})
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "Excpected status code to be 401")
+
+	resp, err = RedirecthttpClient.PostForm(ServerURL+"/protected-short", map[string][]string{"password": {"secret"}})
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+
+	assert.Equal(t, http.StatusSeeOther, resp.StatusCode, "Excpected status code to be 303")
+	assert.Equal(t, 1, len(resp.Cookies()), "Expected an unlock cookie")
+
+	req, _ = http.NewRequest(http.MethodGet, ServerURL+"/protected-short", nil)
+	for _, cookie := range resp.Cookies() {
+		req.AddCookie(cookie)
+	}
+
+	resp, err = RedirecthttpClient.Do(req)
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+
+	assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode, "Excpected status code to be 301")
+	assert.Contains(t, resp.Header.Get("Location"), "https://www.google.com", "Expected redirect to destination url")
+}
+
+func TestClickLimitedURL(t *testing.T) {
+	payloadData := map[string]interface{}{
+		"destination": "https://www.google.com",
+		"short":       "limited-short",
+		"max_clicks":  2,
+	}
+
+	payloadJSON, _ := json.Marshal(payloadData)
+
+	userJwt, _ := utils.CreateJWT(&UserFixture2)
+	authCookie := utils.CreateAuthCookie(*userJwt)
+
+	req, _ := http.NewRequest(http.MethodPost, ServerURL+"/url", bytes.NewBuffer(payloadJSON))
+
+	req.AddCookie(authCookie)
+
+	resp, err := HttpClient.Do(req)
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, "Excpected status code to be 201")
+
+	for i := 0; i < 2; i++ {
+		resp, err = RedirecthttpClient.Get(ServerURL + "/limited-short")
+		if err != nil {
+			t.Log(err)
+			t.Fail()
+		}
+		assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode, "Excpected status code to be 301")
+	}
+
+	resp, err = RedirecthttpClient.Get(ServerURL + "/limited-short")
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode, "Excpected status code to be 307")
+	assert.Contains(t, resp.Header.Get("Location"), os.Getenv("UI_NOT_FOUND_URL"), "Expected redirect to url-not-found page")
+
+	req, _ = http.NewRequest(http.MethodGet, ServerURL+"/url/all", nil)
+	req.AddCookie(authCookie)
+
+	resp, err = HttpClient.Do(req)
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+
+	respBody := []map[string]interface{}{}
+
+	json.NewDecoder(resp.Body).Decode(&respBody)
+
+	assert.Equal(t, 1, len(respBody), "Expected 1 url")
+	assert.Equal(t, float64(2), respBody[0]["total_clicks"], "Expected 2 clicks")
+	assert.Equal(t, float64(2), respBody[0]["max_clicks"], "Expected a limit of 2 clicks")
+}
+
+func TestURLVisitCounters(t *testing.T) {
+	url := &database.URL{User: UserFixture2.ID, Destination: "https://www.google.com", Expiry: database.UnixTime(time.Now().Add(time.Hour).Unix()), Short: "visited-short"}
+	TestStore.URL.Insert(url)
+
+	for i := 0; i < 3; i++ {
+		resp, err := RedirecthttpClient.Get(ServerURL + "/visited-short")
+		if err != nil {
+			t.Log(err)
+			t.Fail()
+		}
+		assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode, "Excpected status code to be 301")
+	}
+
+	TestModels.Visits.Flush()
+
+	userJwt, _ := utils.CreateJWT(&UserFixture2)
+	authCookie := utils.CreateAuthCookie(*userJwt)
+
+	req, _ := http.NewRequest(http.MethodGet, ServerURL+"/url/all", nil)
+	req.AddCookie(authCookie)
+
+	resp, err := HttpClient.Do(req)
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+
+	respBody := []map[string]interface{}{}
+
+	json.NewDecoder(resp.Body).Decode(&respBody)
+
+	var visited map[string]interface{}
+	for _, item := range respBody {
+		if item["_id"] == url.ID.Hex() {
+			visited = item
+		}
+	}
+
+	assert.NotNil(t, visited, "Expected the url in the user urls")
+	assert.Equal(t, float64(3), visited["total_clicks"], "Expected 3 clicks")
+	assert.Greater(t, visited["last_visited"], float64(0), "Expected last visited to be set")
+}
+
 // update url
 func TestUpdateURL(t *testing.T) {
 	// Data for the payload as a map
@@ -312,7 +592,7 @@ func TestUpdateURL(t *testing.T) {
 
 	assert.Equal(t, resp.StatusCode, http.StatusNoContent, "Excpected status code to be 204")
 
-	url, _ := models.GetURL("new-short-update", "")
+	url, _ := TestModels.GetURL("new-short-update", "")
 	assert.Contains(t, url.Short, payloadData["short"], "Expected short to be new-short")
 }
 
@@ -434,3 +714,382 @@ func TestDeleteURLUnauthorized(t *testing.T) {
 	assert.Equal(t, resp.StatusCode, http.StatusBadRequest, "Excpected status code to be 400")
 	assert.Equal(t, respBody["error"], "mongo: no documents in result", "Expected error to be no documents in result for different user")
 }
+
+// url stats
+func TestURLStatsInvalidInterval(t *testing.T) {
+	userJwt, _ := utils.CreateJWT(&UserFixture1)
+	authCookie := utils.CreateAuthCookie(*userJwt)
+
+	req, _ := http.NewRequest(http.MethodGet, ServerURL+"/url/"+URLFixture.ID.Hex()+"/stats?interval=minute", nil)
+
+	req.AddCookie(authCookie)
+
+	resp, err := HttpClient.Do(req)
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+
+	var respBody map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&respBody)
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Excpected status code to be 400")
+	assert.Equal(t, "invalid interval, use hour, day or week", respBody["error"], "Expected error to be invalid interval")
+}
+
+func TestURLStatsAnalyticsDisabled(t *testing.T) {
+	if helpers.Tracker != nil {
+		t.Skip("analytics are enabled")
+	}
+
+	userJwt, _ := utils.CreateJWT(&UserFixture1)
+	authCookie := utils.CreateAuthCookie(*userJwt)
+
+	req, _ := http.NewRequest(http.MethodGet, ServerURL+"/url/"+URLFixture.ID.Hex()+"/stats", nil)
+
+	req.AddCookie(authCookie)
+
+	resp, err := HttpClient.Do(req)
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+
+	var respBody map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&respBody)
+
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode, "Excpected status code to be 503")
+	assert.Equal(t, "analytics is disabled", respBody["error"], "Expected error to be analytics disabled")
+}
+
+func TestURLQRCode(t *testing.T) {
+	resp := sendAs(t, &UserFixture1, http.MethodGet, "/url/"+URLFixture.ID.Hex()+"/qr?size=128", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "Excpected status code to be 200")
+	assert.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+
+	img, err := png.Decode(resp.Body)
+	assert.Nil(t, err, "Expected a png image")
+	if err == nil {
+		assert.Equal(t, 128, img.Bounds().Dx())
+	}
+
+	resp = sendAs(t, &UserFixture1, http.MethodGet, "/url/"+URLFixture.ID.Hex()+"/qr?format=svg", nil, nil)
+	assert.Equal(t, "image/svg+xml", resp.Header.Get("Content-Type"))
+
+	respBody := map[string]interface{}{}
+	resp = sendAs(t, &UserFixture1, http.MethodGet, "/url/"+URLFixture.ID.Hex()+"/qr?level=Z", nil, &respBody)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Excpected status code to be 400")
+	assert.Equal(t, "invalid level, use L, M, Q or H", respBody["error"])
+
+	resp = sendAs(t, &UserFixture2, http.MethodGet, "/url/"+URLFixture.ID.Hex()+"/qr", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Expected other users not to get the code")
+}
+
+func TestURLActiveState(t *testing.T) {
+	// a user of its own, so the disabled url doesn't show up in the other tests
+	activeUser := database.User{Name: "Active User", Email: "active@gmail.com", Picture: "https://lh3.googleusercontent.com/a-/AOh14Gh"}
+	TestStore.User.Insert(&activeUser)
+
+	resp := sendAs(t, &activeUser, http.MethodPost, "/url", map[string]string{"destination": "https://www.google.com", "short": "active-short"}, nil)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, "Excpected status code to be 201")
+
+	// warm the cache so disabling has to invalidate it
+	resp, _ = RedirecthttpClient.Get(ServerURL + "/active-short")
+	assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode, "Excpected status code to be 301")
+	helpers.WaitBackground(context.Background())
+
+	url, _ := TestModels.GetURL("active-short", "")
+	resp = sendAs(t, &activeUser, http.MethodPatch, "/url/"+url.ID.Hex(), map[string]bool{"active": false}, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode, "Excpected status code to be 204")
+	helpers.WaitBackground(context.Background())
+
+	resp, _ = RedirecthttpClient.Get(ServerURL + "/active-short")
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode, "Expected disabled links not to resolve")
+	assert.Contains(t, resp.Header.Get("Location"), "reason=disabled", "Expected the reason on the not found page")
+
+	urls := []*database.URL{}
+	sendAs(t, &activeUser, http.MethodGet, "/url/all", nil, &urls)
+	if assert.Len(t, urls, 1) {
+		assert.False(t, urls[0].Active, "Expected the url to be listed as inactive")
+	}
+
+	resp = sendAs(t, &activeUser, http.MethodPatch, "/url/"+url.ID.Hex(), map[string]bool{"active": true}, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode, "Excpected status code to be 204")
+	helpers.WaitBackground(context.Background())
+
+	resp, _ = RedirecthttpClient.Get(ServerURL + "/active-short")
+	assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode, "Expected enabled links to resolve again")
+}
+
+// resolveAs follows a short as a visitor with the user agent
+func resolveAs(t *testing.T, short string, userAgent string) *http.Response {
+	req, _ := http.NewRequest(http.MethodGet, ServerURL+"/"+short, nil)
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := RedirecthttpClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestURLTargets(t *testing.T) {
+	// a user of its own, so the targeted url doesn't show up in the other tests
+	targetUser := database.User{Name: "Target User", Email: "target@gmail.com", Picture: "https://lh3.googleusercontent.com/a-/AOh14Gh"}
+	TestStore.User.Insert(&targetUser)
+
+	iPhone := "Mozilla/5.0 (iPhone; CPU iPhone OS 16_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.5 Mobile/15E148 Safari/604.1"
+	android := "Mozilla/5.0 (Linux; Android 13; Pixel 7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Mobile Safari/537.36"
+	desktop := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Safari/537.36"
+
+	respBody := map[string]interface{}{}
+	resp := sendAs(t, &targetUser, http.MethodPost, "/url", map[string]interface{}{
+		"destination": "https://www.google.com",
+		"short":       "targeted-short",
+		"targets":     []map[string]string{{"os": "fridgeos", "destination": "https://www.google.com"}},
+	}, &respBody)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Expected unknown os targets to be rejected")
+	assert.Equal(t, "invalid target os fridgeos", respBody["error"])
+
+	created := controllers.ShortenURLReponse{}
+	resp = sendAs(t, &targetUser, http.MethodPost, "/url", map[string]interface{}{
+		"destination": "https://www.google.com",
+		"short":       "targeted-short",
+		"targets":     []map[string]string{{"os": "ios", "destination": "https://apps.apple.com/app/id1"}},
+	}, &created)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, "Excpected status code to be 201")
+	assert.Len(t, created.Targets, 1)
+
+	resp = resolveAs(t, "targeted-short", iPhone)
+	assert.Equal(t, "https://apps.apple.com/app/id1", resp.Header.Get("Location"), "Expected iOS visitors to be targeted")
+
+	resp = resolveAs(t, "targeted-short", desktop)
+	assert.Equal(t, "https://www.google.com", resp.Header.Get("Location"), "Expected other visitors to get the destination")
+
+	url, _ := TestModels.GetURL("targeted-short", "")
+	resp = sendAs(t, &targetUser, http.MethodPatch, "/url/"+url.ID.Hex(), map[string]interface{}{
+		"targets": []map[string]string{{"os": "android", "destination": "https://play.google.com/store/apps/details?id=app"}},
+	}, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode, "Excpected status code to be 204")
+	helpers.WaitBackground(context.Background())
+
+	resp = resolveAs(t, "targeted-short", android)
+	assert.Equal(t, "https://play.google.com/store/apps/details?id=app", resp.Header.Get("Location"), "Expected Android visitors to be targeted")
+	resp = resolveAs(t, "targeted-short", iPhone)
+	assert.Equal(t, "https://www.google.com", resp.Header.Get("Location"), "Expected the replaced targets to be gone")
+
+	resp = sendAs(t, &targetUser, http.MethodPatch, "/url/"+url.ID.Hex(), map[string]interface{}{"targets": []interface{}{}}, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode, "Excpected status code to be 204")
+	helpers.WaitBackground(context.Background())
+
+	resp = resolveAs(t, "targeted-short", android)
+	assert.Equal(t, "https://www.google.com", resp.Header.Get("Location"), "Expected empty targets to remove the rules")
+}
+
+func TestURLGeoRules(t *testing.T) {
+	// a user of its own, so the geo targeted url doesn't show up in the other tests
+	geoUser := database.User{Name: "Geo User", Email: "geo@gmail.com", Picture: "https://lh3.googleusercontent.com/a-/AOh14Gh"}
+	TestStore.User.Insert(&geoUser)
+
+	path := filepath.Join(t.TempDir(), "geo.csv")
+	os.WriteFile(path, []byte("1.0.0.0,1.0.0.255,IN,India\n2.0.0.0,2.0.0.255,DE,Germany\n"), 0644)
+	resolver, err := helpers.NewGeoResolver(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	helpers.Geo = resolver
+	defer func() { helpers.Geo = nil }()
+
+	respBody := map[string]interface{}{}
+	resp := sendAs(t, &geoUser, http.MethodPost, "/url", map[string]interface{}{
+		"destination": "https://www.google.com",
+		"short":       "geo-short",
+		"geo_rules":   []map[string]string{{"country": "India", "destination": "https://www.google.co.in"}},
+	}, &respBody)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Expected country names to be rejected")
+
+	resp = sendAs(t, &geoUser, http.MethodPost, "/url", map[string]interface{}{
+		"destination": "https://www.google.com",
+		"short":       "geo-short",
+		"geo_rules": []map[string]string{
+			{"country": "in", "destination": "https://www.google.co.in"},
+			{"country": "DE", "destination": "https://www.google.de"},
+		},
+	}, nil)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, "Excpected status code to be 201")
+
+	visitFrom := func(ip string) string {
+		req, _ := http.NewRequest(http.MethodGet, ServerURL+"/geo-short", nil)
+		req.Header.Set("X-Forwarded-For", ip)
+		resp, err := RedirecthttpClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Header.Get("Location")
+	}
+
+	assert.Equal(t, "https://www.google.co.in", visitFrom("1.0.0.7"), "Expected visitors from India to be sent to their rule")
+	assert.Equal(t, "https://www.google.de", visitFrom("2.0.0.7"), "Expected visitors from Germany to be sent to their rule")
+	assert.Equal(t, "https://www.google.com", visitFrom("8.8.8.8"), "Expected other visitors to get the destination")
+
+	url, _ := TestModels.GetURL("geo-short", "")
+	resp = sendAs(t, &geoUser, http.MethodPatch, "/url/"+url.ID.Hex(), map[string]interface{}{"geo_rules": []interface{}{}}, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode, "Excpected status code to be 204")
+	helpers.WaitBackground(context.Background())
+
+	assert.Equal(t, "https://www.google.com", visitFrom("1.0.0.7"), "Expected empty geo rules to remove the rules")
+}
+
+func TestURLVariants(t *testing.T) {
+	// a user of its own, so the split url doesn't show up in the other tests
+	variantUser := database.User{Name: "Variant User", Email: "variant@gmail.com", Picture: "https://lh3.googleusercontent.com/a-/AOh14Gh"}
+	TestStore.User.Insert(&variantUser)
+
+	created := controllers.ShortenURLReponse{}
+	resp := sendAs(t, &variantUser, http.MethodPost, "/url", map[string]interface{}{
+		"destination": "https://www.google.com",
+		"short":       "variant-short",
+		"variants": []map[string]interface{}{
+			{"id": "a", "destination": "https://www.google.com/a", "weight": 50},
+			{"id": "b", "destination": "https://www.google.com/b", "weight": 50},
+		},
+	}, &created)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, "Excpected status code to be 201")
+	assert.Len(t, created.Variants, 2)
+
+	seen := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		resp, _ = RedirecthttpClient.Get(ServerURL + "/variant-short")
+		seen[resp.Header.Get("Location")] = true
+		assert.Empty(t, resp.Cookies(), "Expected no variant cookie without sticky variants")
+	}
+	assert.Equal(t, map[string]bool{"https://www.google.com/a": true, "https://www.google.com/b": true}, seen, "Expected the visitors to be split across the variants")
+
+	url, _ := TestModels.GetURL("variant-short", "")
+	resp = sendAs(t, &variantUser, http.MethodPatch, "/url/"+url.ID.Hex(), map[string]interface{}{"sticky_variants": true}, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode, "Excpected status code to be 204")
+	helpers.WaitBackground(context.Background())
+
+	resp, _ = RedirecthttpClient.Get(ServerURL + "/variant-short")
+	if assert.Len(t, resp.Cookies(), 1, "Expected the variant to be remembered") {
+		cookie := resp.Cookies()[0]
+		location := resp.Header.Get("Location")
+		assert.Equal(t, "https://www.google.com/"+cookie.Value, location)
+
+		for i := 0; i < 10; i++ {
+			req, _ := http.NewRequest(http.MethodGet, ServerURL+"/variant-short", nil)
+			req.AddCookie(cookie)
+			resp, _ = RedirecthttpClient.Do(req)
+			assert.Equal(t, location, resp.Header.Get("Location"), "Expected returning visitors to keep their variant")
+		}
+	}
+
+	respBody := map[string]interface{}{}
+	resp = sendAs(t, &variantUser, http.MethodPatch, "/url/"+url.ID.Hex(), map[string]interface{}{
+		"variants": []map[string]interface{}{{"id": "a", "destination": "https://www.google.com/a", "weight": 1}},
+	}, &respBody)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Expected a split to need two variants")
+}
+
+func TestURLUTMAndQueryForwarding(t *testing.T) {
+	// a user of its own, so the tagged url doesn't show up in the other tests
+	utmUser := database.User{Name: "UTM User", Email: "utm@gmail.com", Picture: "https://lh3.googleusercontent.com/a-/AOh14Gh"}
+	TestStore.User.Insert(&utmUser)
+
+	created := controllers.ShortenURLReponse{}
+	resp := sendAs(t, &utmUser, http.MethodPost, "/url", map[string]interface{}{
+		"destination":   "https://www.google.com/search?q=shorte#results",
+		"short":         "utm-short",
+		"utm":           map[string]string{"source": "newsletter", "campaign": " launch "},
+		"forward_query": true,
+	}, &created)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, "Excpected status code to be 201")
+	assert.Equal(t, "launch", created.UTM.Campaign, "Expected the tags to be trimmed")
+
+	resp, _ = RedirecthttpClient.Get(ServerURL + "/utm-short?gclid=abc&utm_source=twitter")
+	assert.Equal(t, "https://www.google.com/search?q=shorte&gclid=abc&utm_campaign=launch&utm_source=twitter#results", resp.Header.Get("Location"), "Expected the tags and the query to be merged")
+
+	url, _ := TestModels.GetURL("utm-short", "")
+	resp = sendAs(t, &utmUser, http.MethodPatch, "/url/"+url.ID.Hex(), map[string]interface{}{"forward_query": false, "password": "secret"}, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode, "Excpected status code to be 204")
+	helpers.WaitBackground(context.Background())
+
+	resp, _ = RedirecthttpClient.Get(ServerURL + "/utm-short?gclid=abc")
+	body := new(bytes.Buffer)
+	body.ReadFrom(resp.Body)
+	assert.Contains(t, body.String(), `action="/utm-short?gclid=abc"`, "Expected the unlock form to keep the query")
+
+	resp, _ = RedirecthttpClient.Get(ServerURL + "/utm-short?q=%22%3E%3Cscript%3E")
+	body.Reset()
+	body.ReadFrom(resp.Body)
+	assert.NotContains(t, body.String(), `"><script>`, "Expected the query to be escaped in the unlock form")
+
+	resp, _ = RedirecthttpClient.PostForm(ServerURL+"/utm-short?gclid=abc", map[string][]string{"password": {"secret"}})
+	assert.Equal(t, "/utm-short?gclid=abc", resp.Header.Get("Location"), "Expected the unlock to keep the query")
+
+	req, _ := http.NewRequest(http.MethodGet, ServerURL+"/utm-short?gclid=abc", nil)
+	for _, cookie := range resp.Cookies() {
+		req.AddCookie(cookie)
+	}
+	resp, _ = RedirecthttpClient.Do(req)
+	assert.Equal(t, "https://www.google.com/search?q=shorte&utm_campaign=launch&utm_source=newsletter#results", resp.Header.Get("Location"), "Expected the query not to be forwarded once turned off")
+
+	resp = sendAs(t, &utmUser, http.MethodPatch, "/url/"+url.ID.Hex(), map[string]interface{}{"utm": map[string]string{}}, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode, "Excpected status code to be 204")
+	helpers.WaitBackground(context.Background())
+
+	resp, _ = RedirecthttpClient.Do(req)
+	assert.Equal(t, "https://www.google.com/search?q=shorte#results", resp.Header.Get("Location"), "Expected empty tags to remove them")
+}
+
+func TestURLActivationWindow(t *testing.T) {
+	// a user of its own, so the scheduled url doesn't show up in the other tests
+	scheduleUser := database.User{Name: "Schedule User", Email: "schedule@gmail.com", Picture: "https://lh3.googleusercontent.com/a-/AOh14Gh"}
+	TestStore.User.Insert(&scheduleUser)
+
+	activatesAt := time.Now().Add(time.Hour * 24 * 7).Unix()
+
+	respBody := map[string]interface{}{}
+	resp := sendAs(t, &scheduleUser, http.MethodPost, "/url", map[string]interface{}{
+		"destination":  "https://www.google.com",
+		"short":        "scheduled-short",
+		"activates_at": activatesAt,
+		"expiry":       time.Now().Add(time.Hour).Unix(),
+	}, &respBody)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Expected the activation to be before the expiry")
+	assert.Equal(t, "activation time must be before the expiry", respBody["error"])
+
+	created := controllers.ShortenURLReponse{}
+	resp = sendAs(t, &scheduleUser, http.MethodPost, "/url", map[string]interface{}{
+		"destination":  "https://www.google.com",
+		"short":        "scheduled-short",
+		"activates_at": activatesAt,
+	}, &created)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, "Excpected status code to be 201")
+	assert.Greater(t, created.Expiry, activatesAt, "Expected the default expiry to start at the activation")
+
+	resp, _ = RedirecthttpClient.Get(ServerURL + "/scheduled-short")
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode, "Expected scheduled links not to resolve yet")
+	assert.Equal(t, fmt.Sprintf("%v?activates_at=%v", os.Getenv("UI_COMING_SOON_URL"), activatesAt), resp.Header.Get("Location"))
+	helpers.WaitBackground(context.Background())
+
+	url, _ := TestModels.GetURL("scheduled-short", "")
+	resp = sendAs(t, &scheduleUser, http.MethodPatch, "/url/"+url.ID.Hex(), map[string]interface{}{"coming_soon_url": "https://www.google.com/launch"}, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode, "Excpected status code to be 204")
+	helpers.WaitBackground(context.Background())
+
+	resp, _ = RedirecthttpClient.Get(ServerURL + "/scheduled-short")
+	assert.Equal(t, "https://www.google.com/launch", resp.Header.Get("Location"), "Expected the coming soon url of the link")
+	helpers.WaitBackground(context.Background())
+
+	resp = sendAs(t, &scheduleUser, http.MethodPatch, "/url/"+url.ID.Hex(), map[string]interface{}{"expiry": activatesAt - 60}, &respBody)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Expected the expiry to stay after the activation")
+
+	resp = sendAs(t, &scheduleUser, http.MethodPatch, "/url/"+url.ID.Hex(), map[string]interface{}{"activates_at": 0}, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode, "Excpected status code to be 204")
+	helpers.WaitBackground(context.Background())
+
+	resp, _ = RedirecthttpClient.Get(ServerURL + "/scheduled-short")
+	assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode, "Expected the link to resolve once activated")
+	assert.Equal(t, "https://www.google.com", resp.Header.Get("Location"))
+}
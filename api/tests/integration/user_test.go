@@ -1,16 +1,13 @@
 package integration_tests
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"testing"
 
-	"github.com/ivinayakg/shorte.live/api/database"
 	"github.com/ivinayakg/shorte.live/api/utils"
 	"github.com/stretchr/testify/assert"
-	"go.mongodb.org/mongo-driver/bson"
 )
 
 func TestGoogleLogin(t *testing.T) {
@@ -30,11 +27,9 @@ func TestGoogleLogin(t *testing.T) {
 }
 
 func TestSelfUser(t *testing.T) {
-	user := database.User{}
+	user, _ := TestStore.User.FindByEmail("test1@gmail.com")
 
-	TestDb.User.FindOne(context.Background(), bson.M{"email": "test1@gmail.com"}).Decode(&user)
-
-	userJwt, _ := utils.CreateJWT(&user)
+	userJwt, _ := utils.CreateJWT(user)
 	authCookie := utils.CreateAuthCookie(*userJwt)
 
 	req, err := http.NewRequest(http.MethodGet, ServerURL+"/user/self", nil)
@@ -0,0 +1,181 @@
+package integration_tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ivinayakg/shorte.live/api/controllers"
+	"github.com/ivinayakg/shorte.live/api/database"
+	"github.com/ivinayakg/shorte.live/api/helpers"
+	"github.com/ivinayakg/shorte.live/api/models"
+	"github.com/ivinayakg/shorte.live/api/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// webhookReceiver records the payloads it receives, failing the first failures requests
+type webhookReceiver struct {
+	mutex    sync.Mutex
+	failures int
+	requests []*http.Request
+	payloads []models.WebhookPayload
+	bodies   [][]byte
+}
+
+func (wr *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	wr.mutex.Lock()
+	defer wr.mutex.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	if wr.failures > 0 {
+		wr.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payload := models.WebhookPayload{}
+	json.Unmarshal(body, &payload)
+	wr.requests = append(wr.requests, r)
+	wr.payloads = append(wr.payloads, payload)
+	wr.bodies = append(wr.bodies, body)
+}
+
+func (wr *webhookReceiver) events() []database.WebhookEvent {
+	wr.mutex.Lock()
+	defer wr.mutex.Unlock()
+
+	events := []database.WebhookEvent{}
+	for _, payload := range wr.payloads {
+		events = append(events, payload.Event)
+	}
+	return events
+}
+
+// deliverWebhooks waits for the queued dispatches and sends the due deliveries
+func deliverWebhooks(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := helpers.WaitBackground(ctx); err != nil {
+		t.Fatal(err)
+	}
+	TestModels.Webhooks.Deliver()
+}
+
+func TestWebhook(t *testing.T) {
+	// a user of its own, so the webhook urls don't show up in the other tests
+	webhookUser := database.User{Name: "Webhook User", Email: "webhook@gmail.com", Picture: "https://lh3.googleusercontent.com/a-/AOh14Gh"}
+	TestStore.User.Insert(&webhookUser)
+
+	receiver := &webhookReceiver{failures: 1}
+	receiverServer := httptest.NewServer(receiver)
+	defer receiverServer.Close()
+
+	respBody := map[string]interface{}{}
+	resp := sendAs(t, &webhookUser, http.MethodPost, "/webhook", map[string]interface{}{"url": receiverServer.URL, "events": []string{"url.opened"}}, &respBody)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Excpected status code to be 400")
+	assert.Equal(t, "invalid event url.opened", respBody["error"])
+
+	resp = sendAs(t, &webhookUser, http.MethodPost, "/webhook", map[string]interface{}{"url": "ftp://example.com"}, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Expected only http urls")
+
+	helpers.AllowPrivateNetworks = false
+	for _, private := range []string{"http://127.0.0.1:8080/hook", "http://10.0.0.5/hook", "http://169.254.169.254/latest/meta-data", "http://[::1]/hook", "http://localhost/hook"} {
+		resp = sendAs(t, &webhookUser, http.MethodPost, "/webhook", map[string]interface{}{"url": private}, nil)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Expected private addresses to be rejected: "+private)
+	}
+	helpers.AllowPrivateNetworks = true
+
+	wh := controllers.CreateWebhookResponse{}
+	resp = sendAs(t, &webhookUser, http.MethodPost, "/webhook", map[string]interface{}{"url": receiverServer.URL}, &wh)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, "Excpected status code to be 201")
+	assert.Len(t, wh.Events, len(database.WebhookEvents), "Expected every event by default")
+	assert.NotEmpty(t, wh.Secret)
+
+	webhooks := []map[string]interface{}{}
+	sendAs(t, &webhookUser, http.MethodGet, "/webhook/all", nil, &webhooks)
+	assert.Len(t, webhooks, 1)
+	assert.NotContains(t, webhooks[0], "secret", "Expected the secret not to be listed")
+
+	deliveriesPath := "/webhook/" + wh.ID.Hex() + "/deliveries"
+
+	url := map[string]interface{}{}
+	sendAs(t, &webhookUser, http.MethodPost, "/url", map[string]string{"destination": "https://www.google.com", "short": "webhook-short"}, &url)
+
+	t.Run("TestRetry", func(t *testing.T) {
+		deliverWebhooks(t)
+		assert.Len(t, receiver.events(), 0, "Expected the first attempt to fail")
+
+		deliveries := []*database.WebhookDelivery{}
+		sendAs(t, &webhookUser, http.MethodGet, deliveriesPath, nil, &deliveries)
+		assert.Len(t, deliveries, 1)
+		assert.Equal(t, database.WebhookDeliveryPending, deliveries[0].Status)
+		assert.Equal(t, 1, deliveries[0].Attempts)
+		assert.Equal(t, http.StatusInternalServerError, deliveries[0].ResponseStatus)
+
+		deliverWebhooks(t)
+		sendAs(t, &webhookUser, http.MethodGet, deliveriesPath, nil, &deliveries)
+		assert.Equal(t, database.WebhookDeliveryDelivered, deliveries[0].Status)
+		assert.Equal(t, 2, deliveries[0].Attempts)
+	})
+
+	t.Run("TestSignature", func(t *testing.T) {
+		assert.Equal(t, []database.WebhookEvent{database.WebhookURLCreated}, receiver.events())
+
+		req := receiver.requests[0]
+		timestamp, _ := strconv.ParseInt(req.Header.Get("X-Shorte-Timestamp"), 10, 64)
+		assert.Equal(t, "sha256="+utils.SignWebhookPayload(wh.Secret, timestamp, receiver.bodies[0]), req.Header.Get("X-Shorte-Signature"))
+		assert.Equal(t, "url.created", req.Header.Get("X-Shorte-Event"))
+
+		data := receiver.payloads[0].Data.(map[string]interface{})
+		assert.Equal(t, url["short"], data["short_url"])
+		assert.NotContains(t, data, "password")
+	})
+
+	urlId := ""
+	if urls, _ := TestStore.URL.Find(database.URLFilter{User: webhookUser.ID}); len(urls) == 1 {
+		urlId = urls[0].ID.Hex()
+	}
+
+	sendAs(t, &webhookUser, http.MethodPatch, "/url/"+urlId, map[string]string{"destination": "https://www.example.com"}, nil)
+	TestModels.DispatchClickEvents([]*database.ClickEvent{{URLId: urlId, Device: "Phone", OS: "iOS", Geo: "India", Referrer: "direct"}})
+	sendAs(t, &webhookUser, http.MethodDelete, "/url/"+urlId, nil, nil)
+	deliverWebhooks(t)
+	assert.Equal(t, []database.WebhookEvent{database.WebhookURLCreated, database.WebhookURLUpdated, database.WebhookURLClicked, database.WebhookURLDeleted}, receiver.events())
+
+	t.Run("TestExpired", func(t *testing.T) {
+		expiry := time.Now().Add(time.Second).Unix()
+		TestStore.URL.Insert(&database.URL{User: webhookUser.ID, Short: "webhook-expiring", Destination: "https://www.google.com", Expiry: database.UnixTime(expiry)})
+		time.Sleep(time.Until(time.Unix(expiry+1, 0)))
+
+		deliverWebhooks(t)
+		events := receiver.events()
+		assert.Equal(t, database.WebhookURLExpired, events[len(events)-1])
+
+		// urls which expired while no dispatcher was running are still announced, once
+		TestStore.URL.Insert(&database.URL{User: webhookUser.ID, Short: "webhook-expired", Destination: "https://www.google.com", Expiry: database.UnixTime(time.Now().Unix() - 1)})
+		TestModels.SetupWebhookDispatcher(time.Hour, 0)
+		deliverWebhooks(t)
+		TestModels.SetupWebhookDispatcher(time.Hour, 0)
+		deliverWebhooks(t)
+
+		expired := 0
+		for _, event := range receiver.events() {
+			if event == database.WebhookURLExpired {
+				expired++
+			}
+		}
+		assert.Equal(t, 2, expired, "Expected every expired url to be announced once")
+	})
+
+	resp = sendAs(t, &webhookUser, http.MethodDelete, "/webhook/"+wh.ID.Hex(), nil, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode, "Excpected status code to be 204")
+
+	resp = sendAs(t, &webhookUser, http.MethodGet, deliveriesPath, nil, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Expected deleted webhooks to be gone")
+}
@@ -0,0 +1,114 @@
+package integration_tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/ivinayakg/shorte.live/api/database"
+	"github.com/ivinayakg/shorte.live/api/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// sendAs sends the request authenticated as user and decodes the json response into dest
+func sendAs(t *testing.T, user *database.User, method string, path string, payload interface{}, dest interface{}) *http.Response {
+	var body bytes.Buffer
+	if payload != nil {
+		json.NewEncoder(&body).Encode(payload)
+	}
+
+	req, _ := http.NewRequest(method, ServerURL+path, &body)
+
+	userJwt, _ := utils.CreateJWT(user)
+	req.AddCookie(utils.CreateAuthCookie(*userJwt))
+
+	resp, err := HttpClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dest != nil {
+		json.NewDecoder(resp.Body).Decode(dest)
+	}
+	return resp
+}
+
+func TestWorkspace(t *testing.T) {
+	ws := database.Workspace{}
+	resp := sendAs(t, &UserFixture1, http.MethodPost, "/workspace", map[string]string{"name": "Marketing"}, &ws)
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, "Excpected status code to be 201")
+	assert.Equal(t, database.WorkspaceOwner, ws.MemberRole(UserFixture1.ID), "Expected the creator to be the owner")
+
+	wsPath := "/workspace/" + ws.ID.Hex()
+
+	t.Run("TestInvite", func(t *testing.T) {
+		respBody := map[string]interface{}{}
+		resp := sendAs(t, &UserFixture1, http.MethodPost, wsPath+"/invites", map[string]string{"email": "nobody@gmail.com"}, &respBody)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Excpected status code to be 400")
+		assert.Equal(t, "no user with this email", respBody["error"], "Expected only existing users to be invited")
+
+		resp = sendAs(t, &UserFixture2, http.MethodPost, wsPath+"/invites", map[string]string{"email": UserFixture2.Email}, nil)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Expected non members not to invite")
+
+		resp = sendAs(t, &UserFixture1, http.MethodPost, wsPath+"/invites", map[string]string{"email": UserFixture2.Email, "role": "viewer"}, nil)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, "Excpected status code to be 201")
+
+		invites := []map[string]interface{}{}
+		resp = sendAs(t, &UserFixture2, http.MethodGet, "/workspace/invites", nil, &invites)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Excpected status code to be 200")
+		assert.Len(t, invites, 1, "Expected one pending invite")
+
+		resp = sendAs(t, &UserFixture2, http.MethodPost, wsPath+"/invites/accept", nil, nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Excpected status code to be 200")
+
+		workspaces := []*database.Workspace{}
+		sendAs(t, &UserFixture2, http.MethodGet, "/workspace/all", nil, &workspaces)
+		assert.Len(t, workspaces, 1, "Expected the invitee to be a member")
+	})
+
+	url := map[string]interface{}{}
+	resp = sendAs(t, &UserFixture1, http.MethodPost, "/url?workspace="+ws.ID.Hex(), map[string]string{"destination": "https://www.google.com", "short": "workspace-short"}, &url)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, "Excpected status code to be 201")
+	assert.Equal(t, ws.ID.Hex(), url["workspace"], "Expected the url to belong to the workspace")
+
+	urls := []*database.URL{}
+	sendAs(t, &UserFixture2, http.MethodGet, "/url/all?workspace="+ws.ID.Hex(), nil, &urls)
+	assert.Len(t, urls, 1, "Expected the workspace urls to be listed for members")
+
+	personal := []*database.URL{}
+	sendAs(t, &UserFixture1, http.MethodGet, "/url/all", nil, &personal)
+	for _, personalURL := range personal {
+		assert.NotEqual(t, ws.ID, personalURL.Workspace, "Expected workspace urls not to be listed as personal")
+	}
+
+	urlPath := "/url/" + urls[0].ID.Hex()
+
+	t.Run("TestRoles", func(t *testing.T) {
+		respBody := map[string]interface{}{}
+		resp := sendAs(t, &UserFixture2, http.MethodPatch, urlPath, map[string]string{"destination": "https://www.bing.com"}, &respBody)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, "Excpected status code to be 403")
+		assert.Equal(t, "insufficient workspace role", respBody["error"], "Expected viewers not to edit")
+
+		resp = sendAs(t, &UserFixture1, http.MethodPatch, wsPath+"/members/"+UserFixture2.ID.Hex(), map[string]string{"role": "editor"}, nil)
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode, "Excpected status code to be 204")
+
+		resp = sendAs(t, &UserFixture2, http.MethodPatch, urlPath, map[string]string{"destination": "https://www.bing.com"}, nil)
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode, "Expected editors to edit")
+
+		respBody = map[string]interface{}{}
+		resp = sendAs(t, &UserFixture1, http.MethodPatch, wsPath+"/members/"+UserFixture1.ID.Hex(), map[string]string{"role": "viewer"}, &respBody)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Excpected status code to be 400")
+		assert.Equal(t, "workspace needs at least one owner", respBody["error"], "Expected the last owner to stay")
+	})
+
+	t.Run("TestLeave", func(t *testing.T) {
+		resp := sendAs(t, &UserFixture2, http.MethodDelete, wsPath+"/members/"+UserFixture2.ID.Hex(), nil, nil)
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode, "Excpected status code to be 204")
+
+		respBody := map[string]interface{}{}
+		resp = sendAs(t, &UserFixture2, http.MethodDelete, urlPath, nil, &respBody)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Excpected status code to be 400")
+		assert.Equal(t, "URL document not found", respBody["error"], "Expected former members to lose access")
+	})
+}
@@ -6,8 +6,8 @@ import (
 	"github.com/ivinayakg/shorte.live/api/helpers"
 )
 
-func PutSystemUnderMaintenance(redis *helpers.RedisDB, val bool) {
+func PutSystemUnderMaintenance(cache helpers.CacheDB, val bool) {
 	config := helpers.GetDefaultSystemConfig()
 	config.Maintenance = val
-	redis.SetJSON(string(helpers.SystemConfigNameCacheKey), config, time.Hour*24)
+	cache.SetJSON(string(helpers.SystemConfigNameCacheKey), config, time.Hour*24)
 }
@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ivinayakg/shorte.live/api/helpers"
+)
+
+func TestMemoryCache(t *testing.T) {
+	cache := helpers.NewMemoryDB()
+
+	t.Run("TestJSON", func(t *testing.T) {
+		cache.SetJSON("key", map[string]int{"value": 1}, time.Minute)
+
+		dest := map[string]int{}
+		if err := cache.GetJSON("key", &dest); err != nil || dest["value"] != 1 {
+			t.Errorf("GetJSON() = %v, %v", dest, err)
+		}
+		if err := cache.GetJSON("missing", &dest); err != helpers.ErrCacheMiss {
+			t.Errorf("GetJSON() error = %v, want %v", err, helpers.ErrCacheMiss)
+		}
+	})
+	t.Run("TestExpiry", func(t *testing.T) {
+		cache.SetJSON("short-lived", 1, time.Millisecond*10)
+		cache.SetJSON("forever", 1, 0)
+
+		if ttl, _ := cache.TTL("short-lived"); ttl <= 0 {
+			t.Errorf("TTL() = %v, want a positive duration", ttl)
+		}
+		if ttl, _ := cache.TTL("forever"); ttl != -1 {
+			t.Errorf("TTL() = %v, want -1", ttl)
+		}
+
+		time.Sleep(time.Millisecond * 20)
+
+		var dest int
+		if err := cache.GetJSON("short-lived", &dest); err != helpers.ErrCacheMiss {
+			t.Errorf("GetJSON() error = %v, want %v", err, helpers.ErrCacheMiss)
+		}
+		if ttl, _ := cache.TTL("short-lived"); ttl != -2 {
+			t.Errorf("TTL() = %v, want -2", ttl)
+		}
+	})
+	t.Run("TestList", func(t *testing.T) {
+		cache.LPush("list", "a", "b")
+		cache.LPush("list", "c")
+
+		if got, _ := cache.LRange("list", 0, -1); !reflect.DeepEqual(got, []string{"c", "b", "a"}) {
+			t.Errorf("LRange() = %v", got)
+		}
+		if got, _ := cache.LRange("list", 0, 1); !reflect.DeepEqual(got, []string{"c", "b"}) {
+			t.Errorf("LRange() = %v", got)
+		}
+
+		cache.LTrim("list", 1, -1)
+		if got, _ := cache.LRange("list", 0, -1); !reflect.DeepEqual(got, []string{"b", "a"}) {
+			t.Errorf("LRange() after LTrim() = %v", got)
+		}
+
+		cache.LTrim("list", 5, -1)
+		if got, _ := cache.LRange("list", 0, -1); len(got) != 0 {
+			t.Errorf("LRange() after LTrim() = %v, want empty", got)
+		}
+	})
+	t.Run("TestListMove", func(t *testing.T) {
+		cache.LPush("source", "a", "b", "a")
+
+		if got, err := cache.RPopLPush("source", "destination"); got != "a" || err != nil {
+			t.Errorf("RPopLPush() = %v, %v", got, err)
+		}
+		if got, _ := cache.LRange("destination", 0, -1); !reflect.DeepEqual(got, []string{"a"}) {
+			t.Errorf("LRange() after RPopLPush() = %v", got)
+		}
+
+		cache.LRem("source", 1, "a")
+		if got, _ := cache.LRange("source", 0, -1); !reflect.DeepEqual(got, []string{"b"}) {
+			t.Errorf("LRange() after LRem() = %v", got)
+		}
+
+		cache.RPopLPush("source", "destination")
+		if _, err := cache.RPopLPush("source", "destination"); err != helpers.ErrCacheMiss {
+			t.Errorf("RPopLPush() error = %v, want %v", err, helpers.ErrCacheMiss)
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ivinayakg/shorte.live/api/database"
+	"github.com/ivinayakg/shorte.live/api/helpers"
+)
+
+func TestGeoResolver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geo.csv")
+	rows := "start,end,iso_code,name\n" +
+		"1.0.0.0,1.0.0.255,AU,Australia\n" +
+		"16777472,16778239,CN,China\n" +
+		"2001:200::,2001:200:ffff:ffff:ffff:ffff:ffff:ffff,JP,Japan\n"
+	os.WriteFile(path, []byte(rows), 0644)
+
+	resolver, err := helpers.NewGeoResolver(path)
+	if err != nil {
+		t.Fatalf("NewGeoResolver() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		ip   string
+		want database.CountryName
+	}{
+		{name: "Test with ip range", ip: "1.0.0.12", want: "Australia"},
+		{name: "Test with decimal range", ip: "1.0.1.5", want: "China"},
+		{name: "Test with forwarded for list", ip: "1.0.0.12, 10.0.0.1", want: "Australia"},
+		{name: "Test with port", ip: "1.0.0.12:5100", want: "Australia"},
+		{name: "Test with ipv6", ip: "2001:200::1", want: "Japan"},
+		{name: "Test with unknown ip", ip: "8.8.8.8", want: helpers.UnknownCountry},
+		{name: "Test with invalid ip", ip: "not-an-ip", want: helpers.UnknownCountry},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolver.LookupCountry(tt.ip); got != tt.want {
+				t.Errorf("LookupCountry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("TestReload", func(t *testing.T) {
+		os.WriteFile(path, []byte("8.8.8.0,8.8.8.255,US,United States\n"), 0644)
+		os.Chtimes(path, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+
+		go resolver.WatchReload(time.Millisecond * 10)
+		time.Sleep(time.Millisecond * 100)
+
+		if got := resolver.LookupCountry("8.8.8.8"); got != "United States" {
+			t.Errorf("LookupCountry() after reload = %v, want United States", got)
+		}
+		if got := resolver.LookupCountry("1.0.0.12"); got != helpers.UnknownCountry {
+			t.Errorf("LookupCountry() after reload = %v, want %v", got, helpers.UnknownCountry)
+		}
+	})
+
+	t.Run("TestNilResolver", func(t *testing.T) {
+		var resolver *helpers.GeoResolver
+		if got := resolver.LookupCountry("1.0.0.12"); got != helpers.UnknownCountry {
+			t.Errorf("LookupCountry() = %v, want %v", got, helpers.UnknownCountry)
+		}
+	})
+
+	t.Run("TestLookupWhileReloading", func(t *testing.T) {
+		os.WriteFile(path, []byte("1.0.0.0,1.0.0.255,AU,Australia\n"), 0644)
+		if err := resolver.Reload(); err != nil {
+			t.Fatalf("Reload() error = %v", err)
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 500; j++ {
+					// distinct ips so the lookups miss the cache and hit the db
+					ip := fmt.Sprintf("1.0.0.%v", (i*500+j)%256)
+					if got := resolver.LookupCountry(ip); got != "Australia" {
+						t.Errorf("LookupCountry(%v) during reload = %v, want Australia", ip, got)
+						return
+					}
+				}
+			}(i)
+		}
+		for i := 0; i < 50; i++ {
+			if err := resolver.Reload(); err != nil {
+				t.Errorf("Reload() error = %v", err)
+			}
+		}
+		wg.Wait()
+	})
+}
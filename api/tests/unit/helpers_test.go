@@ -1,10 +1,14 @@
 package tests
 
 import (
+	"context"
+	"net/url"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/ivinayakg/shorte.live/api/database"
 	"github.com/ivinayakg/shorte.live/api/helpers"
 )
 
@@ -128,4 +132,92 @@ func TestHelpers(t *testing.T) {
 		}
 		t.Log("TestEnforceHTTP passed")
 	})
+	t.Run("TestWaitBackground", func(t *testing.T) {
+		finished := false
+		helpers.Background(func() {
+			time.Sleep(time.Millisecond * 20)
+			finished = true
+		})
+
+		if err := helpers.WaitBackground(context.Background()); err != nil || !finished {
+			t.Errorf("WaitBackground() = %v, finished = %v", err, finished)
+		}
+
+		helpers.Background(func() { time.Sleep(time.Millisecond * 100) })
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+		defer cancel()
+		if err := helpers.WaitBackground(ctx); err != context.DeadlineExceeded {
+			t.Errorf("WaitBackground() = %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+	t.Run("TestBuildDestination", func(t *testing.T) {
+		utm := &database.URLUTM{Source: "newsletter", Campaign: "spring sale"}
+
+		tests := []struct {
+			name        string
+			destination string
+			utm         *database.URLUTM
+			forwarded   url.Values
+			want        string
+		}{
+			{
+				name:        "Test without tags",
+				destination: "https://example.org/page?b=2&a=1#top",
+				want:        "https://example.org/page?b=2&a=1#top",
+			},
+			{
+				name:        "Test with tags",
+				destination: "https://example.org/page",
+				utm:         utm,
+				want:        "https://example.org/page?utm_campaign=spring+sale&utm_source=newsletter",
+			},
+			{
+				name:        "Test with query and fragment",
+				destination: "https://example.org/page?b=2&a=1#pricing",
+				utm:         utm,
+				want:        "https://example.org/page?b=2&a=1&utm_campaign=spring+sale&utm_source=newsletter#pricing",
+			},
+			{
+				name:        "Test with tag already on the destination",
+				destination: "https://example.org/page?utm_source=old&ref=x",
+				utm:         utm,
+				want:        "https://example.org/page?ref=x&utm_campaign=spring+sale&utm_source=newsletter",
+			},
+			{
+				name:        "Test with forwarded query",
+				destination: "https://example.org/page?ref=x#top",
+				utm:         utm,
+				forwarded:   url.Values{"utm_source": {"twitter"}, "gclid": {"abc"}, "revalidate": {"true"}},
+				want:        "https://example.org/page?ref=x&gclid=abc&utm_campaign=spring+sale&utm_source=twitter#top",
+			},
+			{
+				name:        "Test with empty forwarded query",
+				destination: "https://example.org/page?",
+				forwarded:   url.Values{},
+				want:        "https://example.org/page?",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if got := helpers.BuildDestination(tt.destination, tt.utm, tt.forwarded); got != tt.want {
+					t.Errorf("BuildDestination() = %v, want %v", got, tt.want)
+				}
+			})
+		}
+	})
+	t.Run("TestNormalizeURLUTM", func(t *testing.T) {
+		utm, err := helpers.NormalizeURLUTM(&database.URLUTM{Source: "  ", Medium: " email "})
+		if err != nil || utm == nil || utm.Medium != "email" || utm.Source != "" {
+			t.Errorf("NormalizeURLUTM() = %+v, %v", utm, err)
+		}
+
+		if utm, err := helpers.NormalizeURLUTM(&database.URLUTM{Term: " "}); utm != nil || err != nil {
+			t.Errorf("NormalizeURLUTM() of empty tags = %+v, %v, want nil", utm, err)
+		}
+
+		if _, err := helpers.NormalizeURLUTM(&database.URLUTM{Content: strings.Repeat("x", 251)}); err == nil {
+			t.Errorf("NormalizeURLUTM() expected an error for a long tag")
+		}
+	})
 }
@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ivinayakg/shorte.live/api/helpers"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "8.8.8.8", want: true},
+		{ip: "2606:4700:4700::1111", want: true},
+		{ip: "127.0.0.1", want: false},
+		{ip: "10.1.2.3", want: false},
+		{ip: "172.16.0.1", want: false},
+		{ip: "192.168.1.1", want: false},
+		{ip: "169.254.169.254", want: false},
+		{ip: "100.64.0.1", want: false},
+		{ip: "0.0.0.0", want: false},
+		{ip: "::1", want: false},
+		{ip: "fd00::1", want: false},
+		{ip: "fe80::1", want: false},
+		{ip: "::ffff:127.0.0.1", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := helpers.IsPublicIP(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("IsPublicIP(%v) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPrivateHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{host: "example.com", want: false},
+		{host: "8.8.8.8:443", want: false},
+		{host: "localhost:3000", want: true},
+		{host: "127.0.0.1:8080", want: true},
+		{host: "[::1]:8080", want: true},
+		{host: "169.254.169.254", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := helpers.IsPrivateHost(tt.host); got != tt.want {
+				t.Errorf("IsPrivateHost(%v) = %v, want %v", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPublicHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client := helpers.PublicHTTPClient(time.Second)
+	_, err := client.Get(server.URL)
+	if !errors.Is(err, helpers.ErrPrivateAddress) {
+		t.Errorf("Get(%v) error = %v, want %v", server.URL, err, helpers.ErrPrivateAddress)
+	}
+
+	helpers.AllowPrivateNetworks = true
+	defer func() { helpers.AllowPrivateNetworks = false }()
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get(%v) with private networks allowed error = %v", server.URL, err)
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ivinayakg/shorte.live/api/helpers"
+)
+
+func TestQRCode(t *testing.T) {
+	t.Run("TestParseQROptions", func(t *testing.T) {
+		opts, err := helpers.ParseQROptions(url.Values{"fg": {"#f00"}, "bg": {"00ff00"}, "margin": {"0"}, "level": {"h"}})
+		if err != nil {
+			t.Fatalf("ParseQROptions() error = %v", err)
+		}
+		if opts.Foreground != (color.RGBA{R: 0xff, A: 0xff}) || opts.Background != (color.RGBA{G: 0xff, A: 0xff}) {
+			t.Errorf("ParseQROptions() colours = %v, %v", opts.Foreground, opts.Background)
+		}
+		if opts.Margin != 0 || opts.Size != 256 || opts.Format != helpers.QRFormatPNG {
+			t.Errorf("ParseQROptions() = %+v", opts)
+		}
+
+		for _, query := range []url.Values{
+			{"size": {"10"}},
+			{"size": {"big"}},
+			{"level": {"X"}},
+			{"margin": {"-1"}},
+			{"fg": {"zzzzzz"}},
+			{"format": {"gif"}},
+		} {
+			if _, err := helpers.ParseQROptions(query); err == nil {
+				t.Errorf("ParseQROptions(%v) expected an error", query)
+			}
+		}
+	})
+	t.Run("TestPNG", func(t *testing.T) {
+		opts, _ := helpers.ParseQROptions(url.Values{"size": {"300"}})
+		p, contentType, err := helpers.QRCode("http://localhost:5100/test", opts)
+		if err != nil {
+			t.Fatalf("QRCode() error = %v", err)
+		}
+		if contentType != "image/png" {
+			t.Errorf("QRCode() content type = %v", contentType)
+		}
+
+		img, err := png.Decode(bytes.NewReader(p))
+		if err != nil {
+			t.Fatalf("png.Decode() error = %v", err)
+		}
+		if img.Bounds().Dx() != 300 || img.Bounds().Dy() != 300 {
+			t.Errorf("QRCode() bounds = %v, want 300x300", img.Bounds())
+		}
+
+		r, g, b, _ := img.At(0, 0).RGBA()
+		if r != 0xffff || g != 0xffff || b != 0xffff {
+			t.Errorf("Expected the margin to use the background colour")
+		}
+	})
+	t.Run("TestSVG", func(t *testing.T) {
+		opts, _ := helpers.ParseQROptions(url.Values{"format": {"svg"}, "fg": {"123456"}})
+		p, contentType, err := helpers.QRCode("http://localhost:5100/test", opts)
+		if err != nil {
+			t.Fatalf("QRCode() error = %v", err)
+		}
+		if contentType != "image/svg+xml" {
+			t.Errorf("QRCode() content type = %v", contentType)
+		}
+		if !strings.HasPrefix(string(p), "<svg") || !strings.Contains(string(p), `fill="#123456"`) {
+			t.Errorf("QRCode() = %s", p)
+		}
+	})
+}
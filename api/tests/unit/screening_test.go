@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ivinayakg/shorte.live/api/helpers"
+)
+
+func writeBlocklist(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func hashPrefix(expression string, length int) string {
+	sum := sha256.Sum256([]byte(expression))
+	return hex.EncodeToString(sum[:length])
+}
+
+func TestScreening(t *testing.T) {
+	t.Run("TestDomainBlocklist", func(t *testing.T) {
+		list, err := helpers.NewDomainBlocklist(writeBlocklist(t, "domains.txt", "# phishing\nevil.com\n0.0.0.0 Malware.example.org\n"))
+		if err != nil {
+			t.Fatalf("NewDomainBlocklist() error = %v", err)
+		}
+
+		tests := map[string]string{
+			"https://evil.com/login":                 "evil.com",
+			"https://accounts.evil.com/login":        "evil.com",
+			"http://MALWARE.example.org:8080/x":      "malware.example.org",
+			"https://example.org/":                   "",
+			"https://notevil.com/":                   "",
+			"https://evil.com.safe.example.net/page": "",
+		}
+		for destination, want := range tests {
+			u, _ := url.Parse(destination)
+			if got := list.Match(u); got != want {
+				t.Errorf("Match(%v) = %q, want %q", destination, got, want)
+			}
+		}
+	})
+	t.Run("TestHashPrefixBlocklist", func(t *testing.T) {
+		content := hashPrefix("bad.example.com/", 4) + "\n" + hashPrefix("example.net/phish/", 32) + "\n"
+		list, err := helpers.NewHashPrefixBlocklist(writeBlocklist(t, "prefixes.txt", content))
+		if err != nil {
+			t.Fatalf("NewHashPrefixBlocklist() error = %v", err)
+		}
+
+		tests := map[string]string{
+			"https://bad.example.com/":                  "bad.example.com/",
+			"https://www.bad.example.com/any/path?q=1":  "bad.example.com/",
+			"https://example.net/phish/login.html?id=1": "example.net/phish/",
+			"https://example.net/safe/":                 "",
+			"https://example.com/":                      "",
+		}
+		for destination, want := range tests {
+			u, _ := url.Parse(destination)
+			if got := list.Match(u); got != want {
+				t.Errorf("Match(%v) = %q, want %q", destination, got, want)
+			}
+		}
+
+		if _, err := helpers.NewHashPrefixBlocklist(writeBlocklist(t, "invalid.txt", "abc\n")); err == nil {
+			t.Errorf("Expected prefixes shorter than 4 bytes to be rejected")
+		}
+	})
+	t.Run("TestScreener", func(t *testing.T) {
+		var disabled *helpers.ScreenerType
+		if disabled.Screen("https://evil.com") != nil || disabled.Blocks() {
+			t.Errorf("Expected a nil screener to let everything through")
+		}
+
+		list, _ := helpers.NewDomainBlocklist(writeBlocklist(t, "domains.txt", "evil.com\n"))
+		screener := helpers.NewScreener(helpers.ScreeningFlag)
+		screener.AddBlocklist(list)
+
+		screening := screener.Screen("https://www.evil.com/")
+		if screening == nil || screening.List != "domains.txt" || screening.Match != "evil.com" {
+			t.Errorf("Screen() = %+v", screening)
+		}
+		if screener.Blocks() {
+			t.Errorf("Expected the flag action not to block")
+		}
+	})
+}
@@ -0,0 +1,188 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/ivinayakg/shorte.live/api/database"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := database.NewMemoryStore()
+	userId := primitive.NewObjectID()
+
+	t.Run("TestInsertAndFind", func(t *testing.T) {
+		url := &database.URL{User: userId, Short: "mem-short", Destination: "https://example.com"}
+		if err := store.URL.Insert(url); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+		if url.ID == primitive.NilObjectID {
+			t.Errorf("Expected Insert() to assign an id")
+		}
+
+		found, err := store.URL.FindOne(database.URLFilter{Short: "mem-short"})
+		if err != nil || found.ID != url.ID {
+			t.Errorf("FindOne() = %v, %v, want id %v", found, err, url.ID)
+		}
+
+		if _, err := store.URL.FindOne(database.URLFilter{Short: "missing"}); err != mongo.ErrNoDocuments {
+			t.Errorf("FindOne() error = %v, want %v", err, mongo.ErrNoDocuments)
+		}
+	})
+	t.Run("TestDuplicateShort", func(t *testing.T) {
+		errs := store.URL.InsertMany([]*database.URL{
+			{User: userId, Short: "mem-short", Destination: "https://example.com"},
+			{User: userId, Short: "mem-short-2", Destination: "https://example.com"},
+		})
+		if errs[0] != database.ErrDuplicateShort {
+			t.Errorf("InsertMany() errs[0] = %v, want %v", errs[0], database.ErrDuplicateShort)
+		}
+		if errs[1] != nil {
+			t.Errorf("InsertMany() errs[1] = %v, want nil", errs[1])
+		}
+
+		if _, err := store.URL.Update(database.URLFilter{Short: "mem-short-2"}, map[string]interface{}{"short": "mem-short"}); err != database.ErrDuplicateShort {
+			t.Errorf("Update() error = %v, want %v", err, database.ErrDuplicateShort)
+		}
+	})
+	t.Run("TestFindBatches", func(t *testing.T) {
+		all, _ := store.URL.Find(database.URLFilter{})
+		sizes := []int{}
+		store.URL.FindBatches(database.URLFilter{}, 1, func(urls []*database.URL) error {
+			sizes = append(sizes, len(urls))
+			return nil
+		})
+		if len(sizes) != len(all) {
+			t.Errorf("FindBatches() ran %v batches, want %v", len(sizes), len(all))
+		}
+	})
+	t.Run("TestDeleteMany", func(t *testing.T) {
+		store.URL.InsertMany([]*database.URL{
+			{User: userId, Short: "mem-many-1", Domain: "many.example.com"},
+			{User: userId, Short: "mem-many-2", Domain: "many.example.com"},
+		})
+		if deleted, err := store.URL.DeleteMany(database.URLFilter{Domain: "many.example.com"}); deleted != 2 || err != nil {
+			t.Errorf("DeleteMany() = %v, %v, want 2, nil", deleted, err)
+		}
+		if urls, _ := store.URL.Find(database.URLFilter{Domain: "many.example.com"}); len(urls) != 0 {
+			t.Errorf("Find() = %v urls, want 0", len(urls))
+		}
+	})
+	t.Run("TestClaimExpiryNotification", func(t *testing.T) {
+		url := &database.URL{User: userId, Short: "mem-expired", Destination: "https://example.com", Expiry: 10}
+		store.URL.Insert(url)
+
+		unnotified := database.URLFilter{User: userId, ExpiredAfter: 1, ExpiredBefore: 20, ExpiryUnnotified: true}
+		if urls, _ := store.URL.Find(unnotified); len(urls) != 1 {
+			t.Fatalf("Find() = %v urls, want 1", len(urls))
+		}
+		if claimed, err := store.URL.ClaimExpiryNotification(url.ID); !claimed || err != nil {
+			t.Errorf("ClaimExpiryNotification() = %v, %v, want true, nil", claimed, err)
+		}
+		if claimed, _ := store.URL.ClaimExpiryNotification(url.ID); claimed {
+			t.Errorf("ClaimExpiryNotification() = true, want the second claim to fail")
+		}
+		if urls, _ := store.URL.Find(unnotified); len(urls) != 0 {
+			t.Errorf("Find() = %v urls, want notified urls to be skipped", len(urls))
+		}
+		store.URL.Delete(database.URLFilter{ID: url.ID})
+	})
+	t.Run("TestDomainScopedShort", func(t *testing.T) {
+		url := &database.URL{User: userId, Short: "mem-short", Domain: "links.example.com", Destination: "https://example.org"}
+		if err := store.URL.Insert(url); err != nil {
+			t.Fatalf("Insert() error = %v, want the short to be free on another domain", err)
+		}
+
+		found, err := store.URL.FindOne(database.URLFilter{Short: "mem-short"})
+		if err != nil || found.Domain != "" {
+			t.Errorf("FindOne() = %v, %v, want the url on the default domain", found, err)
+		}
+
+		found, err = store.URL.FindOne(database.URLFilter{Short: "mem-short", Domain: "links.example.com"})
+		if err != nil || found.ID != url.ID {
+			t.Errorf("FindOne() = %v, %v, want id %v", found, err, url.ID)
+		}
+
+		if err := store.URL.Insert(&database.URL{User: userId, Short: "mem-short", Domain: "links.example.com"}); err != database.ErrDuplicateShort {
+			t.Errorf("Insert() error = %v, want %v", err, database.ErrDuplicateShort)
+		}
+	})
+	t.Run("TestDomainVerifiedOnce", func(t *testing.T) {
+		first := &database.Domain{User: userId, Host: "links.example.com"}
+		second := &database.Domain{User: primitive.NewObjectID(), Host: "links.example.com"}
+		store.Domain.Insert(first)
+		store.Domain.Insert(second)
+
+		if matched, err := store.Domain.SetVerified(first.ID, 1); !matched || err != nil {
+			t.Errorf("SetVerified() = %v, %v, want true, nil", matched, err)
+		}
+		if _, err := store.Domain.SetVerified(second.ID, 1); err != database.ErrDomainTaken {
+			t.Errorf("SetVerified() error = %v, want %v", err, database.ErrDomainTaken)
+		}
+	})
+	t.Run("TestUpdateScopedToUser", func(t *testing.T) {
+		matched, _ := store.URL.Update(database.URLFilter{Short: "mem-short", User: primitive.NewObjectID()}, map[string]interface{}{"destination": "https://other.com"})
+		if matched != 0 {
+			t.Errorf("Update() matched = %v, want 0 for a different user", matched)
+		}
+
+		matched, _ = store.URL.Update(database.URLFilter{Short: "mem-short", User: userId}, map[string]interface{}{"destination": "https://other.com"})
+		found, _ := store.URL.FindOne(database.URLFilter{Short: "mem-short"})
+		if matched != 1 || found.Destination != "https://other.com" {
+			t.Errorf("Update() matched = %v, destination = %v", matched, found.Destination)
+		}
+	})
+	t.Run("TestConfig", func(t *testing.T) {
+		type config struct {
+			Name  string             `json:"name"`
+			Value int                `json:"value"`
+			ID    primitive.ObjectID `bson:"_id,omitempty"`
+		}
+
+		id, err := store.Config.Insert(config{Name: "test_config", Value: 5})
+		if err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+
+		found := &config{}
+		if err := store.Config.FindByName("test_config", found); err != nil || found.Value != 5 || found.ID != id {
+			t.Errorf("FindByName() = %+v, %v", found, err)
+		}
+	})
+	t.Run("TestWorkspace", func(t *testing.T) {
+		memberId := primitive.NewObjectID()
+		ws := &database.Workspace{Name: "team", Members: []database.WorkspaceMember{{User: userId, Role: database.WorkspaceOwner}}}
+		if err := store.Workspace.Insert(ws); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+
+		invite := database.WorkspaceInvite{Email: "member@example.com", Role: database.WorkspaceEditor}
+		if added, err := store.Workspace.AddInvite(ws.ID, invite); !added || err != nil {
+			t.Errorf("AddInvite() = %v, %v", added, err)
+		}
+		if added, _ := store.Workspace.AddInvite(ws.ID, invite); added {
+			t.Errorf("AddInvite() of a pending invite = %v, want false", added)
+		}
+
+		member := database.WorkspaceMember{User: memberId, Role: database.WorkspaceEditor}
+		if accepted, err := store.Workspace.AcceptInvite(ws.ID, invite.Email, member); !accepted || err != nil {
+			t.Errorf("AcceptInvite() = %v, %v", accepted, err)
+		}
+		if accepted, _ := store.Workspace.AcceptInvite(ws.ID, invite.Email, member); accepted {
+			t.Errorf("AcceptInvite() twice = %v, want false", accepted)
+		}
+
+		found, err := store.Workspace.FindOne(database.WorkspaceFilter{Member: memberId})
+		if err != nil || found.MemberRole(memberId) != database.WorkspaceEditor || len(found.Invites) != 0 {
+			t.Errorf("FindOne() = %+v, %v", found, err)
+		}
+
+		store.Workspace.SetMemberRole(ws.ID, memberId, database.WorkspaceViewer)
+		store.Workspace.RemoveMember(ws.ID, userId)
+		found, _ = store.Workspace.FindOne(database.WorkspaceFilter{ID: ws.ID})
+		if found.MemberRole(memberId) != database.WorkspaceViewer || found.MemberRole(userId) != "" {
+			t.Errorf("Members after update = %+v", found.Members)
+		}
+	})
+}
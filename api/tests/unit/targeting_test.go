@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/avct/uasurfer"
+	"github.com/ivinayakg/shorte.live/api/database"
+	"github.com/ivinayakg/shorte.live/api/helpers"
+	"github.com/ivinayakg/shorte.live/api/models"
+)
+
+const (
+	iPhoneUserAgent  = "Mozilla/5.0 (iPhone; CPU iPhone OS 16_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.5 Mobile/15E148 Safari/604.1"
+	androidUserAgent = "Mozilla/5.0 (Linux; Android 13; Pixel 7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Mobile Safari/537.36"
+	desktopUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Safari/537.36"
+	iPadUserAgent    = "Mozilla/5.0 (iPad; CPU OS 16_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.5 Mobile/15E148 Safari/604.1"
+)
+
+func TestURLTargets(t *testing.T) {
+	t.Run("TestValidateURLTargets", func(t *testing.T) {
+		targets := []database.URLTarget{{OS: " iOS ", Destination: "apps.apple.com/app/id1"}}
+		if err := helpers.ValidateURLTargets(targets); err != nil {
+			t.Fatalf("ValidateURLTargets() error = %v", err)
+		}
+		if targets[0].OS != "ios" || targets[0].Destination != "https://apps.apple.com/app/id1" {
+			t.Errorf("ValidateURLTargets() normalised to %+v", targets[0])
+		}
+
+		invalid := map[string]database.URLTarget{
+			"no match":   {Destination: "https://www.google.com"},
+			"bad device": {Device: "fridge", Destination: "https://www.google.com"},
+			"bad os":     {OS: "plan9", Destination: "https://www.google.com"},
+			"bad url":    {OS: "android", Destination: "not a url"},
+		}
+		for name, target := range invalid {
+			if err := helpers.ValidateURLTargets([]database.URLTarget{target}); err == nil {
+				t.Errorf("ValidateURLTargets(%v) expected an error", name)
+			}
+		}
+
+		tooMany := make([]database.URLTarget, helpers.MaxURLTargets+1)
+		for i := range tooMany {
+			tooMany[i] = database.URLTarget{OS: "ios", Destination: "https://www.google.com"}
+		}
+		if err := helpers.ValidateURLTargets(tooMany); err == nil {
+			t.Errorf("ValidateURLTargets() expected an error for %v targets", len(tooMany))
+		}
+	})
+
+	t.Run("TestValidateURLGeoRules", func(t *testing.T) {
+		rules := []database.URLGeoRule{{Country: " in ", Destination: "example.in"}}
+		if err := helpers.ValidateURLGeoRules(rules); err != nil {
+			t.Fatalf("ValidateURLGeoRules() error = %v", err)
+		}
+		if rules[0].Country != "IN" || rules[0].Destination != "https://example.in" {
+			t.Errorf("ValidateURLGeoRules() normalised to %+v", rules[0])
+		}
+
+		for _, country := range []string{"", "IND", "I1", "India"} {
+			if err := helpers.ValidateURLGeoRules([]database.URLGeoRule{{Country: country, Destination: "https://example.in"}}); err == nil {
+				t.Errorf("ValidateURLGeoRules(%q) expected an error", country)
+			}
+		}
+	})
+
+	t.Run("TestResolveDestination", func(t *testing.T) {
+		url := &database.URL{
+			Destination: "https://example.com",
+			Targets: []database.URLTarget{
+				{Device: "tablet", OS: "ios", Destination: "https://example.com/ipad"},
+				{OS: "ios", Destination: "https://apps.apple.com/app/id1"},
+				{OS: "android", Destination: "https://play.google.com/store/apps/details?id=app"},
+				{Device: "phone", Destination: "https://m.example.com"},
+			},
+		}
+
+		url.GeoRules = []database.URLGeoRule{
+			{Country: "IN", Destination: "https://example.in"},
+			{Country: "DE", Destination: "https://example.de"},
+			{Country: "IN", Destination: "https://example.in/unused"},
+		}
+
+		tests := []struct {
+			userAgent   string
+			country     string
+			destination string
+			rule        string
+		}{
+			{iPhoneUserAgent, "IN", "https://apps.apple.com/app/id1", "os:ios"},
+			{iPadUserAgent, "", "https://example.com/ipad", "device:tablet+os:ios"},
+			{androidUserAgent, "DE", "https://play.google.com/store/apps/details?id=app", "os:android"},
+			{desktopUserAgent, "IN", "https://example.in", "geo:IN"},
+			{desktopUserAgent, "DE", "https://example.de", "geo:DE"},
+			{desktopUserAgent, "US", "https://example.com", database.DefaultClickRule},
+			{"", "", "https://example.com", database.DefaultClickRule},
+		}
+		for _, tt := range tests {
+			destination, rule := helpers.ResolveDestination(url, uasurfer.Parse(tt.userAgent), tt.country)
+			if destination != tt.destination || rule != tt.rule {
+				t.Errorf("ResolveDestination(%q, %q) = %v, %v, want %v, %v", tt.userAgent, tt.country, destination, rule, tt.destination, tt.rule)
+			}
+		}
+	})
+
+	t.Run("TestValidateURLVariants", func(t *testing.T) {
+		variants := []database.URLVariant{{Destination: "shop.example.net/a", Weight: 70}, {ID: "b", Destination: "https://shop.example.net/b", Weight: 30}}
+		if err := helpers.ValidateURLVariants(variants); err != nil {
+			t.Fatalf("ValidateURLVariants() error = %v", err)
+		}
+		if variants[0].ID != "v1" || variants[0].Destination != "https://shop.example.net/a" {
+			t.Errorf("ValidateURLVariants() normalised to %+v", variants[0])
+		}
+
+		invalid := map[string][]database.URLVariant{
+			"single variant": {{ID: "a", Destination: "https://example.com/a", Weight: 1}},
+			"zero weight":    {{ID: "a", Destination: "https://example.com/a", Weight: 0}, {ID: "b", Destination: "https://example.com/b", Weight: 1}},
+			"duplicate id":   {{ID: "a", Destination: "https://example.com/a", Weight: 1}, {ID: "a", Destination: "https://example.com/b", Weight: 1}},
+			"invalid id":     {{ID: "a;b", Destination: "https://example.com/a", Weight: 1}, {ID: "b", Destination: "https://example.com/b", Weight: 1}},
+			"invalid url":    {{ID: "a", Destination: "not a url", Weight: 1}, {ID: "b", Destination: "https://example.com/b", Weight: 1}},
+		}
+		for name, variants := range invalid {
+			if err := helpers.ValidateURLVariants(variants); err == nil {
+				t.Errorf("ValidateURLVariants(%v) expected an error", name)
+			}
+		}
+	})
+
+	t.Run("TestPickVariant", func(t *testing.T) {
+		variants := []database.URLVariant{{ID: "a", Weight: 70}, {ID: "b", Weight: 30}, {ID: "off", Weight: 0}}
+
+		picks := map[string]int{}
+		for i := 0; i < 10000; i++ {
+			picks[helpers.PickVariant(variants, "").ID]++
+		}
+		if picks["a"] < 6500 || picks["a"] > 7500 || picks["off"] != 0 {
+			t.Errorf("PickVariant() split = %v, want about 70/30", picks)
+		}
+
+		if got := helpers.PickVariant(variants, "b"); got.ID != "b" {
+			t.Errorf("PickVariant() with sticky b = %v", got.ID)
+		}
+		if got := helpers.PickVariant(variants, "removed"); got == nil {
+			t.Errorf("PickVariant() with a removed sticky variant = nil, want a new pick")
+		}
+		if got := helpers.PickVariant(nil, ""); got != nil {
+			t.Errorf("PickVariant() without variants = %v, want nil", got)
+		}
+	})
+
+	t.Run("TestURLCacheTTL", func(t *testing.T) {
+		now := time.Unix(1_700_000_000, 0)
+		expiry := database.UnixTime(now.Add(time.Hour * 48).Unix())
+
+		tests := []struct {
+			name string
+			url  *database.URL
+			want time.Duration
+		}{
+			{name: "Test without activation", url: &database.URL{Expiry: expiry}, want: time.Hour * 48},
+			{name: "Test before activation", url: &database.URL{Expiry: expiry, ActivatesAt: database.UnixTime(now.Add(time.Hour).Unix())}, want: time.Hour},
+			{name: "Test after activation", url: &database.URL{Expiry: expiry, ActivatesAt: database.UnixTime(now.Add(-time.Hour).Unix())}, want: time.Hour * 48},
+		}
+		for _, tt := range tests {
+			if got := models.URLCacheTTL(tt.url, now); got != tt.want {
+				t.Errorf("%v: URLCacheTTL() = %v, want %v", tt.name, got, tt.want)
+			}
+		}
+	})
+}
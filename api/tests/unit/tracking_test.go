@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ivinayakg/shorte.live/api/database"
+	"github.com/ivinayakg/shorte.live/api/helpers"
+)
+
+func TestTracker(t *testing.T) {
+	helpers.Cache = helpers.NewMemoryDB()
+	helpers.SetupTracker(time.Hour, 2, 0)
+	helpers.Tracker.SetRetryPolicy(2, time.Millisecond*10)
+
+	var inserted []*database.ClickEvent
+	var insertErr error
+	helpers.Tracker.SetInsertFunc(func(events []*database.ClickEvent) error {
+		if insertErr != nil {
+			return insertErr
+		}
+		inserted = append(inserted, events...)
+		return nil
+	})
+
+	var hooked []*database.ClickEvent
+	helpers.Tracker.SetInsertHook(func(events []*database.ClickEvent) {
+		hooked = append(hooked, events...)
+	})
+
+	listLength := func(key string) int {
+		values, _ := helpers.Cache.LRange(key, 0, -1)
+		return len(values)
+	}
+
+	t.Run("TestInsertFailure", func(t *testing.T) {
+		insertErr = errors.New("connection refused")
+		helpers.Tracker.CaptureRedirectEvent("desktop", "", "linux", "", "url-1", "default", "", 1)
+		helpers.Tracker.CaptureRedirectEvent("desktop", "", "linux", "", "url-1", "default", "", 2)
+
+		if got := listLength("track_event_processing"); got != 2 {
+			t.Errorf("processing list length = %v, want 2", got)
+		}
+		if got := listLength("track_event"); got != 0 {
+			t.Errorf("queue length = %v, want 0", got)
+		}
+
+		// the retry isn't due yet
+		helpers.Tracker.Flush()
+		if got := listLength("track_event_dead_letter"); got != 0 {
+			t.Errorf("dead letter length = %v, want 0", got)
+		}
+
+		time.Sleep(time.Millisecond * 20)
+		helpers.Tracker.Flush()
+		if got := listLength("track_event_dead_letter"); got != 2 {
+			t.Errorf("dead letter length = %v, want 2", got)
+		}
+		if got := listLength("track_event_processing"); got != 0 {
+			t.Errorf("processing list length = %v, want 0", got)
+		}
+	})
+
+	t.Run("TestRetry", func(t *testing.T) {
+		insertErr = errors.New("connection refused")
+		helpers.Tracker.CaptureRedirectEvent("mobile", "", "android", "", "url-2", "default", "", 3)
+		helpers.Tracker.CaptureRedirectEvent("mobile", "", "android", "", "url-2", "default", "", 4)
+
+		insertErr = nil
+		time.Sleep(time.Millisecond * 20)
+		helpers.Tracker.Flush()
+
+		if len(inserted) != 2 || inserted[0].Timestamp != 3 || inserted[1].Timestamp != 4 {
+			t.Errorf("inserted = %v, want the events of url-2 in order", inserted)
+		}
+		if len(hooked) != 2 {
+			t.Errorf("insert hook got %v events, want only the 2 stored ones", len(hooked))
+		}
+		if got := listLength("track_event_processing"); got != 0 {
+			t.Errorf("processing list length = %v, want 0", got)
+		}
+	})
+
+	t.Run("TestRecover", func(t *testing.T) {
+		inserted = nil
+		helpers.Tracker.CaptureRedirectEvent("desktop", "", "windows", "", "url-3", "default", "", 5)
+		helpers.Cache.RPopLPush("track_event", "track_event_processing")
+
+		// a restart picks up the unacknowledged event
+		helpers.SetupTracker(time.Hour, 2, 0)
+		helpers.Tracker.SetInsertFunc(func(events []*database.ClickEvent) error {
+			inserted = append(inserted, events...)
+			return nil
+		})
+		helpers.Tracker.Flush()
+
+		if len(inserted) != 1 || inserted[0].URLId != "url-3" {
+			t.Errorf("inserted = %v, want the event of url-3", inserted)
+		}
+	})
+	t.Run("TestStartFlushStops", func(t *testing.T) {
+		helpers.SetupTracker(time.Millisecond, 2, 0)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			helpers.Tracker.StartFlush(ctx)
+			close(done)
+		}()
+
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("StartFlush() didn't return after its context was cancelled")
+		}
+	})
+}
@@ -2,54 +2,170 @@ package timescale
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/ivinayakg/shorte.live/api/database"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-var TimescaleDB *pgx.Conn
+// timescaleDB is swapped in by a background retry while requests read it
+var timescaleDB atomic.Pointer[pgxpool.Pool]
 
-// connect to database using a single connection
-func SetupTimeScale() {
-	/***********************************************/
-	/* Single Connection to TimescaleDB/ PostgreSQL */
-	/***********************************************/
-	ctx := context.Background()
-	connStr := os.Getenv("TIMESCALE_CONN")
-	db, err := pgx.Connect(ctx, connStr)
+// DB returns the connection pool, nil until SetupTimeScale has succeeded.
+func DB() *pgxpool.Pool {
+	return timescaleDB.Load()
+}
+
+var ErrNotConnected = errors.New("timescale: not connected")
+
+// poolConfig reads TIMESCALE_CONN, TIMESCALE_POOL_MAX_CONNS and TIMESCALE_POOL_MIN_CONNS
+// override the pool size of the connection string (pool_max_conns, pool_min_conns).
+func poolConfig() (*pgxpool.Config, error) {
+	config, err := pgxpool.ParseConfig(os.Getenv("TIMESCALE_CONN"))
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to connect to database: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("invalid TIMESCALE_CONN: %w", err)
 	}
 
-	click_events_table_name := os.Getenv("CLICK_EVENTS_TABLE_NAME")
+	if maxConns, err := strconv.Atoi(os.Getenv("TIMESCALE_POOL_MAX_CONNS")); err == nil && maxConns > 0 {
+		config.MaxConns = int32(maxConns)
+	}
+	if minConns, err := strconv.Atoi(os.Getenv("TIMESCALE_POOL_MIN_CONNS")); err == nil && minConns >= 0 && int32(minConns) <= config.MaxConns {
+		config.MinConns = int32(minConns)
+	}
+	return config, nil
+}
+
+// connect to database using a connection pool, the schema is created when missing
+func SetupTimeScale() error {
+	return setupTimeScale(context.Background())
+}
+
+func setupTimeScale(ctx context.Context) error {
+	config, err := poolConfig()
+	if err != nil {
+		return err
+	}
+
+	db, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return fmt.Errorf("unable to connect to database: %w", err)
+	}
+
+	if err := createSchema(ctx, db); err != nil {
+		db.Close()
+		return err
+	}
+
+	if !timescaleDB.CompareAndSwap(nil, db) {
+		db.Close()
+		return nil
+	}
+	// the retry was stopped while connecting, Close may already have run
+	if ctx.Err() != nil {
+		if timescaleDB.CompareAndSwap(db, nil) {
+			db.Close()
+		}
+		return ctx.Err()
+	}
+	fmt.Printf("Connected to TimescaleDB with a pool of %v connections\n", config.MaxConns)
+	return nil
+}
+
+// Close waits for the checked out connections to be released and closes the pool,
+// the context of RetrySetupTimeScale has to be cancelled before.
+func Close() {
+	if db := timescaleDB.Swap(nil); db != nil {
+		db.Close()
+	}
+}
+
+// RetrySetupTimeScale keeps calling SetupTimeScale until it succeeds or ctx is cancelled.
+func RetrySetupTimeScale(ctx context.Context, frequency time.Duration) {
+	ticker := time.NewTicker(frequency)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := setupTimeScale(ctx)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		fmt.Println("TimescaleDB setup failed, retrying:", err)
+	}
+}
+
+// Ping checks that TimescaleDB is set up and reachable.
+func Ping() error {
+	db := timescaleDB.Load()
+	if db == nil {
+		return ErrNotConnected
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	return db.Ping(ctx)
+}
+
+// Connected reports whether SetupTimeScale has succeeded.
+func Connected() bool {
+	return timescaleDB.Load() != nil
+}
+
+// clickEventsTable is the table of the raw click events, CLICK_EVENTS_TABLE_NAME
+// overrides the default name and the hourly rollup is named after it.
+func clickEventsTable() string {
+	if name := os.Getenv("CLICK_EVENTS_TABLE_NAME"); name != "" {
+		return name
+	}
+	return "click_events"
+}
+
+func clickEventsHourlyView() string {
+	return clickEventsTable() + "_hourly"
+}
+
+// clickEventDimensions are the columns of the click events the hourly rollup groups by
+var clickEventDimensions = []string{"device", "os", "geo", "referrer", "rule", "variant"}
+
+func createSchema(ctx context.Context, db *pgxpool.Pool) error {
+	click_events_table_name := clickEventsTable()
 
 	// create click events table
-	_, err = db.Exec(ctx, fmt.Sprintf("CREATE TABLE IF not exists %v (url_id VARCHAR(50), geo TEXT,device TEXT,os TEXT,referrer TEXT,timestamp TIMESTAMPTZ NOT NULL);", click_events_table_name))
+	_, err := db.Exec(ctx, fmt.Sprintf("CREATE TABLE IF not exists %v (url_id VARCHAR(50), geo TEXT,device TEXT,os TEXT,referrer TEXT,rule TEXT,variant TEXT,timestamp TIMESTAMPTZ NOT NULL);", click_events_table_name))
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Create Table failed: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("create table failed: %w", err)
+	}
+
+	// tables created before the columns were added
+	for _, column := range []string{"rule", "variant"} {
+		_, err = db.Exec(ctx, fmt.Sprintf("ALTER TABLE %v ADD COLUMN IF NOT EXISTS %v TEXT;", click_events_table_name, column))
+		if err != nil {
+			return fmt.Errorf("add %v column failed: %w", column, err)
+		}
 	}
 
 	// checks if hypertable exists for click events
 	var click_events_hypertable_exists bool
 	err = db.QueryRow(ctx, fmt.Sprintf("SELECT EXISTS(SELECT 1 FROM timescaledb_information.hypertables WHERE hypertable_name = '%v');", click_events_table_name)).Scan(&click_events_hypertable_exists)
-	fmt.Println(click_events_hypertable_exists)
 	if err != nil {
-		fmt.Println(err)
-		// fmt.Fprintf(os.Stderr, "Create %v index failed: %v\n", click_events_url_timestamp_index_name, err)
-		os.Exit(1)
+		return fmt.Errorf("hypertable lookup failed: %w", err)
 	}
 
 	//create hypertable if not already there
 	if !click_events_hypertable_exists {
 		_, err := db.Exec(ctx, fmt.Sprintf("SELECT create_hypertable('%v', by_range('timestamp'))", click_events_table_name))
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Create hypertable failed: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("create hypertable failed: %w", err)
 		}
 	}
 
@@ -57,88 +173,188 @@ func SetupTimeScale() {
 	// create index on url_id and time
 	_, err = db.Exec(ctx, fmt.Sprintf("CREATE INDEX IF not EXISTS %v ON %v (url_id, timestamp DESC);", click_events_url_timestamp_index_name, click_events_table_name))
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Create %v index failed: %v\n", click_events_url_timestamp_index_name, err)
-		os.Exit(1)
+		return fmt.Errorf("create %v index failed: %w", click_events_url_timestamp_index_name, err)
 	}
 
-	fmt.Println("Connected to TimescaleDB")
-	TimescaleDB = db
-}
+	// hourly rollup of the click events, real time aggregation keeps the not yet
+	// materialized hours in the results
+	click_events_hourly_view_name := clickEventsHourlyView()
+	dimensions := strings.Join(clickEventDimensions, ", ")
 
-func InsertClickEventsBulk(events []*database.ClickEvent) *error {
-	ctx := context.Background()
-	queryInsertClickEventsData := `INSERT INTO click_events (url_id, geo, device, os, referrer, timestamp) VALUES ($1, $2, $3, $4, $5, $6);`
+	// a rollup missing one of the dimensions is dropped and rebuilt from the raw events
+	var hourly_view_columns int
+	err = db.QueryRow(ctx, "SELECT COUNT(*) FROM information_schema.columns WHERE table_name = $1 AND column_name::text = ANY($2::text[]);", click_events_hourly_view_name, clickEventDimensions).Scan(&hourly_view_columns)
+	if err != nil {
+		return fmt.Errorf("%v columns lookup failed: %w", click_events_hourly_view_name, err)
+	}
+	if hourly_view_columns > 0 && hourly_view_columns < len(clickEventDimensions) {
+		_, err = db.Exec(ctx, fmt.Sprintf("DROP MATERIALIZED VIEW %v;", click_events_hourly_view_name))
+		if err != nil {
+			return fmt.Errorf("drop outdated %v failed: %w", click_events_hourly_view_name, err)
+		}
+	}
 
-	connStr := os.Getenv("TIMESCALE_CONN")
-	db, err := pgx.Connect(ctx, connStr)
+	_, err = db.Exec(ctx, fmt.Sprintf(`CREATE MATERIALIZED VIEW IF NOT EXISTS %v
+		WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+		SELECT url_id, time_bucket(INTERVAL '1 hour', timestamp) AS bucket, %v, COUNT(*) AS clicks
+		FROM %v GROUP BY url_id, bucket, %v;`, click_events_hourly_view_name, dimensions, click_events_table_name, dimensions))
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to connect to database: %v\n", err)
-		return &err
+		return fmt.Errorf("create %v continuous aggregate failed: %w", click_events_hourly_view_name, err)
 	}
 
-	//create batch
-	batch := &pgx.Batch{}
-	//load insert statements into batch queue
-	for _, event := range events {
-		batch.Queue(queryInsertClickEventsData, &event.URLId, &event.Geo, &event.Device, &event.OS, &event.Referrer, &event.Timestamp)
+	_, err = db.Exec(ctx, fmt.Sprintf("SELECT add_continuous_aggregate_policy('%v', start_offset => INTERVAL '3 days', end_offset => INTERVAL '1 hour', schedule_interval => INTERVAL '30 minutes', if_not_exists => true);", click_events_hourly_view_name))
+	if err != nil {
+		return fmt.Errorf("create %v refresh policy failed: %w", click_events_hourly_view_name, err)
 	}
 
-	//send batch to connection pool
-	clickEventsInsertBatch := db.SendBatch(ctx, batch)
-	//execute statements in batch queue
-	_, err = clickEventsInsertBatch.Exec()
+	_, err = db.Exec(ctx, fmt.Sprintf("CREATE INDEX IF not EXISTS ix_hourly_url_bucket ON %v (url_id, bucket DESC);", click_events_hourly_view_name))
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to execute statement in batch queue for click events %v\n", err)
-		return &err
+		return fmt.Errorf("create ix_hourly_url_bucket index failed: %w", err)
 	}
-	fmt.Println("Successfully click events data batch inserted")
 
 	return nil
 }
 
-func QueryClickEvents(urlId string, startTime int64, endTime int64) (*map[string]map[string]int, error) {
+// nullableText stores empty values as NULL, so they drop out of the breakdowns
+func nullableText(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+func InsertClickEventsBulk(events []*database.ClickEvent) error {
+	db := timescaleDB.Load()
+	if db == nil {
+		return ErrNotConnected
+	}
+
 	ctx := context.Background()
-	queryClickEventsData := `SELECT device, os, geo, referrer FROM click_events WHERE url_id = $1 AND timestamp >= to_timestamp($2) AND timestamp <= to_timestamp($3);`
-	// queryClickEventsData := `SELECT COUNT(geo) AS geo_count, COUNT(device) AS device_count, COUNT(os) AS os_count, COUNT(referrer) AS referrer_count FROM click_events WHERE url_id = $1 AND timestamp >= to_timestamp($2) AND timestamp <= to_timestamp($3);`
-	// queryClickEventsData := `SELECT
-	// (SELECT json_agg(row_to_json(t)) FROM (SELECT device, COUNT(device) AS device_count FROM click_events WHERE url_id = $1 AND timestamp >= to_timestamp($2) AND timestamp <= to_timestamp($3) GROUP BY device) t) AS device_counts,
-	// (SELECT json_agg(row_to_json(t)) FROM (SELECT os, COUNT(os) AS os_count FROM click_events WHERE url_id = $1 AND timestamp >= to_timestamp($2) AND timestamp <= to_timestamp($3) GROUP BY os) t) AS os_counts,
-	// (SELECT json_agg(row_to_json(t)) FROM (SELECT geo, COUNT(geo) AS geo_count FROM click_events WHERE url_id = $1 AND timestamp >= to_timestamp($2) AND timestamp <= to_timestamp($3) GROUP BY geo) t) AS geo_counts,
-	// (SELECT json_agg(row_to_json(t)) FROM (SELECT referrer, COUNT(referrer) AS referrer_count FROM click_events WHERE url_id = $1 AND timestamp >= to_timestamp($2) AND timestamp <= to_timestamp($3) GROUP BY referrer) t) AS referrer_counts;`
-
-	rows, err := TimescaleDB.Query(ctx, queryClickEventsData, urlId, startTime, endTime)
+	columns := []string{"url_id", "geo", "device", "os", "referrer", "rule", "variant", "timestamp"}
+	rows := pgx.CopyFromSlice(len(events), func(i int) ([]interface{}, error) {
+		event := events[i]
+		rule := event.Rule
+		if rule == "" {
+			rule = database.DefaultClickRule
+		}
+		return []interface{}{event.URLId, string(event.Geo), event.Device, event.OS, event.Referrer, rule, nullableText(event.Variant), time.Unix(int64(event.Timestamp), 0)}, nil
+	})
+
+	inserted, err := db.CopyFrom(ctx, pgx.Identifier{clickEventsTable()}, columns, rows)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to execute query for click events %v\n", err)
+		fmt.Fprintf(os.Stderr, "Unable to copy click events %v\n", err)
+		return err
+	}
+	fmt.Printf("Successfully inserted %v click events\n", inserted)
+
+	return nil
+}
+
+// ClickSeriesIntervals maps the stats interval names to postgres intervals
+var ClickSeriesIntervals = map[string]string{
+	"hour": "1 hour",
+	"day":  "1 day",
+	"week": "1 week",
+}
+
+// QueryClickSeries counts the clicks of a url per time bucket of the interval from the
+// hourly rollup, buckets without clicks are gap filled with zero.
+func QueryClickSeries(urlId string, startTime int64, endTime int64, interval string) ([]*database.ClickBucket, error) {
+	ctx := context.Background()
+	queryClickSeries := `SELECT time_bucket_gapfill($4::interval, bucket, time_bucket(INTERVAL '1 hour', to_timestamp($2)), to_timestamp($3)) AS series_bucket, COALESCE(SUM(clicks), 0)::BIGINT AS clicks FROM ` + clickEventsHourlyView() + ` WHERE url_id = $1 AND bucket >= time_bucket(INTERVAL '1 hour', to_timestamp($2)) AND bucket <= to_timestamp($3) GROUP BY series_bucket ORDER BY series_bucket;`
+
+	bucketInterval, found := ClickSeriesIntervals[interval]
+	if !found {
+		return nil, fmt.Errorf("invalid interval %v", interval)
+	}
+
+	db := timescaleDB.Load()
+	if db == nil {
+		return nil, ErrNotConnected
+	}
+
+	rows, err := db.Query(ctx, queryClickSeries, urlId, startTime, endTime, bucketInterval)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to execute query for click series %v\n", err)
 		return nil, err
 	}
 	defer rows.Close()
 
-	var clickEvents []*database.ClickEvent
+	series := []*database.ClickBucket{}
 	for rows.Next() {
-		var device, os, geo, referrer string
-		if err := rows.Scan(&device, &os, &geo, &referrer); err != nil {
-			log.Fatalf("Failed to scan row: %v\n", err)
+		bucket := &database.ClickBucket{}
+		if err := rows.Scan(&bucket.Bucket, &bucket.Clicks); err != nil {
+			return nil, err
 		}
-		clickEvents = append(clickEvents, &database.ClickEvent{Device: device, OS: os, Geo: database.CountryName(geo), Referrer: referrer})
+		series = append(series, bucket)
+	}
+
+	return series, rows.Err()
+}
+
+// HourAlignedRange returns the whole hours inside [startTime, endTime] which can be
+// read from the hourly rollup, the edges outside of it are counted from the raw events.
+// An empty range (alignedStart == alignedEnd) means everything is read from the raw events.
+func HourAlignedRange(startTime int64, endTime int64) (alignedStart int64, alignedEnd int64) {
+	alignedStart = startTime + (3600-startTime%3600)%3600
+	alignedEnd = endTime - endTime%3600
+	if alignedStart >= alignedEnd {
+		return alignedStart, alignedStart
+	}
+	return alignedStart, alignedEnd
+}
+
+func QueryClickEvents(urlId string, startTime int64, endTime int64) (*map[string]map[string]int, error) {
+	ctx := context.Background()
+	// whole hours come from the hourly rollup, the partial hours at the edges from the raw events
+	queryClickEventsData := `WITH events AS (
+		SELECT device, os, geo, referrer, rule, variant, clicks FROM ` + clickEventsHourlyView() + ` WHERE url_id = $1 AND bucket >= to_timestamp($4) AND bucket < to_timestamp($5)
+		UNION ALL
+		SELECT device, os, geo, referrer, rule, variant, 1 AS clicks FROM ` + clickEventsTable() + ` WHERE url_id = $1 AND timestamp >= to_timestamp($2) AND timestamp <= to_timestamp($3) AND (timestamp < to_timestamp($4) OR timestamp >= to_timestamp($5))
+	)
+	SELECT 'device_counts', device, SUM(clicks)::BIGINT FROM events GROUP BY device
+	UNION ALL SELECT 'os_counts', os, SUM(clicks)::BIGINT FROM events GROUP BY os
+	UNION ALL SELECT 'geo_counts', geo, SUM(clicks)::BIGINT FROM events GROUP BY geo
+	UNION ALL SELECT 'referrer_counts', referrer, SUM(clicks)::BIGINT FROM events GROUP BY referrer
+	UNION ALL SELECT 'rule_counts', COALESCE(rule, '` + database.DefaultClickRule + `'), SUM(clicks)::BIGINT FROM events GROUP BY COALESCE(rule, '` + database.DefaultClickRule + `')
+	UNION ALL SELECT 'variant_counts', variant, SUM(clicks)::BIGINT FROM events WHERE variant IS NOT NULL GROUP BY variant;`
+
+	db := timescaleDB.Load()
+	if db == nil {
+		return nil, ErrNotConnected
+	}
+
+	alignedStart, alignedEnd := HourAlignedRange(startTime, endTime)
+	rows, err := db.Query(ctx, queryClickEventsData, urlId, startTime, endTime, alignedStart, alignedEnd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to execute query for click events %v\n", err)
+		return nil, err
 	}
+	defer rows.Close()
 
 	clickCounts := map[string]map[string]int{
 		"device_counts":   make(map[string]int),
 		"os_counts":       make(map[string]int),
 		"geo_counts":      make(map[string]int),
 		"referrer_counts": make(map[string]int),
+		"rule_counts":     make(map[string]int),
+		"variant_counts":  make(map[string]int),
 	}
 
-	for _, event := range clickEvents {
-		clickCounts["device_counts"][event.Device]++
-		clickCounts["os_counts"][event.OS]++
-		clickCounts["geo_counts"][string(event.Geo)]++
-		clickCounts["referrer_counts"][event.Referrer]++
-		clickCounts["device_counts"]["total"]++
-		clickCounts["os_counts"]["total"]++
-		clickCounts["geo_counts"]["total"]++
-		clickCounts["referrer_counts"]["total"]++
+	for rows.Next() {
+		var breakdown string
+		var value *string
+		var clicks int64
+		if err := rows.Scan(&breakdown, &value, &clicks); err != nil {
+			return nil, err
+		}
+		key := ""
+		if value != nil {
+			key = *value
+		}
+		clickCounts[breakdown][key] += int(clicks)
+		clickCounts[breakdown]["total"] += int(clicks)
 	}
 
-	return &clickCounts, nil
+	return &clickCounts, rows.Err()
 }
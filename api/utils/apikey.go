@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+const APIKeyPrefix = "shorte_"
+
+// the part of the key kept in plain text to tell keys apart in listings
+const apiKeyDisplayLength = len(APIKeyPrefix) + 6
+
+// GenerateAPIKey returns a new random key with its display prefix and the hash to
+// store, the key itself is only ever shown to the user once.
+func GenerateAPIKey() (key string, prefix string, hash string, err error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+
+	key = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return key, key[:apiKeyDisplayLength], HashAPIKey(key), nil
+}
+
+// HashAPIKey hashes the key for lookups, keys are random so a plain sha256 is enough.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
@@ -0,0 +1,18 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+const DomainTokenPrefix = "shorte-verification="
+
+// GenerateDomainToken returns the value a user publishes in the TXT record of
+// their domain to prove they own it.
+func GenerateDomainToken() (string, error) {
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return DomainTokenPrefix + hex.EncodeToString(secret), nil
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ivinayakg/shorte.live/api/database"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const unlockCookiePrefix = "shorte-unlock-"
+
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func ComparePassword(hash string, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+func unlockExpiry() int {
+	expiryTotal, err := strconv.Atoi(os.Getenv("URL_UNLOCK_EXPIRY"))
+	if err != nil || expiryTotal <= 0 {
+		expiryTotal = 900
+	}
+	return expiryTotal
+}
+
+// signUnlock ties the signature to the password hash, so changing the password
+// of a url invalidates the cookies issued for the old one.
+func signUnlock(url *database.URL, expiry int64) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("JWT_SECRET_KEY")))
+	mac.Write([]byte(fmt.Sprintf("%v.%v.%v", url.ID.Hex(), expiry, url.Password)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func CreateUnlockCookie(url *database.URL) *http.Cookie {
+	maxAge := unlockExpiry()
+	expiry := time.Now().Add(time.Duration(maxAge) * time.Second).Unix()
+
+	return &http.Cookie{
+		Name:     unlockCookiePrefix + url.ID.Hex(),
+		Value:    fmt.Sprintf("%v.%v", expiry, signUnlock(url, expiry)),
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/",
+	}
+}
+
+func VerifyUnlockCookie(r *http.Request, url *database.URL) bool {
+	cookie, err := r.Cookie(unlockCookiePrefix + url.ID.Hex())
+	if err != nil {
+		return false
+	}
+
+	parts := strings.SplitN(cookie.Value, ".", 2)
+	if len(parts) != 2 {
+		return false
+	}
+
+	expiry, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || time.Now().Unix() > expiry {
+		return false
+	}
+
+	return hmac.Equal([]byte(parts[1]), []byte(signUnlock(url, expiry)))
+}
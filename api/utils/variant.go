@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"net/http"
+
+	"github.com/ivinayakg/shorte.live/api/database"
+)
+
+const variantCookiePrefix = "shorte-variant-"
+
+// a visitor stays on their variant for the length of a typical experiment
+const variantCookieMaxAge = 30 * 24 * 60 * 60
+
+// CreateVariantCookie remembers the A/B variant the visitor was sent to.
+func CreateVariantCookie(url *database.URL, variant string) *http.Cookie {
+	return &http.Cookie{
+		Name:     variantCookiePrefix + url.ID.Hex(),
+		Value:    variant,
+		MaxAge:   variantCookieMaxAge,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/",
+	}
+}
+
+// GetVariantCookie is the variant the visitor was sent to before, empty when
+// they haven't been.
+func GetVariantCookie(r *http.Request, url *database.URL) string {
+	cookie, err := r.Cookie(variantCookiePrefix + url.ID.Hex())
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}